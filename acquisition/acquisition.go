@@ -7,6 +7,8 @@ package acquisition
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -14,12 +16,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"filippo.io/age"
 	"github.com/botherder/go-savetime/hashes"
 	"github.com/google/uuid"
 	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/assets"
 	"github.com/mvt-project/androidqf/log"
 	"github.com/mvt-project/androidqf/utils"
 )
@@ -31,84 +34,134 @@ type Acquisition struct {
 	StoragePath      string              `json:"storage_path"`
 	Started          time.Time           `json:"started"`
 	Completed        time.Time           `json:"completed"`
+	Resumed          []time.Time         `json:"resumed,omitempty"`
+	Serial           string              `json:"serial"`
+	Case             Case                `json:"case"`
+	Host             Host                `json:"host"`
+	Client           *adb.ADB            `json:"-"`
+	Log              *log.Logger         `json:"-"`
 	Collector        *adb.Collector      `json:"collector"`
 	TmpDir           string              `json:"tmp_dir"`
 	SdCard           string              `json:"sdcard"`
 	Cpu              string              `json:"cpu"`
+	Device           *DeviceSummary      `json:"device,omitempty"`
 	closeLog         func()              `json:"-"`
+	options          Options             `json:"-"`
 	EncryptedWriter  *EncryptedZipWriter `json:"-"`
 	StreamingMode    bool                `json:"streaming_mode"`
 	StreamingPuller  *StreamingPuller    `json:"-"`
+	Interrupted      bool                `json:"interrupted"`
+	InterruptedIn    string              `json:"interrupted_module,omitempty"`
+	Profile          *Profile            `json:"-"`
+	Answers          map[string]Answer   `json:"answers,omitempty"`
+	answersMu        sync.Mutex          `json:"-"`
+	Modules          []ModuleResult      `json:"modules"`
+	modulesMu        sync.Mutex          `json:"-"`
 	logBuffer        *bytes.Buffer       `json:"-"`
+	// SigningKey, if set, signs the manifest of the acquisition.
+	SigningKey ed25519.PrivateKey `json:"-"`
+	fileHashes []ManifestFile     `json:"-"`
+	// deviceModel caches model(), which runs a command on the device.
+	deviceModel     string    `json:"-"`
+	deviceModelOnce sync.Once `json:"-"`
 }
 
-// New returns a new Acquisition instance.
-func New(path string) (*Acquisition, error) {
+// Options are how an acquisition is stored and described.
+type Options struct {
+	// Recipients the acquisition is encrypted to, if any.
+	Recipients []age.Recipient
+	// VolumeSize, if set, splits the encrypted archive into volumes of at
+	// most this many bytes.
+	VolumeSize int64
+	// OutputDir is where the encrypted archive, or the acquisition folder
+	// named after the template, is written, the current folder if empty.
+	OutputDir string
+	// NameTemplate names the acquisition folder or archive, see
+	// CheckNameTemplate. DefaultNameTemplate if empty.
+	NameTemplate string
+	// Case is recorded in acquisition.json, its identifier can be used in
+	// the name template.
+	Case Case
+}
+
+// New returns a new Acquisition instance of the device of the given client,
+// logging where the client does. With recipients, the acquisition is
+// streamed to an archive encrypted to them, in the folder at path if given.
+// Otherwise it is stored in the folder at path, or in a folder named after
+// the name template in the output folder of the options.
+func New(client *adb.ADB, path string, opts Options) (*Acquisition, error) {
 	acq := Acquisition{
 		UUID:             uuid.New().String(),
 		Started:          time.Now().UTC(),
 		AndroidQFVersion: utils.Version,
+		Client:           client,
+		Log:              client.Log,
+		Case:             opts.Case,
+		options:          opts,
 	}
-
-	if path == "" {
-		acq.StoragePath = acq.UUID
-	} else {
-		acq.StoragePath = path
-	}
-	// Check if the path exist
-	stat, err := os.Stat(acq.StoragePath)
-	if os.IsNotExist(err) {
-		err := os.Mkdir(acq.StoragePath, 0o755)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create acquisition folder: %v", err)
-		}
-	} else {
-		if !stat.IsDir() {
-			return nil, fmt.Errorf("path exist and is not a folder")
-		}
+	if acq.Log == nil {
+		acq.Log = log.Get()
 	}
+	acq.getHost()
 
-	// Get system information first to get tmp folder
-	err = acq.GetSystemInformation()
+	acq.Serial = client.Serial
+	err := acq.initDevice()
 	if err != nil {
 		return nil, err
 	}
 
-	coll, err := adb.Client.GetCollector(acq.TmpDir, acq.Cpu)
-	if err != nil {
-		// Collector install failed, will use find instead
-		log.Debugf("failed to upload collector: %v", err)
-	}
-	acq.Collector = coll
-
-	// Try to initialize encrypted streaming mode
-	encWriter, err := NewEncryptedZipWriter(acq.UUID)
-	if err != nil {
-		// No key file or encryption setup failed, use normal mode
-		log.Debug("Encrypted streaming not available, using normal mode")
+	if len(opts.Recipients) == 0 {
+		// No recipients, use normal mode
+		acq.Log.Debug("Encrypted streaming not available, using normal mode")
 		acq.StreamingMode = false
 
+		acq.StoragePath = path
+		if path == "" {
+			acq.StoragePath = acq.outputName()
+		}
+		if path == "" && opts.OutputDir != "" {
+			outputDir, err := opts.outputDir()
+			if err != nil {
+				return nil, err
+			}
+			acq.StoragePath = filepath.Join(outputDir, acq.StoragePath)
+		}
+		// A folder named after the template may be that of another
+		// acquisition, only a folder given explicitly is reused.
+		err = createStorageFolder(acq.StoragePath, path == "")
+		if err != nil {
+			return nil, err
+		}
+
 		// Init logging file for normal mode
 		logPath := filepath.Join(acq.StoragePath, "command.log")
-		closeLog, err := log.EnableFileLog(log.DEBUG, logPath)
+		closeLog, err := acq.Log.EnableFileLog(log.DEBUG, logPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to enable file logging: %v", err)
 		}
 		acq.closeLog = closeLog
 	} else {
-		// Encrypted streaming mode enabled
-		log.Info("Using encrypted streaming mode - data will be written directly to encrypted archive")
+		// Encrypted streaming mode, nothing is written unencrypted so
+		// there is no acquisition folder.
+		if path != "" {
+			acq.options.OutputDir = path
+		}
+		encWriter, err := NewEncryptedZipWriter(acq.outputName(), acq.options, acq.Log)
+		if err != nil {
+			return nil, err
+		}
+		acq.Log.Info("Using encrypted streaming mode - data will be written directly to encrypted archive")
 		acq.StreamingMode = true
 		acq.EncryptedWriter = encWriter
 
 		// Initialize streaming puller for direct operations
-		acq.StreamingPuller = NewStreamingPuller(adb.Client.ExePath, adb.Client.Serial, 100) // 100MB max memory
+		acq.StreamingPuller = NewStreamingPuller(client, 100) // 100MB max memory
 
 		// Create buffer for command.log (will be written to archive at completion)
 		acq.logBuffer = new(bytes.Buffer)
 
 		// Init logging to write to buffer
-		closeLog, err := log.EnableWriterLog(log.DEBUG, acq.logBuffer)
+		closeLog, err := acq.Log.EnableWriterLog(log.DEBUG, acq.logBuffer)
 		if err != nil {
 			return nil, fmt.Errorf("failed to enable writer logging: %v", err)
 		}
@@ -118,6 +171,58 @@ func New(path string) (*Acquisition, error) {
 	return &acq, nil
 }
 
+// createStorageFolder creates the acquisition folder at path. An existing
+// folder is an error if exclusive is set, and is reused otherwise.
+func createStorageFolder(path string, exclusive bool) error {
+	err := os.Mkdir(path, 0o755)
+	if err == nil {
+		return nil
+	}
+	if !os.IsExist(err) {
+		return fmt.Errorf("failed to create acquisition folder: %v", err)
+	}
+	if exclusive {
+		return fmt.Errorf("acquisition folder %s already exists", path)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to create acquisition folder: %v", err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("path exist and is not a folder")
+	}
+	return nil
+}
+
+// initDevice gets the system information and uploads the collector.
+func (a *Acquisition) initDevice() error {
+	// Get system information first to get tmp folder
+	err := a.GetSystemInformation()
+	if err != nil {
+		return err
+	}
+
+	coll, err := a.Client.GetCollector(a.TmpDir, a.Cpu)
+	if err != nil {
+		// Collector install failed, will use find instead
+		a.Log.Debugf("failed to upload collector: %v", err)
+	}
+	a.Collector = coll
+	return nil
+}
+
+// SetAnswer records the answer given to a question in acquisition.json.
+func (a *Acquisition) SetAnswer(key, value, source string) {
+	a.answersMu.Lock()
+	defer a.answersMu.Unlock()
+
+	if a.Answers == nil {
+		a.Answers = make(map[string]Answer)
+	}
+	a.Answers[key] = Answer{Value: value, Source: source}
+}
+
 func (a *Acquisition) Complete() {
 	if a.Completed.IsZero() {
 		a.Completed = time.Now().UTC()
@@ -128,11 +233,11 @@ func (a *Acquisition) Complete() {
 		// Store acquisition info in the encrypted zip
 		info, err := json.MarshalIndent(a, "", " ")
 		if err != nil {
-			log.Error("Failed to marshal acquisition info for encrypted archive")
+			a.Log.Error("Failed to marshal acquisition info for encrypted archive")
 		} else {
 			err = a.EncryptedWriter.CreateFileFromBytes("acquisition.json", info)
 			if err != nil {
-				log.ErrorExc("Failed to store acquisition info in encrypted archive", err)
+				a.Log.ErrorExc("Failed to store acquisition info in encrypted archive", err)
 			}
 		}
 
@@ -146,30 +251,28 @@ func (a *Acquisition) Complete() {
 		if a.logBuffer != nil && a.logBuffer.Len() > 0 {
 			err = a.EncryptedWriter.CreateFileFromBytes("command.log", a.logBuffer.Bytes())
 			if err != nil {
-				log.ErrorExc("Failed to add command.log to encrypted archive", err)
+				a.Log.ErrorExc("Failed to add command.log to encrypted archive", err)
 			}
 		}
 
 		err = a.EncryptedWriter.CreateHashList()
 		if err != nil {
-			log.ErrorExc("Failed to add hashes.csv to encrypted archive", err)
+			a.Log.ErrorExc("Failed to add hashes.csv to encrypted archive", err)
+		}
+
+		if a.SigningKey != nil {
+			err = a.storeStreamingManifest()
+			if err != nil {
+				a.Log.ErrorExc("Failed to add the signed manifest to encrypted archive", err)
+			}
 		}
 
 		// Close the encrypted writer
 		err = a.EncryptedWriter.Close()
 		if err != nil {
-			log.ErrorExc("Failed to close encrypted archive", err)
+			a.Log.ErrorExc("Failed to close encrypted archive", err)
 		}
 
-		// Remove the temporary storage directory if it was created and used
-		if a.StoragePath != "" {
-			if _, err := os.Stat(a.StoragePath); err == nil {
-				err = os.RemoveAll(a.StoragePath)
-				if err != nil {
-					log.ErrorExc("Failed to clean up temporary storage directory", err)
-				}
-			}
-		}
 	} else {
 		// Ensure log file is closed before cleanup operations
 		if a.closeLog != nil {
@@ -180,31 +283,25 @@ func (a *Acquisition) Complete() {
 	if a.Collector != nil {
 		a.Collector.Clean()
 	}
-
-	// Stop ADB server before trying to remove extracted assets
-	if adb.Client != nil {
-		adb.Client.KillServer()
-	}
-	assets.CleanAssets()
 }
 
 func (a *Acquisition) GetSystemInformation() error {
 	// Get architecture information
-	out, err := adb.Client.Shell("getprop ro.product.cpu.abi")
+	res, err := a.Client.RunShell("getprop ro.product.cpu.abi")
 	if err != nil {
 		return err
 	}
-	a.Cpu = out
-	log.Debugf("CPU architecture: %s", a.Cpu)
+	a.Cpu = strings.TrimSpace(res.Stdout)
+	a.Log.Debugf("CPU architecture: %s", a.Cpu)
 
 	// Get tmp folder
-	out, err = adb.Client.Shell("env")
+	res, err = a.Client.RunShell("env")
 	if err != nil {
 		return fmt.Errorf("failed to run `adb shell env`: %v", err)
 	}
 	a.TmpDir = "/data/local/tmp/"
 	a.SdCard = "/sdcard/"
-	for _, line := range strings.Split(out, "\n") {
+	for _, line := range strings.Split(res.Stdout, "\n") {
 		line = strings.TrimSpace(line)
 		if strings.HasPrefix(line, "TMPDIR=") {
 			a.TmpDir = strings.TrimPrefix(line, "TMPDIR=")
@@ -220,19 +317,19 @@ func (a *Acquisition) GetSystemInformation() error {
 		a.SdCard = a.SdCard + "/"
 	}
 
-	log.Debugf("Found temp folder at %s", a.TmpDir)
-	log.Debugf("Found sdcard at %s", a.SdCard)
+	a.Log.Debugf("Found temp folder at %s", a.TmpDir)
+	a.Log.Debugf("Found sdcard at %s", a.SdCard)
 	return nil
 }
 
 func (a *Acquisition) HashFiles() error {
 	// In streaming mode, files are directly encrypted and no local files exist to hash
 	if a.StreamingMode {
-		log.Debug("Skipping hash generation in streaming mode (data is encrypted)")
+		a.Log.Debug("Skipping hash generation in streaming mode (data is encrypted)")
 		return nil
 	}
 
-	log.Info("Generating list of files hashes...")
+	a.Log.Info("Generating list of files hashes...")
 
 	csvFile, err := os.Create(filepath.Join(a.StoragePath, "hashes.csv"))
 	if err != nil {
@@ -241,15 +338,24 @@ func (a *Acquisition) HashFiles() error {
 	defer csvFile.Close()
 
 	csvWriter := csv.NewWriter(csvFile)
+	a.fileHashes = nil
 
 	walkErr := filepath.Walk(a.StoragePath, func(filePath string, fileInfo os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		// These are written to after the hashes are generated.
 		if fileInfo.IsDir() {
 			return nil
 		}
+		rel, err := filepath.Rel(a.StoragePath, filePath)
+		if err != nil {
+			return err
+		}
+		if isUnhashed(filepath.ToSlash(rel)) {
+			return nil
+		}
 		// Makes files read only
 		os.Chmod(filePath, 0o400)
 
@@ -258,6 +364,12 @@ func (a *Acquisition) HashFiles() error {
 			return err
 		}
 
+		a.fileHashes = append(a.fileHashes, ManifestFile{
+			Name:   filepath.ToSlash(rel),
+			Size:   fileInfo.Size(),
+			SHA256: sha256,
+		})
+
 		return csvWriter.Write([]string{filePath, sha256})
 	})
 
@@ -279,7 +391,25 @@ func (a *Acquisition) StoreInfo() error {
 		a.Completed = time.Now().UTC()
 	}
 
-	log.Info("Saving details about acquisition and device...")
+	a.Log.Info("Saving details about acquisition and device...")
+	return a.writeInfo()
+}
+
+// StoreProgress saves acquisition.json while modules are still running, so
+// that an acquisition cut short can be resumed.
+func (a *Acquisition) StoreProgress() error {
+	if a.StreamingMode || a.StoragePath == "" {
+		return nil
+	}
+	return a.writeInfo()
+}
+
+func (a *Acquisition) writeInfo() error {
+	// Modules running at the same time save the progress concurrently.
+	a.modulesMu.Lock()
+	defer a.modulesMu.Unlock()
+	a.answersMu.Lock()
+	defer a.answersMu.Unlock()
 
 	info, err := json.MarshalIndent(a, "", " ")
 	if err != nil {
@@ -299,7 +429,7 @@ func (a *Acquisition) StoreInfo() error {
 }
 
 // StreamAPKToZip streams an APK file directly to encrypted zip with certificate processing
-func (a *Acquisition) StreamAPKToZip(remotePath, zipPath string, processFunc func(io.Reader) error) error {
+func (a *Acquisition) StreamAPKToZip(ctx context.Context, remotePath, zipPath string, processFunc func(io.Reader) error) error {
 	if err := a.validateStreamingMode(); err != nil {
 		return err
 	}
@@ -312,9 +442,9 @@ func (a *Acquisition) StreamAPKToZip(remotePath, zipPath string, processFunc fun
 	}
 
 	// Pull APK data to memory buffer
-	buffer, err := a.StreamingPuller.PullToBuffer(remotePath)
+	buffer, err := a.StreamingPuller.PullToBufferContext(ctx, remotePath)
 	if err != nil {
-		return fmt.Errorf("failed to pull APK %q: %v", remotePath, err)
+		return fmt.Errorf("failed to pull APK %q: %w", remotePath, err)
 	}
 
 	// Process APK if processor provided (e.g., certificate verification)
@@ -335,7 +465,7 @@ func (a *Acquisition) StreamAPKToZip(remotePath, zipPath string, processFunc fun
 }
 
 // StreamBackupToZip streams a backup directly to encrypted zip
-func (a *Acquisition) StreamBackupToZip(arg, zipPath string) error {
+func (a *Acquisition) StreamBackupToZip(ctx context.Context, arg, zipPath string) error {
 	if err := a.validateStreamingMode(); err != nil {
 		return err
 	}
@@ -352,18 +482,19 @@ func (a *Acquisition) StreamBackupToZip(arg, zipPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create zip entry for backup: %v", err)
 	}
+	defer writer.Close()
 
 	// Stream backup directly to zip
-	err = a.StreamingPuller.BackupToWriter(arg, writer)
+	err = a.StreamingPuller.BackupToWriterContext(ctx, arg, writer)
 	if err != nil {
-		return fmt.Errorf("failed to stream backup %q to zip: %v", arg, err)
+		return fmt.Errorf("failed to stream backup %q to zip: %w", arg, err)
 	}
 
 	return nil
 }
 
 // StreamBugreportToZip streams a bugreport directly to encrypted zip
-func (a *Acquisition) StreamBugreportToZip(zipPath string) error {
+func (a *Acquisition) StreamBugreportToZip(ctx context.Context, zipPath string) error {
 	if err := a.validateStreamingMode(); err != nil {
 		return err
 	}
@@ -372,16 +503,34 @@ func (a *Acquisition) StreamBugreportToZip(zipPath string) error {
 		return fmt.Errorf("zip path cannot be empty")
 	}
 
+	return a.streamBugreport(ctx, a.Client, zipPath)
+}
+
+// bugreportSource generates bugreports on the device and pulls them.
+type bugreportSource interface {
+	GenerateBugreport(ctx context.Context) (string, error)
+	PullBugreportContext(ctx context.Context, filename string, w io.Writer) error
+}
+
+// streamBugreport generates the bugreport before creating its zip entry,
+// so that the other modules can write to the zip meanwhile.
+func (a *Acquisition) streamBugreport(ctx context.Context, source bugreportSource, zipPath string) error {
+	filename, err := source.GenerateBugreport(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Create zip entry writer
 	writer, err := a.EncryptedWriter.CreateFile(zipPath)
 	if err != nil {
 		return fmt.Errorf("failed to create zip entry for bugreport: %v", err)
 	}
+	defer writer.Close()
 
 	// Stream bugreport directly to zip
-	err = a.StreamingPuller.BugreportToWriter(writer)
+	err = source.PullBugreportContext(ctx, filename, writer)
 	if err != nil {
-		return fmt.Errorf("failed to stream bugreport to zip: %v", err)
+		return fmt.Errorf("failed to stream bugreport to zip: %w", err)
 	}
 
 	return nil
@@ -1,10 +1,14 @@
 package acquisition
 
 import (
+	"archive/zip"
+	"context"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestStoreInfoSetsCompletedTimestamp(t *testing.T) {
@@ -66,9 +70,14 @@ func TestStoreSecurelyUsesCurrentWorkingDirectory(t *testing.T) {
 		t.Fatalf("WriteFile(data.txt) error = %v", err)
 	}
 
+	recipients, err := Encryption{}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
 	acq := &Acquisition{
 		UUID:        "test-acquisition",
 		StoragePath: storagePath,
+		options:     Options{Recipients: recipients},
 	}
 
 	if err := acq.StoreSecurely(); err != nil {
@@ -82,4 +91,92 @@ func TestStoreSecurelyUsesCurrentWorkingDirectory(t *testing.T) {
 	if _, err := os.Stat(storagePath); !os.IsNotExist(err) {
 		t.Fatalf("storage path still exists or returned unexpected error: %v", err)
 	}
+	// The folder is compressed straight into the encrypted archive.
+	if _, err := os.Stat(filepath.Join(cwd, "test-acquisition.zip")); !os.IsNotExist(err) {
+		t.Fatalf("unencrypted archive exists or returned unexpected error: %v", err)
+	}
+}
+
+// slowBugreport takes until release is closed to generate a bugreport.
+type slowBugreport struct {
+	generating chan struct{}
+	release    chan struct{}
+}
+
+func (b *slowBugreport) GenerateBugreport(ctx context.Context) (string, error) {
+	close(b.generating)
+	<-b.release
+	return "/bugreports/bugreport.zip", nil
+}
+
+func (b *slowBugreport) PullBugreportContext(ctx context.Context, filename string, w io.Writer) error {
+	_, err := io.WriteString(w, "bugreport")
+	return err
+}
+
+func TestStreamBugreportDoesNotBlockOtherEntries(t *testing.T) {
+	acq := &Acquisition{
+		StreamingMode:   true,
+		EncryptedWriter: &EncryptedZipWriter{zipWriter: zip.NewWriter(io.Discard)},
+	}
+	source := &slowBugreport{generating: make(chan struct{}), release: make(chan struct{})}
+	streamed := make(chan error, 1)
+	go func() {
+		streamed <- acq.streamBugreport(context.Background(), source, "bugreport.zip")
+	}()
+	<-source.generating
+
+	// Another module, with a short timeout, writes while bugreportz runs.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	written := make(chan error, 1)
+	go func() {
+		written <- acq.EncryptedWriter.CreateFileFromString("getprop.txt", "props")
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("CreateFileFromString() error = %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("CreateFileFromString() waited for the bugreport to be generated")
+	}
+
+	close(source.release)
+	if err := <-streamed; err != nil {
+		t.Fatalf("streamBugreport() error = %v", err)
+	}
+	entries := acq.EncryptedWriter.Entries()
+	if len(entries) != 2 || entries[0].Name != "getprop.txt" || entries[1].Name != "bugreport.zip" {
+		t.Fatalf("Entries() = %+v, want getprop.txt then bugreport.zip", entries)
+	}
+}
+
+func TestSetDeviceWhileStoringProgress(t *testing.T) {
+	acq := &Acquisition{StoragePath: t.TempDir()}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		acq.SetDevice(&DeviceSummary{Model: "Pixel 8"})
+	}()
+	if err := acq.StoreProgress(); err != nil {
+		t.Fatalf("StoreProgress() error = %v", err)
+	}
+	<-done
+
+	if err := acq.StoreProgress(); err != nil {
+		t.Fatalf("StoreProgress() error = %v", err)
+	}
+	info, err := os.ReadFile(filepath.Join(acq.StoragePath, "acquisition.json"))
+	if err != nil {
+		t.Fatalf("ReadFile(acquisition.json) error = %v", err)
+	}
+	var stored Acquisition
+	if err := json.Unmarshal(info, &stored); err != nil {
+		t.Fatalf("Unmarshal(acquisition.json) error = %v", err)
+	}
+	if stored.Device == nil || stored.Device.Model != "Pixel 8" {
+		t.Fatalf("stored device = %+v, want the summary", stored.Device)
+	}
 }
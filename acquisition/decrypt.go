@@ -0,0 +1,256 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/mvt-project/androidqf/utils"
+)
+
+// unhashedFiles may be written after the hashes are generated, so they are
+// not reported when missing from hashes.csv.
+var unhashedFiles = []string{"hashes.csv", "acquisition.json", "command.log", manifestFileName, signatureFileName}
+
+// Verification is the outcome of checking the files extracted from an
+// archive against its hashes.csv.
+type Verification struct {
+	// Verified is the number of files matching their hash.
+	Verified int
+	// Missing are the files in hashes.csv which are not in the archive.
+	Missing []string
+	// Extra are the files in the archive which are not in hashes.csv.
+	Extra []string
+	// Mismatched are the files whose hash differs from hashes.csv.
+	Mismatched []string
+}
+
+// OK returns whether every file matched hashes.csv.
+func (v *Verification) OK() bool {
+	return len(v.Missing) == 0 && len(v.Extra) == 0 && len(v.Mismatched) == 0
+}
+
+// Decrypt decrypts the .zip.age archive, or the volumes of the volume or
+// volume index at archivePath, with the age identities, extracts it to
+// outputPath, which must not exist, and verifies the extracted files
+// against the hashes.csv in the archive.
+func Decrypt(archivePath string, identities []age.Identity, outputPath string) (*Verification, error) {
+	archive, err := openArchive(archivePath, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	return extractAndVerify(archive.reader, outputPath)
+}
+
+// decryptedArchive is an encrypted archive decrypted to a temporary file.
+type decryptedArchive struct {
+	file   *os.File
+	reader *zip.Reader
+}
+
+// openArchive decrypts the .zip.age archive, or its volumes, with the age
+// identities. The zip central directory is at the end, so the archive is
+// decrypted to a temporary file, which is removed by Close.
+func openArchive(archivePath string, identities []age.Identity) (*decryptedArchive, error) {
+	plain, err := os.CreateTemp("", "androidqf-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	decrypted := &decryptedArchive{file: plain}
+
+	err = readVolumes(archivePath, identities, plain)
+	if err != nil {
+		decrypted.Close()
+		return nil, err
+	}
+	size, err := plain.Seek(0, io.SeekCurrent)
+	if err != nil {
+		decrypted.Close()
+		return nil, err
+	}
+	decrypted.reader, err = zip.NewReader(plain, size)
+	if err != nil {
+		decrypted.Close()
+		return nil, fmt.Errorf("failed to read decrypted archive: %v", err)
+	}
+
+	return decrypted, nil
+}
+
+// Close removes the decrypted archive.
+func (d *decryptedArchive) Close() error {
+	d.file.Close()
+	return utils.RemoveFile(d.file.Name())
+}
+
+func extractAndVerify(zipReader *zip.Reader, outputPath string) (*Verification, error) {
+	// Check all the names before writing anything.
+	for _, file := range zipReader.File {
+		if err := validateZipEntryName(strings.TrimSuffix(file.Name, "/")); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := os.Stat(outputPath); err == nil {
+		return nil, fmt.Errorf("%s already exists", outputPath)
+	}
+	if err := os.MkdirAll(outputPath, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output folder: %v", err)
+	}
+	root, err := os.OpenRoot(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output folder: %v", err)
+	}
+	defer root.Close()
+
+	hashes := make(map[string]string)
+	for _, file := range zipReader.File {
+		if strings.HasSuffix(file.Name, "/") {
+			if err := root.MkdirAll(strings.TrimSuffix(file.Name, "/"), 0o755); err != nil {
+				return nil, fmt.Errorf("failed to create folder %s: %v", file.Name, err)
+			}
+			continue
+		}
+
+		sum, err := extractFile(root, file)
+		if err != nil {
+			return nil, err
+		}
+		hashes[file.Name] = sum
+	}
+
+	expected, err := readHashList(zipReader)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &Verification{}
+	for name, sum := range expected {
+		actual, ok := hashes[name]
+		switch {
+		case !ok:
+			verification.Missing = append(verification.Missing, name)
+		case !strings.EqualFold(actual, sum):
+			verification.Mismatched = append(verification.Mismatched, name)
+		default:
+			verification.Verified++
+		}
+	}
+	for name := range hashes {
+		if _, ok := expected[name]; !ok && !isUnhashed(name) {
+			verification.Extra = append(verification.Extra, name)
+		}
+	}
+	sort.Strings(verification.Missing)
+	sort.Strings(verification.Extra)
+	sort.Strings(verification.Mismatched)
+
+	return verification, nil
+}
+
+// extractFile writes the zip entry below root and returns its SHA-256.
+func extractFile(root *os.Root, file *zip.File) (string, error) {
+	if dir := path.Dir(file.Name); dir != "." {
+		if err := root.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create folder %s: %v", dir, err)
+		}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s in archive: %v", file.Name, err)
+	}
+	defer src.Close()
+
+	dst, err := root.OpenFile(file.Name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", file.Name, err)
+	}
+	defer dst.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, hasher), src); err != nil {
+		return "", fmt.Errorf("failed to extract %s: %v", file.Name, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("failed to extract %s: %v", file.Name, err)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// readHashList returns the hashes in the hashes.csv of the archive, by entry
+// name. Encrypted at the end of the acquisition, hashes.csv has the paths of
+// the files on the acquisition computer, which start with the storage path
+// recorded in acquisition.json.
+func readHashList(zipReader *zip.Reader) (map[string]string, error) {
+	data, err := readZipFile(zipReader, "hashes.csv")
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify the archive: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse hashes.csv: %v", err)
+	}
+
+	prefix := ""
+	if info, err := readZipFile(zipReader, "acquisition.json"); err == nil {
+		var acq struct {
+			StoragePath   string `json:"storage_path"`
+			StreamingMode bool   `json:"streaming_mode"`
+		}
+		if json.Unmarshal(info, &acq) == nil && !acq.StreamingMode && acq.StoragePath != "" {
+			prefix = strings.TrimSuffix(strings.ReplaceAll(acq.StoragePath, "\\", "/"), "/") + "/"
+		}
+	}
+
+	expected := make(map[string]string, len(records))
+	for _, record := range records {
+		if len(record) != 2 {
+			return nil, fmt.Errorf("invalid line in hashes.csv: %q", strings.Join(record, ","))
+		}
+		name := strings.TrimPrefix(strings.ReplaceAll(record[0], "\\", "/"), prefix)
+		// Older acquisitions hashed hashes.csv while writing it.
+		if name == "hashes.csv" {
+			continue
+		}
+		expected[name] = record[1]
+	}
+
+	return expected, nil
+}
+
+func readZipFile(zipReader *zip.Reader, name string) ([]byte, error) {
+	file, err := zipReader.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in archive", name)
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+func isUnhashed(name string) bool {
+	for _, unhashed := range unhashedFiles {
+		if name == unhashed {
+			return true
+		}
+	}
+	return false
+}
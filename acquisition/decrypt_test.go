@@ -0,0 +1,173 @@
+package acquisition
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// writeTestArchive encrypts a zip with the given files to a new identity,
+// and returns the path of the archive and the identity.
+func writeTestArchive(t *testing.T, files map[string]string) (string, []age.Identity) {
+	t.Helper()
+
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+
+	archivePath := filepath.Join(dir, "test.zip.age")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer archive.Close()
+	encrypted, err := age.Encrypt(archive, identity.Recipient())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	zipWriter := zip.NewWriter(encrypted)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatalf("zip Create(%q) error = %v", name, err)
+		}
+		if _, err := writer.Write([]byte(files[name])); err != nil {
+			t.Fatalf("zip Write(%q) error = %v", name, err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("zip Close() error = %v", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		t.Fatalf("age Close() error = %v", err)
+	}
+
+	return archivePath, []age.Identity{identity}
+}
+
+func TestDecryptStreamingArchive(t *testing.T) {
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+	if err := os.WriteFile("key.txt", []byte(identity.Recipient().String()), 0o600); err != nil {
+		t.Fatalf("WriteFile(key.txt) error = %v", err)
+	}
+	if err := os.WriteFile("identity.txt", []byte("# test key\n"+identity.String()+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(identity.txt) error = %v", err)
+	}
+	recipients, err := Encryption{}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	identities, err := ParseIdentityFile("identity.txt")
+	if err != nil {
+		t.Fatalf("ParseIdentityFile() error = %v", err)
+	}
+
+	ezw, err := NewEncryptedZipWriter("acquisition", Options{Recipients: recipients}, nil)
+	if err != nil {
+		t.Fatalf("NewEncryptedZipWriter() error = %v", err)
+	}
+	if err := ezw.CreateFileFromString("getprop.txt", "[ro.build]: [1]"); err != nil {
+		t.Fatalf("CreateFileFromString() error = %v", err)
+	}
+	if err := ezw.CreateFileFromString("logs/data/anr/trace.txt", "trace"); err != nil {
+		t.Fatalf("CreateFileFromString() error = %v", err)
+	}
+	if err := ezw.CreateHashList(); err != nil {
+		t.Fatalf("CreateHashList() error = %v", err)
+	}
+	if err := ezw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	output := filepath.Join(cwd, "acquisition")
+	verification, err := Decrypt(ezw.GetOutputPath(), identities, output)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if !verification.OK() || verification.Verified != 2 {
+		t.Fatalf("verification = %+v, want 2 verified files", verification)
+	}
+
+	content, err := os.ReadFile(filepath.Join(output, "logs", "data", "anr", "trace.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(content) != "trace" {
+		t.Fatalf("content = %q, want %q", content, "trace")
+	}
+
+	if _, err := Decrypt(ezw.GetOutputPath(), identities, output); err == nil {
+		t.Fatal("Decrypt() to an existing folder succeeded, want error")
+	}
+}
+
+func TestDecryptReportsDifferences(t *testing.T) {
+	// Hashed at the end of a traditional acquisition, with the paths on
+	// the acquisition computer.
+	hashes := strings.Join([]string{
+		"/cases/uuid/getprop.txt," + sha256Hex("props"),
+		"/cases/uuid/packages.json," + sha256Hex("original"),
+		"/cases/uuid/processes.txt," + sha256Hex("ps"),
+		"/cases/uuid/hashes.csv," + sha256Hex(""),
+	}, "\n") + "\n"
+	archive, identity := writeTestArchive(t, map[string]string{
+		"acquisition.json": `{"storage_path": "/cases/uuid", "streaming_mode": false}`,
+		"command.log":      "log",
+		"hashes.csv":       hashes,
+		"getprop.txt":      "props",
+		"packages.json":    "tampered",
+		"settings.txt":     "added",
+	})
+
+	verification, err := Decrypt(archive, identity, filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if verification.OK() {
+		t.Fatal("OK() = true, want false")
+	}
+	if verification.Verified != 1 {
+		t.Errorf("Verified = %d, want 1", verification.Verified)
+	}
+	if !slices.Equal(verification.Missing, []string{"processes.txt"}) {
+		t.Errorf("Missing = %v, want [processes.txt]", verification.Missing)
+	}
+	if !slices.Equal(verification.Extra, []string{"settings.txt"}) {
+		t.Errorf("Extra = %v, want [settings.txt]", verification.Extra)
+	}
+	if !slices.Equal(verification.Mismatched, []string{"packages.json"}) {
+		t.Errorf("Mismatched = %v, want [packages.json]", verification.Mismatched)
+	}
+}
+
+func TestDecryptRejectsUnsafeNames(t *testing.T) {
+	archive, identity := writeTestArchive(t, map[string]string{
+		"hashes.csv":    "",
+		"../escape.txt": "escape",
+	})
+
+	output := filepath.Join(t.TempDir(), "out")
+	if _, err := Decrypt(archive, identity, output); err == nil {
+		t.Fatal("Decrypt() succeeded, want error")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("output folder was created, Stat() error = %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import "time"
+
+// States of the IMEI in DeviceInfo.
+const (
+	IMEIAvailable   = "available"
+	IMEIDenied      = "denied"
+	IMEIUnavailable = "unavailable"
+)
+
+// DeviceInfo is the identity and security state of the device, collected by
+// the device_info module. Values the device does not report are empty.
+type DeviceInfo struct {
+	Manufacturer   string `json:"manufacturer"`
+	Brand          string `json:"brand"`
+	Model          string `json:"model"`
+	Device         string `json:"device"`
+	Serial         string `json:"serial"`
+	ABI            string `json:"abi"`
+	Fingerprint    string `json:"build_fingerprint"`
+	AndroidVersion string `json:"android_version"`
+	SDK            int    `json:"sdk"`
+	SecurityPatch  string `json:"security_patch"`
+	// BootloaderState is "locked" or "unlocked".
+	BootloaderState string `json:"bootloader_state"`
+	// VerifiedBootState is "green", "yellow", "orange" or "red".
+	VerifiedBootState string `json:"verified_boot_state"`
+	// EncryptionState is "encrypted", "unencrypted" or "unsupported", and
+	// EncryptionType "file" or "block".
+	EncryptionState string `json:"encryption_state"`
+	EncryptionType  string `json:"encryption_type"`
+	Timezone        string `json:"timezone"`
+	// UptimeSeconds is how long the device had been running when it was
+	// acquired, since BootTime.
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	BootTime      time.Time `json:"boot_time,omitzero"`
+	// IMEIStatus is IMEIAvailable if the IMEI could be read, IMEIDenied if
+	// the device does not allow it, or IMEIUnavailable.
+	IMEIStatus string `json:"imei_status"`
+	IMEI       string `json:"imei,omitempty"`
+}
+
+// DeviceSummary is the part of DeviceInfo recorded in acquisition.json.
+type DeviceSummary struct {
+	Manufacturer      string `json:"manufacturer"`
+	Model             string `json:"model"`
+	Fingerprint       string `json:"build_fingerprint"`
+	AndroidVersion    string `json:"android_version"`
+	SecurityPatch     string `json:"security_patch"`
+	BootloaderState   string `json:"bootloader_state"`
+	VerifiedBootState string `json:"verified_boot_state"`
+	EncryptionState   string `json:"encryption_state"`
+}
+
+// Summary returns the summary of the device information.
+func (d *DeviceInfo) Summary() *DeviceSummary {
+	return &DeviceSummary{
+		Manufacturer:      d.Manufacturer,
+		Model:             d.Model,
+		Fingerprint:       d.Fingerprint,
+		AndroidVersion:    d.AndroidVersion,
+		SecurityPatch:     d.SecurityPatch,
+		BootloaderState:   d.BootloaderState,
+		VerifiedBootState: d.VerifiedBootState,
+		EncryptionState:   d.EncryptionState,
+	}
+}
+
+// SetDevice records the summary of the device information in
+// acquisition.json. Modules running at the same time save the progress
+// concurrently.
+func (a *Acquisition) SetDevice(summary *DeviceSummary) {
+	a.modulesMu.Lock()
+	defer a.modulesMu.Unlock()
+
+	a.Device = summary
+}
@@ -18,104 +18,119 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	"filippo.io/age"
 	"github.com/mvt-project/androidqf/log"
 )
 
-// EncryptedZipWriter provides streaming encrypted zip functionality
+// EncryptedZipWriter provides streaming encrypted zip functionality. It can be
+// used concurrently, entries are written one at a time.
 type EncryptedZipWriter struct {
-	file       *os.File
-	encWriter  io.WriteCloser
+	// mu is held from the creation of an entry until it is closed.
+	mu         sync.Mutex
+	volumes    *volumeWriter
 	zipWriter  *zip.Writer
 	outputPath string
 	closed     bool
-	hashes     []*zipHash
+	log        *log.Logger
+	// entriesMu guards the hashes, so that the entries can be listed while
+	// one is being written.
+	entriesMu sync.Mutex
+	hashes    []*zipHash
 }
 
 type zipHash struct {
 	name   string
 	hasher hash.Hash
+	size   int64
+}
+
+// ZipEntry is a file written to the encrypted zip.
+type ZipEntry struct {
+	Name   string
+	Size   int64
+	SHA256 string
 }
 
 type hashingWriter struct {
-	writer io.Writer
-	hasher hash.Hash
+	writer  io.Writer
+	zipHash *zipHash
+	mu      *sync.Mutex
 }
 
 func (hw *hashingWriter) Write(p []byte) (int, error) {
 	n, err := hw.writer.Write(p)
 	if n > 0 {
-		_, _ = hw.hasher.Write(p[:n])
+		hw.mu.Lock()
+		_, _ = hw.zipHash.hasher.Write(p[:n])
+		hw.zipHash.size += int64(n)
+		hw.mu.Unlock()
 	}
 	return n, err
 }
 
-// NewEncryptedZipWriter creates a new encrypted zip writer if key.txt exists
-func NewEncryptedZipWriter(uuid string) (*EncryptedZipWriter, error) {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if key file exists
-	keyFilePath, ok, err := findAgeKeyFile()
-	if err != nil {
-		return nil, err
-	}
-	if !ok {
-		return nil, fmt.Errorf("key.txt not found, encrypted streaming not available")
-	}
+// entryWriter writes an entry of the zip and lets the next one be created
+// once closed.
+type entryWriter struct {
+	io.Writer
+	once   sync.Once
+	unlock func()
+}
 
-	log.Info("Found age public key, using encrypted streaming mode.")
+func (ew *entryWriter) Close() error {
+	ew.once.Do(ew.unlock)
+	return nil
+}
 
-	// Read and parse public key
-	publicKey, err := os.ReadFile(keyFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read public key: %v", err)
+// NewEncryptedZipWriter creates a new encrypted zip writer named
+// <name>.zip.age in the output folder of the options, encrypting to their
+// recipients, and logging to logger.
+func NewEncryptedZipWriter(name string, opts Options, logger *log.Logger) (*EncryptedZipWriter, error) {
+	if len(opts.Recipients) == 0 {
+		return nil, fmt.Errorf("no age recipients, encrypted streaming not available")
 	}
-	publicKeyStr := strings.TrimSpace(string(publicKey))
 
-	recipient, err := age.ParseX25519Recipient(publicKeyStr)
+	outputDir, err := opts.outputDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key %q: %v", publicKeyStr, err)
+		return nil, err
 	}
 
-	// Create output file
-	encFileName := fmt.Sprintf("%s.zip.age", uuid)
-	outputPath := filepath.Join(cwd, encFileName)
+	logger.Info("Found age recipients, using encrypted streaming mode.")
 
-	file, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	// Create output file, or its first volume
+	encFileName := fmt.Sprintf("%s.zip.age", name)
+	volumes, err := newVolumeWriter(filepath.Join(outputDir, encFileName), opts.Recipients, opts.VolumeSize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %v", err)
-	}
-
-	// Create encryption writer
-	encWriter, err := age.Encrypt(file, recipient)
-	if err != nil {
-		file.Close()
-		os.Remove(outputPath) // Clean up the created file
-		return nil, fmt.Errorf("failed to create encrypted writer: %v", err)
+		return nil, err
 	}
+	outputPath := volumes.OutputPath()
 
 	// Create zip writer
-	zipWriter := zip.NewWriter(encWriter)
+	zipWriter := zip.NewWriter(volumes)
 
-	log.Infof("Started encrypted streaming to %s", outputPath)
+	logger.Infof("Started encrypted streaming to %s", outputPath)
 
 	return &EncryptedZipWriter{
-		file:       file,
-		encWriter:  encWriter,
+		volumes:    volumes,
 		zipWriter:  zipWriter,
 		outputPath: outputPath,
 		closed:     false,
+		log:        logger,
 	}, nil
 }
 
-// CreateFile creates a new file in the encrypted zip and returns a writer
-func (ezw *EncryptedZipWriter) CreateFile(name string) (io.Writer, error) {
-	return ezw.createFile(name, true)
+// CreateFile creates a new file in the encrypted zip and returns a writer.
+// The writer must be closed once the file is written: until then, creating
+// other files waits.
+func (ezw *EncryptedZipWriter) CreateFile(name string) (io.WriteCloser, error) {
+	ezw.mu.Lock()
+	writer, err := ezw.createFile(name, true)
+	if err != nil {
+		ezw.mu.Unlock()
+		return nil, err
+	}
+	return &entryWriter{Writer: writer, unlock: ezw.mu.Unlock}, nil
 }
 
 func (ezw *EncryptedZipWriter) createFile(name string, trackHash bool) (io.Writer, error) {
@@ -146,14 +161,35 @@ func (ezw *EncryptedZipWriter) createFile(name string, trackHash bool) (io.Write
 		name:   name,
 		hasher: sha256.New(),
 	}
+	ezw.entriesMu.Lock()
 	ezw.hashes = append(ezw.hashes, zipHash)
+	ezw.entriesMu.Unlock()
 
 	return &hashingWriter{
-		writer: writer,
-		hasher: zipHash.hasher,
+		writer:  writer,
+		zipHash: zipHash,
+		mu:      &ezw.entriesMu,
 	}, nil
 }
 
+// Entries returns the files written to the zip so far, in order, with the
+// number of plaintext bytes written to each and their hash. It does not wait
+// for the entry being written.
+func (ezw *EncryptedZipWriter) Entries() []ZipEntry {
+	ezw.entriesMu.Lock()
+	defer ezw.entriesMu.Unlock()
+
+	entries := make([]ZipEntry, len(ezw.hashes))
+	for i, zipHash := range ezw.hashes {
+		entries[i] = ZipEntry{
+			Name:   zipHash.name,
+			Size:   zipHash.size,
+			SHA256: hex.EncodeToString(zipHash.hasher.Sum(nil)),
+		}
+	}
+	return entries
+}
+
 func validateZipEntryName(name string) error {
 	if name == "" {
 		return fmt.Errorf("file name cannot be empty")
@@ -192,6 +228,7 @@ func (ezw *EncryptedZipWriter) CreateFileFromReader(name string, src io.Reader)
 	if err != nil {
 		return fmt.Errorf("failed to create file in zip: %v", err)
 	}
+	defer writer.Close()
 
 	_, err = io.Copy(writer, src)
 	if err != nil {
@@ -204,6 +241,9 @@ func (ezw *EncryptedZipWriter) CreateFileFromReader(name string, src io.Reader)
 // CreateHashList adds hashes.csv to the encrypted zip with SHA-256 hashes of
 // the plaintext zip entries written so far.
 func (ezw *EncryptedZipWriter) CreateHashList() error {
+	ezw.mu.Lock()
+	defer ezw.mu.Unlock()
+
 	if err := ezw.checkClosed(); err != nil {
 		return err
 	}
@@ -223,12 +263,28 @@ func (ezw *EncryptedZipWriter) CreateHashList() error {
 		return fmt.Errorf("failed to create hash list: %v", err)
 	}
 
-	writer, err := ezw.createFile("hashes.csv", false)
+	return ezw.writeUntracked("hashes.csv", buffer.Bytes())
+}
+
+// createUntrackedFile adds a file to the encrypted zip which is not in the
+// hashes of the entries.
+func (ezw *EncryptedZipWriter) createUntrackedFile(name string, content []byte) error {
+	ezw.mu.Lock()
+	defer ezw.mu.Unlock()
+
+	if err := ezw.checkClosed(); err != nil {
+		return err
+	}
+	return ezw.writeUntracked(name, content)
+}
+
+func (ezw *EncryptedZipWriter) writeUntracked(name string, content []byte) error {
+	writer, err := ezw.createFile(name, false)
 	if err != nil {
-		return fmt.Errorf("failed to create hashes.csv in zip: %v", err)
+		return fmt.Errorf("failed to create %s in zip: %v", name, err)
 	}
-	if _, err := writer.Write(buffer.Bytes()); err != nil {
-		return fmt.Errorf("failed to write hashes.csv to zip: %v", err)
+	if _, err := writer.Write(content); err != nil {
+		return fmt.Errorf("failed to write %s to zip: %v", name, err)
 	}
 
 	return nil
@@ -257,6 +313,9 @@ func (ezw *EncryptedZipWriter) CreateFileFromPath(name, filePath string) error {
 
 // Close finalizes and closes the encrypted zip
 func (ezw *EncryptedZipWriter) Close() error {
+	ezw.mu.Lock()
+	defer ezw.mu.Unlock()
+
 	if ezw.closed {
 		return nil
 	}
@@ -269,33 +328,30 @@ func (ezw *EncryptedZipWriter) Close() error {
 		lastErr = fmt.Errorf("failed to close zip writer: %v", err)
 	}
 
-	// Close encryption writer
-	if err := ezw.encWriter.Close(); err != nil {
+	// Close encryption writer and file, or the last volume
+	if err := ezw.volumes.Close(); err != nil {
 		if lastErr == nil {
-			lastErr = fmt.Errorf("failed to close encryption writer: %v", err)
-		}
-	}
-
-	// Close file
-	if err := ezw.file.Close(); err != nil {
-		if lastErr == nil {
-			lastErr = fmt.Errorf("failed to close output file: %v", err)
+			lastErr = err
 		}
 	}
 
 	if lastErr == nil {
-		log.Infof("Encrypted archive created successfully at %s", ezw.outputPath)
+		ezw.log.Infof("Encrypted archive created successfully at %s", ezw.outputPath)
 	}
 	return lastErr
 }
 
-// GetOutputPath returns the path to the encrypted zip file
+// GetOutputPath returns the path to the encrypted zip file, or to the index
+// of its volumes
 func (ezw *EncryptedZipWriter) GetOutputPath() string {
 	return ezw.outputPath
 }
 
 // IsClosed returns whether the writer has been closed
 func (ezw *EncryptedZipWriter) IsClosed() bool {
+	ezw.mu.Lock()
+	defer ezw.mu.Unlock()
+
 	return ezw.closed
 }
 
@@ -6,13 +6,16 @@ import (
 	"crypto/sha256"
 	"encoding/csv"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"filippo.io/age"
+	"github.com/mvt-project/androidqf/log"
 )
 
 func TestCreateHashListTracksPlaintextZipEntries(t *testing.T) {
@@ -35,6 +38,9 @@ func TestCreateHashListTracksPlaintextZipEntries(t *testing.T) {
 	if _, err := writer.Write([]byte("content")); err != nil {
 		t.Fatalf("Write() error = %v", err)
 	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
 
 	if err := ezw.CreateHashList(); err != nil {
 		t.Fatalf("CreateHashList() error = %v", err)
@@ -111,12 +117,43 @@ func writeTestAgeKey(t *testing.T, dir string) {
 	}
 }
 
+func TestEncryptedZipWriterLogsToItsLogger(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+	var messages bytes.Buffer
+	logger := log.WithPrefix("[FAKE0001] ")
+	if _, err := logger.EnableWriterLog(log.DEBUG, &messages); err != nil {
+		t.Fatalf("EnableWriterLog() error = %v", err)
+	}
+
+	opts := Options{Recipients: []age.Recipient{identity.Recipient()}, OutputDir: t.TempDir()}
+	ezw, err := NewEncryptedZipWriter("acquisition", opts, logger)
+	if err != nil {
+		t.Fatalf("NewEncryptedZipWriter() error = %v", err)
+	}
+	if err := ezw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for _, want := range []string{"Started encrypted streaming", "Encrypted archive created successfully"} {
+		if !strings.Contains(messages.String(), want) {
+			t.Errorf("logged %q, want a message containing %q", messages.String(), want)
+		}
+	}
+}
+
 func TestNewEncryptedZipWriterUsesCurrentWorkingDirectory(t *testing.T) {
 	cwd := t.TempDir()
 	t.Chdir(cwd)
 	writeTestAgeKey(t, cwd)
 
-	ezw, err := NewEncryptedZipWriter("test-acquisition")
+	recipients, err := Encryption{}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	ezw, err := NewEncryptedZipWriter("test-acquisition", Options{Recipients: recipients}, nil)
 	if err != nil {
 		t.Fatalf("NewEncryptedZipWriter() error = %v", err)
 	}
@@ -164,3 +201,87 @@ func TestValidateZipEntryName(t *testing.T) {
 		}
 	}
 }
+
+func TestEntriesRecordPlaintextSizes(t *testing.T) {
+	var archive bytes.Buffer
+	acq := &Acquisition{EncryptedWriter: &EncryptedZipWriter{
+		zipWriter: zip.NewWriter(&archive),
+	}}
+
+	if err := acq.EncryptedWriter.CreateFileFromString("before.txt", "before"); err != nil {
+		t.Fatalf("CreateFileFromString() error = %v", err)
+	}
+	snapshot := acq.SnapshotOutput()
+
+	writer, err := acq.EncryptedWriter.CreateFile("logs/stream.bin")
+	if err != nil {
+		t.Fatalf("CreateFile() error = %v", err)
+	}
+	if _, err := writer.Write([]byte("twelve bytes")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// The entries are listed without waiting for the open one.
+	files, size := acq.OutputSince(snapshot, nil)
+	if len(files) != 1 || size != 12 {
+		t.Fatalf("OutputSince() while writing = %v, %d", files, size)
+	}
+	writer.Close()
+
+	files, size = acq.OutputSince(snapshot, nil)
+	if len(files) != 1 || files[0] != "logs/stream.bin" || size != 12 {
+		t.Fatalf("OutputSince() = %v, %d", files, size)
+	}
+}
+
+func TestConcurrentEntries(t *testing.T) {
+	var archive bytes.Buffer
+	ezw := &EncryptedZipWriter{
+		zipWriter: zip.NewWriter(&archive),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("entry%d.txt", i)
+			writer, err := ezw.CreateFile(name)
+			if err != nil {
+				t.Errorf("CreateFile(%q) error = %v", name, err)
+				return
+			}
+			defer writer.Close()
+			for j := 0; j < 100; j++ {
+				fmt.Fprintf(writer, "%s line %d\n", name, j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ezw.zipWriter.Close(); err != nil {
+		t.Fatalf("zip Close() error = %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	if len(reader.File) != 8 {
+		t.Fatalf("archive has %d entries, want 8", len(reader.File))
+	}
+	for _, file := range reader.File {
+		readCloser, err := file.Open()
+		if err != nil {
+			t.Fatalf("Open(%q) error = %v", file.Name, err)
+		}
+		content, err := io.ReadAll(readCloser)
+		readCloser.Close()
+		if err != nil {
+			t.Fatalf("ReadAll(%q) error = %v", file.Name, err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			if !strings.HasPrefix(line, file.Name+" ") {
+				t.Fatalf("entry %s has the line %q of another entry", file.Name, line)
+			}
+		}
+	}
+}
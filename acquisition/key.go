@@ -6,8 +6,15 @@
 package acquisition
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
 )
 
 const keyFileName = "key.txt"
@@ -44,3 +51,141 @@ func findAgeKeyFileInDirs(cwd, executableDir string) (string, bool) {
 
 	return "", false
 }
+
+// Encryption is who the acquisitions are encrypted to, in addition to the
+// recipients in key.txt.
+type Encryption struct {
+	// Recipients are age or SSH public keys.
+	Recipients []string
+	// RecipientsFiles have one age or SSH public key per line.
+	RecipientsFiles []string
+	// Passphrase, if set, is the only way to decrypt the acquisitions.
+	Passphrase string
+}
+
+// Parse returns the age recipients, none if the acquisitions are not to be
+// encrypted.
+func (e Encryption) Parse() ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, value := range e.Recipients {
+		recipient, err := parseRecipient(value)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	files := e.RecipientsFiles
+	keyFilePath, ok, err := findAgeKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		files = append([]string{keyFilePath}, files...)
+	}
+	for _, path := range files {
+		fileRecipients, err := parseRecipientsFile(path)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, fileRecipients...)
+	}
+
+	if e.Passphrase != "" {
+		// age does not allow mixing passphrases with other recipients.
+		if len(recipients) > 0 {
+			return nil, fmt.Errorf("a passphrase cannot be combined with other recipients, including those in %s", keyFileName)
+		}
+		recipient, err := age.NewScryptRecipient(e.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passphrase: %v", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+func parseRecipientsFile(path string) ([]age.Recipient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recipients file: %v", err)
+	}
+	defer file.Close()
+
+	recipients, err := parseRecipients(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse recipients file %s: %v", path, err)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients in %s", path)
+	}
+
+	return recipients, nil
+}
+
+// parseRecipients parses one recipient per line, ignoring empty lines and
+// comments starting with #.
+func parseRecipients(r io.Reader) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		recipient, err := parseRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return recipients, nil
+}
+
+func parseRecipient(value string) (age.Recipient, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, "age1"):
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %q: %v", value, err)
+		}
+		return recipient, nil
+	case strings.HasPrefix(value, "ssh-"):
+		recipient, err := agessh.ParseRecipient(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH public key %q: %v", value, err)
+		}
+		return recipient, nil
+	default:
+		return nil, fmt.Errorf("unknown recipient %q, expected an age or SSH public key", value)
+	}
+}
+
+// ParseIdentityFile returns the age identities in an age key file, or the
+// identity of an unencrypted SSH private key.
+func ParseIdentityFile(path string) ([]age.Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %v", err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "-----BEGIN") {
+		identity, err := agessh.ParseIdentity(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH private key: %v", err)
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file: %v", err)
+	}
+	return identities, nil
+}
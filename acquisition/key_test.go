@@ -1,9 +1,14 @@
 package acquisition
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"filippo.io/age"
 )
 
 func TestFindAgeKeyFileInDirsPrefersCurrentWorkingDirectory(t *testing.T) {
@@ -45,3 +50,82 @@ func TestFindAgeKeyFileInDirsFallsBackToExecutableDirectory(t *testing.T) {
 		t.Fatalf("key path = %q, want %q", got, executableKey)
 	}
 }
+
+const testSSHRecipient = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIN5HgAcftQc6I1e/SxX6CXWUB9lQT1GznjSOSAehBVEI test"
+
+func TestEncryptionParseRecipientsFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+
+	if err := os.WriteFile(keyFileName, []byte(identity.Recipient().String()+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(key.txt) error = %v", err)
+	}
+	content := "# analysts\n\n" + testSSHRecipient + "\n  # on call\n"
+	if err := os.WriteFile("recipients.txt", []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile(recipients.txt) error = %v", err)
+	}
+
+	recipients, err := Encryption{
+		Recipients:      []string{other.Recipient().String()},
+		RecipientsFiles: []string{"recipients.txt"},
+	}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(recipients) != 3 {
+		t.Fatalf("got %d recipients, want 3", len(recipients))
+	}
+
+	if err := os.WriteFile("invalid.txt", []byte("age1invalid\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(invalid.txt) error = %v", err)
+	}
+	_, err = Encryption{RecipientsFiles: []string{"invalid.txt"}}.Parse()
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("Parse() error = %v, want an error on line 1", err)
+	}
+}
+
+func TestEncryptionParsePassphrase(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	recipients, err := Encryption{Passphrase: "correct horse"}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var encrypted bytes.Buffer
+	writer, err := age.Encrypt(&encrypted, recipients...)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	writer.Write([]byte("acquisition"))
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	identity, err := age.NewScryptIdentity("correct horse")
+	if err != nil {
+		t.Fatalf("NewScryptIdentity() error = %v", err)
+	}
+	reader, err := age.Decrypt(&encrypted, identity)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	plain, _ := io.ReadAll(reader)
+	if string(plain) != "acquisition" {
+		t.Fatalf("decrypted %q, want %q", plain, "acquisition")
+	}
+
+	_, err = Encryption{Passphrase: "correct horse", Recipients: []string{testSSHRecipient}}.Parse()
+	if err == nil {
+		t.Fatal("Parse() with a passphrase and a recipient succeeded, want error")
+	}
+}
@@ -0,0 +1,280 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/botherder/go-savetime/hashes"
+)
+
+const (
+	manifestFileName  = "manifest.json"
+	signatureFileName = "manifest.sig"
+)
+
+// unsignedFiles are written while or after the manifest is signed, so they
+// are not reported when missing from it.
+var unsignedFiles = []string{"hashes.csv", "command.log", manifestFileName, signatureFileName}
+
+// Manifest lists the files of an acquisition with their hashes. It is signed
+// with the key of the examiner, so that it can be checked who produced the
+// acquisition and that it was not altered since.
+type Manifest struct {
+	UUID             string         `json:"uuid"`
+	Serial           string         `json:"serial"`
+	AndroidQFVersion string         `json:"androidqf_version"`
+	Started          time.Time      `json:"started"`
+	Completed        time.Time      `json:"completed"`
+	Files            []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file of the acquisition, by its path in the acquisition
+// folder or archive.
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// LoadSigningKey reads an ed25519 private key in PKCS #8 PEM format, as
+// generated by `openssl genpkey -algorithm ed25519`.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %v", err)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is not an ed25519 key")
+	}
+	return signingKey, nil
+}
+
+// LoadVerifyingKey reads an ed25519 public key in PKIX PEM format, or the
+// public key of a private key read as with LoadSigningKey.
+func LoadVerifyingKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		signingKey, err := LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return signingKey.Public().(ed25519.PublicKey), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	verifyingKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an ed25519 key")
+	}
+	return verifyingKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+// StoreManifest signs the manifest of the acquisition and stores it next to
+// the files, if a signing key was given. acquisition.json, stored after the
+// hashes are generated, is signed too. In streaming mode, the manifest is
+// stored during Complete().
+func (a *Acquisition) StoreManifest() error {
+	if a.StreamingMode || a.SigningKey == nil {
+		return nil
+	}
+
+	files := slices.Clone(a.fileHashes)
+	infoPath := filepath.Join(a.StoragePath, "acquisition.json")
+	infoStat, err := os.Stat(infoPath)
+	if err != nil {
+		return fmt.Errorf("failed to read acquisition details: %v", err)
+	}
+	infoHash, err := hashes.FileSHA256(infoPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash acquisition details: %v", err)
+	}
+	files = append(files, ManifestFile{Name: "acquisition.json", Size: infoStat.Size(), SHA256: infoHash})
+
+	manifest, signature, err := a.signManifest(files)
+	if err != nil {
+		return err
+	}
+
+	a.Log.Info("Storing the signed manifest of the acquisition...")
+	err = os.WriteFile(filepath.Join(a.StoragePath, manifestFileName), manifest, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(a.StoragePath, signatureFileName), signature, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest signature: %v", err)
+	}
+
+	return nil
+}
+
+// storeStreamingManifest adds the signed manifest of the files written so
+// far to the encrypted zip.
+func (a *Acquisition) storeStreamingManifest() error {
+	var files []ManifestFile
+	for _, entry := range a.EncryptedWriter.Entries() {
+		files = append(files, ManifestFile{Name: entry.Name, Size: entry.Size, SHA256: entry.SHA256})
+	}
+
+	manifest, signature, err := a.signManifest(files)
+	if err != nil {
+		return err
+	}
+
+	err = a.EncryptedWriter.createUntrackedFile(manifestFileName, manifest)
+	if err != nil {
+		return err
+	}
+	return a.EncryptedWriter.createUntrackedFile(signatureFileName, signature)
+}
+
+// signManifest returns the manifest with the given files and its signature.
+func (a *Acquisition) signManifest(files []ManifestFile) ([]byte, []byte, error) {
+	manifest, err := json.MarshalIndent(Manifest{
+		UUID:             a.UUID,
+		Serial:           a.Serial,
+		AndroidQFVersion: a.AndroidQFVersion,
+		Started:          a.Started,
+		Completed:        a.Completed,
+		Files:            files,
+	}, "", " ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to json marshal the manifest: %v", err)
+	}
+
+	signature := ed25519.Sign(a.SigningKey, manifest)
+	return manifest, []byte(base64.StdEncoding.EncodeToString(signature) + "\n"), nil
+}
+
+// VerifyFolder checks the signature of the manifest of the acquisition in
+// the folder, and the files against it.
+func VerifyFolder(path string, key ed25519.PublicKey) (*Manifest, *Verification, error) {
+	return verifyManifest(os.DirFS(path), key)
+}
+
+// VerifyArchive checks the signature of the manifest of the encrypted
+// acquisition, and the files against it, without extracting them.
+func VerifyArchive(archivePath string, identities []age.Identity, key ed25519.PublicKey) (*Manifest, *Verification, error) {
+	archive, err := openArchive(archivePath, identities)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer archive.Close()
+
+	return verifyManifest(archive.reader, key)
+}
+
+func verifyManifest(fsys fs.FS, key ed25519.PublicKey) (*Manifest, *Verification, error) {
+	data, err := fs.ReadFile(fsys, manifestFileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	encoded, err := fs.ReadFile(fsys, signatureFileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest signature: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode manifest signature: %v", err)
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return nil, nil, fmt.Errorf("the manifest signature is not valid for this key")
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	verification := &Verification{}
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, file := range manifest.Files {
+		listed[file.Name] = true
+		sum, err := hashFile(fsys, file.Name)
+		switch {
+		case err != nil:
+			verification.Missing = append(verification.Missing, file.Name)
+		case !strings.EqualFold(sum, file.SHA256):
+			verification.Mismatched = append(verification.Mismatched, file.Name)
+		default:
+			verification.Verified++
+		}
+	}
+
+	err = fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || listed[name] || slices.Contains(unsignedFiles, name) {
+			return nil
+		}
+		verification.Extra = append(verification.Extra, name)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list the acquisition files: %v", err)
+	}
+	sort.Strings(verification.Missing)
+	sort.Strings(verification.Extra)
+	sort.Strings(verification.Mismatched)
+
+	return &manifest, verification, nil
+}
+
+func hashFile(fsys fs.FS, name string) (string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,164 @@
+package acquisition
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// writeTestSigningKey writes a new ed25519 private key in PEM format and
+// returns its path and the key.
+func writeTestSigningKey(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "signing.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(keyPath, data, 0o600); err != nil {
+		t.Fatalf("WriteFile(signing.pem) error = %v", err)
+	}
+	return keyPath, key
+}
+
+func TestManifestFolder(t *testing.T) {
+	keyPath, _ := writeTestSigningKey(t)
+	signingKey, err := LoadSigningKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadSigningKey() error = %v", err)
+	}
+	verifyingKey, err := LoadVerifyingKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadVerifyingKey() error = %v", err)
+	}
+
+	storagePath := t.TempDir()
+	for name, content := range map[string]string{
+		"getprop.txt":             "props",
+		"logs/data/anr/trace.txt": "trace",
+	} {
+		path := filepath.Join(storagePath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile(%s) error = %v", name, err)
+		}
+	}
+
+	acq := &Acquisition{
+		UUID:        "test-acquisition",
+		Serial:      "serial",
+		StoragePath: storagePath,
+		SigningKey:  signingKey,
+	}
+	if err := acq.HashFiles(); err != nil {
+		t.Fatalf("HashFiles() error = %v", err)
+	}
+	if err := acq.StoreInfo(); err != nil {
+		t.Fatalf("StoreInfo() error = %v", err)
+	}
+	if err := acq.StoreManifest(); err != nil {
+		t.Fatalf("StoreManifest() error = %v", err)
+	}
+
+	manifest, verification, err := VerifyFolder(storagePath, verifyingKey)
+	if err != nil {
+		t.Fatalf("VerifyFolder() error = %v", err)
+	}
+	if manifest.UUID != "test-acquisition" || manifest.Serial != "serial" {
+		t.Errorf("manifest = %+v, want the acquisition UUID and serial", manifest)
+	}
+	// getprop.txt, trace.txt and acquisition.json.
+	if !verification.OK() || verification.Verified != 3 {
+		t.Fatalf("verification = %+v, want 3 verified files", verification)
+	}
+
+	// Altered files are reported, acquisition.json included.
+	trace := filepath.Join(storagePath, "logs", "data", "anr", "trace.txt")
+	os.Chmod(trace, 0o644)
+	if err := os.WriteFile(trace, []byte("altered"), 0o644); err != nil {
+		t.Fatalf("WriteFile(trace.txt) error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(storagePath, "added.txt"), []byte("added"), 0o644); err != nil {
+		t.Fatalf("WriteFile(added.txt) error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(storagePath, "acquisition.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatalf("WriteFile(acquisition.json) error = %v", err)
+	}
+	_, verification, err = VerifyFolder(storagePath, verifyingKey)
+	if err != nil {
+		t.Fatalf("VerifyFolder() error = %v", err)
+	}
+	if want := []string{"acquisition.json", "logs/data/anr/trace.txt"}; !slices.Equal(verification.Mismatched, want) {
+		t.Errorf("Mismatched = %v, want %v", verification.Mismatched, want)
+	}
+	if !slices.Equal(verification.Extra, []string{"added.txt"}) {
+		t.Errorf("Extra = %v, want [added.txt]", verification.Extra)
+	}
+
+	// So is an altered manifest, or another key.
+	_, otherKey := writeTestSigningKey(t)
+	if _, _, err := VerifyFolder(storagePath, otherKey.Public().(ed25519.PublicKey)); err == nil {
+		t.Error("VerifyFolder() with another key succeeded, want error")
+	}
+	manifestPath := filepath.Join(storagePath, manifestFileName)
+	data, _ := os.ReadFile(manifestPath)
+	data[len(data)-2] = ' '
+	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
+		t.Fatalf("WriteFile(manifest.json) error = %v", err)
+	}
+	if _, _, err := VerifyFolder(storagePath, verifyingKey); err == nil {
+		t.Error("VerifyFolder() with an altered manifest succeeded, want error")
+	}
+}
+
+func TestManifestArchive(t *testing.T) {
+	t.Chdir(t.TempDir())
+	_, signingKey := writeTestSigningKey(t)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+
+	ezw, err := NewEncryptedZipWriter("test-acquisition", Options{Recipients: []age.Recipient{identity.Recipient()}}, nil)
+	if err != nil {
+		t.Fatalf("NewEncryptedZipWriter() error = %v", err)
+	}
+	if err := ezw.CreateFileFromString("getprop.txt", "props"); err != nil {
+		t.Fatalf("CreateFileFromString() error = %v", err)
+	}
+	acq := &Acquisition{
+		UUID:            "test-acquisition",
+		StreamingMode:   true,
+		EncryptedWriter: ezw,
+		SigningKey:      signingKey,
+	}
+	acq.Complete()
+
+	manifest, verification, err := VerifyArchive(ezw.GetOutputPath(), []age.Identity{identity}, signingKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatalf("VerifyArchive() error = %v", err)
+	}
+	// getprop.txt and acquisition.json.
+	if !verification.OK() || verification.Verified != 2 {
+		t.Fatalf("verification = %+v, want 2 verified files", verification)
+	}
+	if !slices.ContainsFunc(manifest.Files, func(file ManifestFile) bool {
+		return file.Name == "getprop.txt" && file.Size == int64(len("props")) && file.SHA256 == sha256Hex("props")
+	}) {
+		t.Errorf("manifest files = %+v, want getprop.txt", manifest.Files)
+	}
+}
@@ -0,0 +1,92 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// Case describes the investigation an acquisition is part of.
+type Case struct {
+	ID       string `json:"id,omitempty"`
+	Examiner string `json:"examiner,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+}
+
+// update replaces the values of the case with the ones set in other.
+func (c *Case) update(other Case) {
+	for _, field := range []struct {
+		value string
+		dest  *string
+	}{
+		{other.ID, &c.ID},
+		{other.Examiner, &c.Examiner},
+		{other.Notes, &c.Notes},
+	} {
+		if field.value != "" {
+			*field.dest = field.value
+		}
+	}
+}
+
+// Host describes the computer which ran the acquisition, the last one if it
+// was resumed.
+type Host struct {
+	OS               string `json:"os"`
+	Arch             string `json:"arch"`
+	Hostname         string `json:"hostname"`
+	Executable       string `json:"executable"`
+	ExecutableSHA256 string `json:"executable_sha256"`
+	ADBVersion       string `json:"adb_version"`
+}
+
+// getHost records the details of the computer, those which cannot be found
+// are left empty.
+func (a *Acquisition) getHost() {
+	a.Host = Host{OS: runtime.GOOS, Arch: runtime.GOARCH}
+
+	var err error
+	a.Host.Hostname, err = os.Hostname()
+	if err != nil {
+		a.Log.Debugf("Failed to get the hostname: %v", err)
+	}
+
+	a.Host.Executable, err = os.Executable()
+	if err != nil {
+		a.Log.Debugf("Failed to find the androidqf executable: %v", err)
+	} else {
+		a.Host.ExecutableSHA256, err = hashLocalFile(a.Host.Executable)
+		if err != nil {
+			a.Log.Debugf("Failed to hash the androidqf executable: %v", err)
+		}
+	}
+
+	if a.Client != nil {
+		a.Host.ADBVersion, err = a.Client.Version()
+		if err != nil {
+			a.Log.Debugf("Failed to get the adb version: %v", err)
+		}
+	}
+}
+
+func hashLocalFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,105 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultNameTemplate names acquisitions after their UUID.
+const DefaultNameTemplate = "{uuid}"
+
+var (
+	namePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+	// unsafeNameChars are replaced in the values put in names, such as
+	// "192.168.1.10:5555" for devices connected over the network.
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// namePlaceholders are the values which can be used in name templates.
+var namePlaceholders = map[string]func(a *Acquisition) string{
+	"uuid":   func(a *Acquisition) string { return a.UUID },
+	"serial": func(a *Acquisition) string { return a.Serial },
+	"model":  func(a *Acquisition) string { return a.model() },
+	"date":   func(a *Acquisition) string { return a.Started.Format("20060102") },
+	"time":   func(a *Acquisition) string { return a.Started.Format("150405") },
+	"case":   func(a *Acquisition) string { return a.Case.ID },
+}
+
+// CheckNameTemplate returns an error if the template has unknown
+// placeholders, or does not produce a file name.
+func CheckNameTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("the name template is empty")
+	}
+	if strings.ContainsAny(namePlaceholder.ReplaceAllString(template, ""), `/\{}`) {
+		return fmt.Errorf("invalid name template %q, it must be a file name", template)
+	}
+	for _, placeholder := range namePlaceholder.FindAllString(template, -1) {
+		if _, ok := namePlaceholders[strings.Trim(placeholder, "{}")]; !ok {
+			return fmt.Errorf("unknown placeholder %s in name template, expected one of {uuid}, {serial}, {model}, {date}, {time} or {case}", placeholder)
+		}
+	}
+	return nil
+}
+
+// outputName returns the name of the acquisition folder or archive, from
+// the name template. Dates and times are in UTC.
+func (a *Acquisition) outputName() string {
+	template := a.options.NameTemplate
+	if template == "" {
+		template = DefaultNameTemplate
+	}
+
+	name := namePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value := ""
+		if get, ok := namePlaceholders[strings.Trim(placeholder, "{}")]; ok {
+			value = get(a)
+		}
+		if value == "" {
+			value = "unknown"
+		}
+		return unsafeNameChars.ReplaceAllString(value, "_")
+	})
+	if name == "." || name == ".." {
+		return a.UUID
+	}
+	return name
+}
+
+// model returns the model of the device, if it can be found. It is only
+// asked to the device once.
+func (a *Acquisition) model() string {
+	a.deviceModelOnce.Do(func() {
+		if a.Client == nil {
+			return
+		}
+		res, err := a.Client.RunShell("getprop ro.product.model")
+		if err != nil {
+			return
+		}
+		a.deviceModel = strings.TrimSpace(res.Stdout)
+	})
+	return a.deviceModel
+}
+
+// outputDir returns the absolute path of the folder the encrypted archive is
+// written to, creating it if needed.
+func (o Options) outputDir() (string, error) {
+	if o.OutputDir == "" {
+		return os.Getwd()
+	}
+
+	err := os.MkdirAll(o.OutputDir, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create output folder: %v", err)
+	}
+	return filepath.Abs(o.OutputDir)
+}
@@ -0,0 +1,99 @@
+package acquisition
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func TestCheckNameTemplate(t *testing.T) {
+	for _, template := range []string{"{uuid}", "{case}_{serial}_{date}-{time}", "acquisition-{model}"} {
+		if err := CheckNameTemplate(template); err != nil {
+			t.Errorf("CheckNameTemplate(%q) error = %v", template, err)
+		}
+	}
+	for _, template := range []string{"", "{imei}", "cases/{uuid}", "{uuid"} {
+		if err := CheckNameTemplate(template); err == nil {
+			t.Errorf("CheckNameTemplate(%q) succeeded, want error", template)
+		}
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	acq := &Acquisition{
+		UUID:    "5e9f",
+		Serial:  "192.168.1.10:5555",
+		Started: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+		Case:    Case{ID: "CASE/42"},
+		options: Options{
+			NameTemplate: "{case}_{serial}_{model}_{date}-{time}",
+		},
+	}
+	want := "CASE_42_192.168.1.10_5555_unknown_20260304-050607"
+	if got := acq.outputName(); got != want {
+		t.Errorf("outputName() = %q, want %q", got, want)
+	}
+
+	acq.options.NameTemplate = ""
+	if got := acq.outputName(); got != "5e9f" {
+		t.Errorf("outputName() = %q, want the UUID", got)
+	}
+}
+
+func TestEncryptedZipWriterOutputDir(t *testing.T) {
+	t.Chdir(t.TempDir())
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+	opts := Options{
+		Recipients: []age.Recipient{identity.Recipient()},
+		OutputDir:  filepath.Join("evidence", "device"),
+	}
+
+	ezw, err := NewEncryptedZipWriter("acquisition", opts, nil)
+	if err != nil {
+		t.Fatalf("NewEncryptedZipWriter() error = %v", err)
+	}
+	if err := ezw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	wantPath, _ := filepath.Abs(filepath.Join("evidence", "device", "acquisition.zip.age"))
+	if ezw.GetOutputPath() != wantPath {
+		t.Fatalf("output path = %q, want %q", ezw.GetOutputPath(), wantPath)
+	}
+	if _, err := os.Stat(wantPath); err != nil {
+		t.Fatalf("Stat(output) error = %v", err)
+	}
+
+	// An existing archive is not overwritten.
+	if _, err := NewEncryptedZipWriter("acquisition", opts, nil); err == nil {
+		t.Fatal("NewEncryptedZipWriter() over an existing archive succeeded, want error")
+	}
+}
+
+func TestCreateStorageFolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acquisition")
+	if err := createStorageFolder(path, true); err != nil {
+		t.Fatalf("createStorageFolder() error = %v", err)
+	}
+
+	// A generated name is never reused, a folder given explicitly is.
+	if err := createStorageFolder(path, true); err == nil {
+		t.Fatal("createStorageFolder() over an existing folder succeeded, want error")
+	}
+	if err := createStorageFolder(path, false); err != nil {
+		t.Fatalf("createStorageFolder() of an existing folder error = %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := createStorageFolder(file, false); err == nil {
+		t.Fatal("createStorageFolder() over a file succeeded, want error")
+	}
+}
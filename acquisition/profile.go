@@ -0,0 +1,227 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mvt-project/androidqf/adb"
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of the questions asked during an acquisition.
+const (
+	AnswerBackup            = "backup"
+	AnswerAPKs              = "apks"
+	AnswerRemoveTrustedAPKs = "remove_trusted_apks"
+	AnswerIntrusionLogs     = "intrusion_logs"
+	AnswerIntrusionLogsWait = "intrusion_logs_wait"
+)
+
+// Sources of the answers recorded in acquisition.json.
+const (
+	AnswerFromPrompt  = "prompt"
+	AnswerFromProfile = "profile"
+	AnswerFromDefault = "default"
+)
+
+// DefaultIntrusionLogsWait is how long to wait for new intrusion logs to be
+// downloaded on the device when the profile does not say otherwise.
+const DefaultIntrusionLogsWait = 15 * time.Minute
+
+// Profile pre-answers the questions asked during an acquisition, so that it
+// can run unattended. Profiles are written in YAML or JSON.
+type Profile struct {
+	// Batch never reads from stdin: questions the profile does not answer
+	// get a default answer which needs no one at the device and does not
+	// wait: no backup, only the non-system APKs, keeping the trusted ones,
+	// and no intrusion logs.
+	Batch bool `yaml:"batch" json:"batch"`
+	// Backup is one of "sms", "everything" or "none".
+	Backup string `yaml:"backup" json:"backup"`
+	// APKs is one of "all", "non-system" or "none".
+	APKs string `yaml:"apks" json:"apks"`
+	// RemoveTrustedAPKs and IntrusionLogs are "yes" or "no".
+	RemoveTrustedAPKs string `yaml:"remove_trusted_apks" json:"remove_trusted_apks"`
+	IntrusionLogs     string `yaml:"intrusion_logs" json:"intrusion_logs"`
+	// IntrusionLogsWait is how long to wait for new intrusion logs, for
+	// example "5m". Zero only collects the logs already on the device.
+	IntrusionLogsWait string `yaml:"intrusion_logs_wait" json:"intrusion_logs_wait"`
+	// ProcessDetails are the slower details of the processes to collect,
+	// comma-separated: maps, fds, threads and hash. None by default.
+	ProcessDetails string `yaml:"process_details" json:"process_details"`
+	// CaseID, Examiner and Notes describe the investigation, and are
+	// recorded in acquisition.json.
+	CaseID   string `yaml:"case_id" json:"case_id"`
+	Examiner string `yaml:"examiner" json:"examiner"`
+	Notes    string `yaml:"notes" json:"notes"`
+
+	intrusionLogsWait time.Duration
+	processOptions    adb.ProcessOptions
+}
+
+// Answer is the answer given to a question, and where it came from.
+type Answer struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// LoadProfile reads and validates a profile file. Since JSON is a subset of
+// YAML, both formats are parsed the same way.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %v", err)
+	}
+
+	profile := &Profile{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(profile)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse profile %s: %v", path, err)
+	}
+
+	if err := profile.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %v", path, err)
+	}
+	return profile, nil
+}
+
+// Validate checks the values of the profile and normalizes them.
+func (p *Profile) Validate() error {
+	var err error
+	p.Backup, err = normalizeChoice(AnswerBackup, p.Backup, "sms", "everything", "none")
+	if err != nil {
+		return err
+	}
+	p.APKs, err = normalizeChoice(AnswerAPKs, p.APKs, "all", "non-system", "none")
+	if err != nil {
+		return err
+	}
+	p.RemoveTrustedAPKs, err = normalizeYesNo(AnswerRemoveTrustedAPKs, p.RemoveTrustedAPKs)
+	if err != nil {
+		return err
+	}
+	p.IntrusionLogs, err = normalizeYesNo(AnswerIntrusionLogs, p.IntrusionLogs)
+	if err != nil {
+		return err
+	}
+
+	p.intrusionLogsWait = DefaultIntrusionLogsWait
+	if p.IntrusionLogsWait != "" {
+		p.intrusionLogsWait, err = time.ParseDuration(p.IntrusionLogsWait)
+		if err != nil || p.intrusionLogsWait < 0 {
+			return fmt.Errorf("invalid intrusion_logs_wait %q", p.IntrusionLogsWait)
+		}
+	}
+
+	p.processOptions = adb.ProcessOptions{}
+	for _, detail := range strings.Split(p.ProcessDetails, ",") {
+		switch strings.ToLower(strings.TrimSpace(detail)) {
+		case "":
+		case "maps":
+			p.processOptions.Maps = true
+		case "fds":
+			p.processOptions.FileDescriptors = true
+		case "threads":
+			p.processOptions.Threads = true
+		case "hash":
+			p.processOptions.Hash = true
+		default:
+			return fmt.Errorf("invalid process_details %q, expected maps, fds, threads or hash", detail)
+		}
+	}
+
+	return nil
+}
+
+// Answer returns the answer the profile gives to a question, if any.
+func (p *Profile) Answer(key string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+
+	var value string
+	switch key {
+	case AnswerBackup:
+		value = p.Backup
+	case AnswerAPKs:
+		value = p.APKs
+	case AnswerRemoveTrustedAPKs:
+		value = p.RemoveTrustedAPKs
+	case AnswerIntrusionLogs:
+		value = p.IntrusionLogs
+	case AnswerIntrusionLogsWait:
+		value = p.IntrusionLogsWait
+	}
+	return value, value != ""
+}
+
+// Case returns the case described by the profile.
+func (p *Profile) Case() Case {
+	if p == nil {
+		return Case{}
+	}
+	return Case{
+		ID:       strings.TrimSpace(p.CaseID),
+		Examiner: strings.TrimSpace(p.Examiner),
+		Notes:    strings.TrimSpace(p.Notes),
+	}
+}
+
+// IsBatch reports whether the acquisition must never read from stdin.
+func (p *Profile) IsBatch() bool {
+	return p != nil && p.Batch
+}
+
+// ProcessOptions returns the slower details of the processes to collect.
+func (p *Profile) ProcessOptions() adb.ProcessOptions {
+	if p == nil {
+		return adb.ProcessOptions{}
+	}
+	return p.processOptions
+}
+
+// ILWait returns how long to wait for new intrusion logs.
+func (p *Profile) ILWait() time.Duration {
+	if p == nil || p.IntrusionLogsWait == "" {
+		return DefaultIntrusionLogsWait
+	}
+	return p.intrusionLogsWait
+}
+
+func normalizeChoice(key, value string, choices ...string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", nil
+	}
+	for _, choice := range choices {
+		if value == choice {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s %q, expected one of: %s", key, value, strings.Join(choices, ", "))
+}
+
+func normalizeYesNo(key, value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return "", nil
+	case "yes", "y", "true":
+		return "yes", nil
+	case "no", "n", "false":
+		return "no", nil
+	default:
+		return "", fmt.Errorf("invalid %s %q, expected yes or no", key, value)
+	}
+}
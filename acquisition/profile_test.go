@@ -0,0 +1,133 @@
+package acquisition
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mvt-project/androidqf/adb"
+)
+
+func writeProfile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestLoadProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "yaml",
+			file: "profile.yaml",
+			content: `batch: true
+backup: none
+apks: Non-System
+remove_trusted_apks: yes
+intrusion_logs: false
+intrusion_logs_wait: 2m
+case_id: 2026-041
+examiner: " Jane Doe "
+notes: Seized at the border
+`,
+		},
+		{
+			name:    "json",
+			file:    "profile.json",
+			content: `{"batch": true, "backup": "none", "apks": "non-system", "remove_trusted_apks": "yes", "intrusion_logs": false, "intrusion_logs_wait": "2m", "case_id": "2026-041", "examiner": "Jane Doe", "notes": "Seized at the border"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := LoadProfile(writeProfile(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("LoadProfile() error = %v", err)
+			}
+			if !profile.IsBatch() {
+				t.Error("IsBatch() = false")
+			}
+			want := map[string]string{
+				AnswerBackup:            "none",
+				AnswerAPKs:              "non-system",
+				AnswerRemoveTrustedAPKs: "yes",
+				AnswerIntrusionLogs:     "no",
+			}
+			for key, value := range want {
+				if got, ok := profile.Answer(key); !ok || got != value {
+					t.Errorf("Answer(%q) = %q, %v, want %q", key, got, ok, value)
+				}
+			}
+			if profile.ILWait() != 2*time.Minute {
+				t.Errorf("ILWait() = %s, want 2m", profile.ILWait())
+			}
+			if wait, ok := profile.Answer(AnswerIntrusionLogsWait); !ok || wait != "2m" {
+				t.Errorf("Answer(intrusion_logs_wait) = %q, %v, want 2m", wait, ok)
+			}
+			wantCase := Case{ID: "2026-041", Examiner: "Jane Doe", Notes: "Seized at the border"}
+			if profile.Case() != wantCase {
+				t.Errorf("Case() = %+v, want %+v", profile.Case(), wantCase)
+			}
+		})
+	}
+}
+
+func TestLoadProfileRejectsInvalidValues(t *testing.T) {
+	for _, content := range []string{
+		"backup: sometimes\n",
+		"intrusion_logs: maybe\n",
+		"intrusion_logs_wait: soon\n",
+		"process_details: maps,everything\n",
+		"unknown_option: true\n",
+	} {
+		if _, err := LoadProfile(writeProfile(t, "profile.yaml", content)); err == nil {
+			t.Errorf("LoadProfile(%q) error = nil", content)
+		}
+	}
+}
+
+func TestProfileDefaults(t *testing.T) {
+	var profile *Profile
+	if _, ok := profile.Answer(AnswerBackup); ok {
+		t.Error("nil profile answered a question")
+	}
+	if profile.IsBatch() {
+		t.Error("nil profile is in batch mode")
+	}
+	if profile.ILWait() != DefaultIntrusionLogsWait {
+		t.Errorf("ILWait() = %s, want %s", profile.ILWait(), DefaultIntrusionLogsWait)
+	}
+
+	profile, err := LoadProfile(writeProfile(t, "empty.yaml", ""))
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	if _, ok := profile.Answer(AnswerAPKs); ok {
+		t.Error("empty profile answered a question")
+	}
+}
+
+func TestProfileProcessOptions(t *testing.T) {
+	profile, err := LoadProfile(writeProfile(t, "profile.yaml", "process_details: Maps, hash\n"))
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	if got := profile.ProcessOptions(); got != (adb.ProcessOptions{Maps: true, Hash: true}) {
+		t.Errorf("ProcessOptions() = %+v, want maps and hash", got)
+	}
+
+	profile, err = LoadProfile(writeProfile(t, "empty.yaml", ""))
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	if got := profile.ProcessOptions(); got != (adb.ProcessOptions{}) {
+		t.Errorf("ProcessOptions() = %+v, want none by default", got)
+	}
+}
@@ -0,0 +1,187 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Statuses of a module in the acquisition report.
+const (
+	ModuleCompleted   = "completed"
+	ModuleFailed      = "failed"
+	ModuleTimedOut    = "timed_out"
+	ModuleInterrupted = "interrupted"
+	ModuleSkipped     = "skipped"
+)
+
+// NoteNotSelected is the note of the modules left out of the acquisition.
+const NoteNotSelected = "not selected"
+
+// ModuleResult records how a module run went, so that an empty result can
+// be told apart from a failed collection.
+type ModuleResult struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Started   time.Time `json:"started"`
+	Completed time.Time `json:"completed"`
+	// Error is the error of failed, timed out and interrupted modules.
+	Error string `json:"error,omitempty"`
+	// Note explains why a module was skipped.
+	Note string `json:"note,omitempty"`
+	// Files are the output files the module wrote, relative to the
+	// acquisition, and Bytes their total size.
+	Files []string `json:"files"`
+	Bytes int64    `json:"bytes"`
+	// Disconnections counts the times the device was disconnected while
+	// the module ran, after which the module was run again.
+	Disconnections int `json:"disconnections,omitempty"`
+}
+
+// AddModuleResult records the result of a module in acquisition.json,
+// replacing the one of an earlier run of the module.
+func (a *Acquisition) AddModuleResult(result ModuleResult) {
+	a.modulesMu.Lock()
+	defer a.modulesMu.Unlock()
+
+	if result.Files == nil {
+		result.Files = []string{}
+	}
+	for i := range a.Modules {
+		if a.Modules[i].Name == result.Name {
+			a.Modules[i] = result
+			return
+		}
+	}
+	a.Modules = append(a.Modules, result)
+}
+
+// MarkInterrupted records that the acquisition was interrupted during the
+// module with the given name, or the first of them when several modules
+// were running.
+func (a *Acquisition) MarkInterrupted(name string) {
+	a.modulesMu.Lock()
+	defer a.modulesMu.Unlock()
+
+	if !a.Interrupted {
+		a.Interrupted = true
+		a.InterruptedIn = name
+	}
+}
+
+// Result returns the recorded result of the module with the given name.
+func (a *Acquisition) Result(name string) (ModuleResult, bool) {
+	a.modulesMu.Lock()
+	defer a.modulesMu.Unlock()
+
+	for _, result := range a.Modules {
+		if result.Name == name {
+			return result, true
+		}
+	}
+	return ModuleResult{}, false
+}
+
+// Pending returns whether a resumed acquisition still has to run the module,
+// that is whether it neither completed nor was left out on purpose.
+func (a *Acquisition) Pending(name string) bool {
+	result, ok := a.Result(name)
+	if !ok {
+		return true
+	}
+	if result.Status == ModuleSkipped && result.Note == NoteNotSelected {
+		return false
+	}
+	return result.Status != ModuleCompleted
+}
+
+// fileState is what tells whether a file changed between two snapshots.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// OutputSnapshot is the state of the acquisition output at some point in
+// time, to find the files written afterwards.
+type OutputSnapshot struct {
+	files   map[string]fileState
+	entries int
+}
+
+// Files maintained by the acquisition itself rather than by modules.
+var snapshotIgnored = map[string]bool{
+	"command.log":      true,
+	"acquisition.json": true,
+	"hashes.csv":       true,
+	manifestFileName:   true,
+	signatureFileName:  true,
+}
+
+// SnapshotOutput records the files written so far, in the acquisition
+// folder or in the encrypted archive.
+func (a *Acquisition) SnapshotOutput() *OutputSnapshot {
+	snapshot := &OutputSnapshot{files: make(map[string]fileState)}
+
+	if a.StoragePath != "" {
+		_ = filepath.WalkDir(a.StoragePath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(a.StoragePath, path)
+			if err != nil || snapshotIgnored[filepath.ToSlash(rel)] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			snapshot.files[filepath.ToSlash(rel)] = fileState{size: info.Size(), modTime: info.ModTime()}
+			return nil
+		})
+	}
+
+	if a.EncryptedWriter != nil {
+		snapshot.entries = len(a.EncryptedWriter.Entries())
+	}
+
+	return snapshot
+}
+
+// OutputSince returns the files written or modified since the snapshot and
+// their total size. If match is not nil, only the files it matches are
+// returned, to leave out those of other modules running at the same time.
+func (a *Acquisition) OutputSince(before *OutputSnapshot, match func(name string) bool) ([]string, int64) {
+	after := a.SnapshotOutput()
+
+	files := []string{}
+	var total int64
+	for name, state := range after.files {
+		if previous, ok := before.files[name]; ok && previous.size == state.size && previous.modTime.Equal(state.modTime) {
+			continue
+		}
+		if match != nil && !match(name) {
+			continue
+		}
+		files = append(files, name)
+		total += state.size
+	}
+	sort.Strings(files)
+
+	if a.EncryptedWriter != nil {
+		for _, entry := range a.EncryptedWriter.Entries()[before.entries:] {
+			if match != nil && !match(entry.Name) {
+				continue
+			}
+			files = append(files, entry.Name)
+			total += entry.Size
+		}
+	}
+
+	return files, total
+}
@@ -0,0 +1,31 @@
+package acquisition
+
+import "testing"
+
+func TestPending(t *testing.T) {
+	acq := &Acquisition{}
+	acq.AddModuleResult(ModuleResult{Name: "getprop", Status: ModuleCompleted})
+	acq.AddModuleResult(ModuleResult{Name: "dumpsys", Status: ModuleTimedOut})
+	acq.AddModuleResult(ModuleResult{Name: "backup", Status: ModuleSkipped, Note: NoteNotSelected})
+	acq.AddModuleResult(ModuleResult{Name: "logs", Status: ModuleSkipped, Note: "acquisition interrupted"})
+
+	for name, want := range map[string]bool{
+		"getprop": false,
+		"dumpsys": true,
+		"backup":  false,
+		"logs":    true,
+		"files":   true,
+	} {
+		if got := acq.Pending(name); got != want {
+			t.Errorf("Pending(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	acq.AddModuleResult(ModuleResult{Name: "dumpsys", Status: ModuleCompleted})
+	if len(acq.Modules) != 4 {
+		t.Fatalf("recorded %d modules after running one again, want 4", len(acq.Modules))
+	}
+	if acq.Pending("dumpsys") {
+		t.Fatal("Pending() = true for a module completed when resuming")
+	}
+}
@@ -0,0 +1,87 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mvt-project/androidqf/adb"
+	"github.com/mvt-project/androidqf/log"
+	"github.com/mvt-project/androidqf/utils"
+)
+
+// Resume reopens the unencrypted acquisition in the given folder, so that the
+// modules it is missing can be run. The device of the client must be the one
+// the acquisition was started on. Once completed, it is encrypted to the
+// recipients of the options, if any.
+func Resume(client *adb.ADB, path string, opts Options) (*Acquisition, error) {
+	info, err := os.ReadFile(filepath.Join(path, "acquisition.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the acquisition details: %v", err)
+	}
+
+	acq := Acquisition{Client: client, Log: client.Log, options: opts}
+	if acq.Log == nil {
+		acq.Log = log.Get()
+	}
+	err = json.Unmarshal(info, &acq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the acquisition details: %v", err)
+	}
+	if acq.StreamingMode {
+		return nil, fmt.Errorf("encrypted acquisitions cannot be resumed")
+	}
+	if acq.Serial == "" {
+		acq.Log.Warning("The acquisition does not record the serial of its device, make sure the same device is connected.")
+	} else if acq.Serial != client.Serial {
+		return nil, fmt.Errorf("the acquisition was started on device %s, not %s", acq.Serial, client.Serial)
+	}
+
+	acq.StoragePath = path
+	acq.AndroidQFVersion = utils.Version
+	acq.Completed = time.Time{}
+	acq.Interrupted = false
+	acq.InterruptedIn = ""
+	acq.Resumed = append(acq.Resumed, time.Now().UTC())
+	acq.Case.update(opts.Case)
+	acq.getHost()
+
+	// Files were made read only and hashed when the acquisition was
+	// finalized, the hashes and the manifest are generated again at the end.
+	for _, name := range []string{"hashes.csv", manifestFileName, signatureFileName} {
+		err = os.Remove(filepath.Join(path, name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove the previous %s: %v", name, err)
+		}
+	}
+	err = filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chmod(filePath, 0o644)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to make the acquisition files writable: %v", err)
+	}
+
+	err = acq.initDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	closeLog, err := acq.Log.EnableFileLog(log.DEBUG, filepath.Join(path, "command.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable file logging: %v", err)
+	}
+	acq.closeLog = closeLog
+
+	return &acq, nil
+}
@@ -11,97 +11,54 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
-	"filippo.io/age"
-	"github.com/mvt-project/androidqf/log"
+	"github.com/mvt-project/androidqf/utils"
 )
 
-func createZipFile(sourceDir, zipPath string) error {
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
-		return fmt.Errorf("failed to create ZIP file: %v", err)
-	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+// writeZip compresses the content of sourceDir to w.
+func writeZip(sourceDir string, w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
 
 	// Use AddFS to add the entire directory
 	fsys := os.DirFS(sourceDir)
-	err = zipWriter.AddFS(fsys)
+	err := zipWriter.AddFS(fsys)
 	if err != nil {
 		return fmt.Errorf("failed to add directory to ZIP: %v", err)
 	}
 
-	return nil
+	return zipWriter.Close()
 }
 
+// StoreSecurely encrypts the acquisition folder to the recipients, and
+// deletes it. The folder is compressed directly into the encrypted archive,
+// so that no unencrypted copy of it is written.
 func (a *Acquisition) StoreSecurely() error {
 	// In streaming mode, data is already encrypted during collection
 	if a.StreamingMode {
 		return nil
 	}
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-
-	keyFilePath, ok, err := findAgeKeyFile()
-	if err != nil {
-		return err
-	}
-	if !ok {
+	if len(a.options.Recipients) == 0 {
 		return nil
 	}
 
-	log.Info("You provided an age public key, storing the acquisition securely.")
-
-	zipFileName := fmt.Sprintf("%s.zip", a.UUID)
-	zipFilePath := filepath.Join(cwd, zipFileName)
-
-	log.Info("Compressing the acquisition folder. This might take a while...")
-
-	err = createZipFile(a.StoragePath, zipFilePath)
+	outputDir, err := a.options.outputDir()
 	if err != nil {
 		return err
 	}
 
-	log.Info("Encrypting the compressed archive. This might take a while...")
+	a.Log.Info("You provided age recipients, storing the acquisition securely.")
+	a.Log.Info("Compressing and encrypting the acquisition folder. This might take a while...")
 
-	publicKey, err := os.ReadFile(keyFilePath)
-	if err != nil {
-		return err
-	}
-	publicKeyStr := strings.TrimSpace(string(publicKey))
-
-	recipient, err := age.ParseX25519Recipient(publicKeyStr)
-	if err != nil {
-		return fmt.Errorf("failed to parse public key %q: %v", publicKeyStr, err)
-	}
-
-	zipFile, err := os.Open(zipFilePath)
-	if err != nil {
-		return err
-	}
-	defer zipFile.Close()
-
-	encFileName := fmt.Sprintf("%s.age", zipFileName)
-	encFilePath := filepath.Join(cwd, encFileName)
-	encFile, err := os.OpenFile(encFilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	encFileName := fmt.Sprintf("%s.zip.age", a.outputName())
+	w, err := newVolumeWriter(filepath.Join(outputDir, encFileName), a.options.Recipients, a.options.VolumeSize)
 	if err != nil {
 		return fmt.Errorf("unable to create encrypted file: %v", err)
 	}
-	defer encFile.Close()
-
-	w, err := age.Encrypt(encFile, recipient)
-	if err != nil {
-		return fmt.Errorf("failed to create encrypted file: %v", err)
-	}
 
-	_, err = io.Copy(w, zipFile)
+	err = writeZip(a.StoragePath, w)
 	if err != nil {
+		w.Close()
 		return fmt.Errorf("failed to write to encrypted file: %v", err)
 	}
 
@@ -109,21 +66,15 @@ func (a *Acquisition) StoreSecurely() error {
 		return fmt.Errorf("failed to close encrypted file: %v", err)
 	}
 
-	log.Infof("Acquisition successfully encrypted at %s", encFilePath)
-
-	// TODO: we should securely wipe the files.
-	zipFile.Close()
-	err = os.Remove(zipFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to delete the unencrypted compressed archive: %v", err)
-	}
+	a.Log.Infof("Acquisition successfully encrypted at %s", w.OutputPath())
 
 	// Ensure log file is closed before removing the acquisition directory
 	if a.closeLog != nil {
-		defer a.closeLog()
+		a.closeLog()
+		a.closeLog = nil
 	}
 
-	err = os.RemoveAll(a.StoragePath)
+	err = utils.RemoveAll(a.StoragePath)
 	if err != nil {
 		return fmt.Errorf("failed to delete the original unencrypted acquisition folder: %v", err)
 	}
@@ -7,10 +7,11 @@ package acquisition
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os/exec"
-	"strings"
+
+	"github.com/mvt-project/androidqf/adb"
 )
 
 // StreamingBuffer manages in-memory buffering for direct streaming operations
@@ -66,39 +67,34 @@ func (sb *StreamingBuffer) Reset() {
 
 // StreamingPuller provides utilities for streaming ADB operations
 type StreamingPuller struct {
-	adbPath string
-	serial  string
-	maxMem  int64
+	client *adb.ADB
+	maxMem int64
 }
 
 // NewStreamingPuller creates a new streaming puller
-func NewStreamingPuller(adbPath, serial string, maxMemoryMB int) *StreamingPuller {
+func NewStreamingPuller(client *adb.ADB, maxMemoryMB int) *StreamingPuller {
 	return &StreamingPuller{
-		adbPath: adbPath,
-		serial:  serial,
-		maxMem:  int64(maxMemoryMB) * 1024 * 1024,
+		client: client,
+		maxMem: int64(maxMemoryMB) * 1024 * 1024,
 	}
 }
 
 // PullToBuffer pulls a file from device directly into memory buffer
 func (sp *StreamingPuller) PullToBuffer(remotePath string) (*StreamingBuffer, error) {
+	return sp.PullToBufferContext(context.Background(), remotePath)
+}
+
+// PullToBufferContext is like PullToBuffer but aborts when the context is done
+func (sp *StreamingPuller) PullToBufferContext(ctx context.Context, remotePath string) (*StreamingBuffer, error) {
 	if remotePath == "" {
 		return nil, fmt.Errorf("remote path cannot be empty")
 	}
 
 	buffer := NewStreamingBuffer(int(sp.maxMem / (1024 * 1024)))
 
-	args := []string{"exec-out", "cat", remotePath}
-	if sp.serial != "" {
-		args = append([]string{"-s", sp.serial}, args...)
-	}
-
-	cmd := exec.Command(sp.adbPath, args...)
-	cmd.Stdout = buffer
-
-	err := cmd.Run()
+	err := sp.client.PullToWriterContext(ctx, remotePath, buffer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to pull %q to buffer: %v", remotePath, err)
+		return nil, fmt.Errorf("failed to pull %q to buffer: %w", remotePath, err)
 	}
 
 	return buffer, nil
@@ -106,6 +102,11 @@ func (sp *StreamingPuller) PullToBuffer(remotePath string) (*StreamingBuffer, er
 
 // PullToWriter pulls a file from device and streams it directly to a writer
 func (sp *StreamingPuller) PullToWriter(remotePath string, writer io.Writer) error {
+	return sp.PullToWriterContext(context.Background(), remotePath, writer)
+}
+
+// PullToWriterContext is like PullToWriter but aborts when the context is done
+func (sp *StreamingPuller) PullToWriterContext(ctx context.Context, remotePath string, writer io.Writer) error {
 	if remotePath == "" {
 		return fmt.Errorf("remote path cannot be empty")
 	}
@@ -113,23 +114,15 @@ func (sp *StreamingPuller) PullToWriter(remotePath string, writer io.Writer) err
 		return fmt.Errorf("writer cannot be nil")
 	}
 
-	args := []string{"exec-out", "cat", remotePath}
-	if sp.serial != "" {
-		args = append([]string{"-s", sp.serial}, args...)
-	}
-
-	cmd := exec.Command(sp.adbPath, args...)
-	cmd.Stdout = writer
-
-	err := cmd.Run()
+	err := sp.client.PullToWriterContext(ctx, remotePath, writer)
 	if err != nil {
-		return fmt.Errorf("failed to pull %q to writer: %v", remotePath, err)
+		return fmt.Errorf("failed to pull %q to writer: %w", remotePath, err)
 	}
 
 	return nil
 }
 
-// BackupToBuffer creates a backup directly into memory buffer using exec-out
+// BackupToBuffer creates a backup directly into memory buffer
 func (sp *StreamingPuller) BackupToBuffer(arg string) (*StreamingBuffer, error) {
 	if arg == "" {
 		return nil, fmt.Errorf("backup argument cannot be empty")
@@ -137,15 +130,7 @@ func (sp *StreamingPuller) BackupToBuffer(arg string) (*StreamingBuffer, error)
 
 	buffer := NewStreamingBuffer(int(sp.maxMem / (1024 * 1024)))
 
-	args := []string{"exec-out", "bu", "backup", arg}
-	if sp.serial != "" {
-		args = append([]string{"-s", sp.serial}, args...)
-	}
-
-	cmd := exec.Command(sp.adbPath, args...)
-	cmd.Stdout = buffer
-
-	err := cmd.Run()
+	err := sp.client.BackupToWriter(arg, buffer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create backup %q to buffer: %v", arg, err)
 	}
@@ -153,8 +138,13 @@ func (sp *StreamingPuller) BackupToBuffer(arg string) (*StreamingBuffer, error)
 	return buffer, nil
 }
 
-// BackupToWriter creates a backup and streams it directly to a writer using exec-out
+// BackupToWriter creates a backup and streams it directly to a writer
 func (sp *StreamingPuller) BackupToWriter(arg string, writer io.Writer) error {
+	return sp.BackupToWriterContext(context.Background(), arg, writer)
+}
+
+// BackupToWriterContext is like BackupToWriter but aborts when the context is done
+func (sp *StreamingPuller) BackupToWriterContext(ctx context.Context, arg string, writer io.Writer) error {
 	if arg == "" {
 		return fmt.Errorf("backup argument cannot be empty")
 	}
@@ -162,17 +152,9 @@ func (sp *StreamingPuller) BackupToWriter(arg string, writer io.Writer) error {
 		return fmt.Errorf("writer cannot be nil")
 	}
 
-	args := []string{"exec-out", "bu", "backup", "-nocompress", arg}
-	if sp.serial != "" {
-		args = append([]string{"-s", sp.serial}, args...)
-	}
-
-	cmd := exec.Command(sp.adbPath, args...)
-	cmd.Stdout = writer
-
-	err := cmd.Run()
+	err := sp.client.BackupToWriterContext(ctx, arg, writer)
 	if err != nil {
-		return fmt.Errorf("failed to create backup %q to writer: %v", arg, err)
+		return fmt.Errorf("failed to create backup %q to writer: %w", arg, err)
 	}
 
 	return nil
@@ -180,28 +162,11 @@ func (sp *StreamingPuller) BackupToWriter(arg string, writer io.Writer) error {
 
 // BugreportToBuffer creates a bugreport directly into memory buffer using bugreportz
 func (sp *StreamingPuller) BugreportToBuffer() (*StreamingBuffer, error) {
-	filename, err := sp.generateBugreport()
-	if err != nil {
-		return nil, err
-	}
-
-	// Ensure cleanup happens regardless of success/failure
-	defer sp.cleanupDeviceFile(filename)
-
-	// Stream the bugreport file to buffer
 	buffer := NewStreamingBuffer(int(sp.maxMem / (1024 * 1024)))
 
-	streamArgs := []string{"exec-out", "cat", filename}
-	if sp.serial != "" {
-		streamArgs = append([]string{"-s", sp.serial}, streamArgs...)
-	}
-
-	streamCmd := exec.Command(sp.adbPath, streamArgs...)
-	streamCmd.Stdout = buffer
-
-	err = streamCmd.Run()
+	err := sp.client.BugreportToWriter(buffer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stream bugreport file: %v", err)
+		return nil, err
 	}
 
 	return buffer, nil
@@ -209,69 +174,14 @@ func (sp *StreamingPuller) BugreportToBuffer() (*StreamingBuffer, error) {
 
 // BugreportToWriter creates a bugreport and streams it directly to a writer using bugreportz
 func (sp *StreamingPuller) BugreportToWriter(writer io.Writer) error {
-	if writer == nil {
-		return fmt.Errorf("writer cannot be nil")
-	}
-
-	filename, err := sp.generateBugreport()
-	if err != nil {
-		return err
-	}
-
-	// Ensure cleanup happens regardless of success/failure
-	defer sp.cleanupDeviceFile(filename)
-
-	// Stream the bugreport file to writer
-	streamArgs := []string{"exec-out", "cat", filename}
-	if sp.serial != "" {
-		streamArgs = append([]string{"-s", sp.serial}, streamArgs...)
-	}
-
-	streamCmd := exec.Command(sp.adbPath, streamArgs...)
-	streamCmd.Stdout = writer
-
-	err = streamCmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to stream bugreport file: %v", err)
-	}
-
-	return nil
-}
-
-// generateBugreport generates a bugreport on device and returns the filename
-func (sp *StreamingPuller) generateBugreport() (string, error) {
-	args := []string{"shell", "bugreportz"}
-	if sp.serial != "" {
-		args = append([]string{"-s", sp.serial}, args...)
-	}
-
-	cmd := exec.Command(sp.adbPath, args...)
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to generate bugreport with bugreportz: %v", err)
-	}
-
-	// Parse output to get filename (bugreportz outputs: OK:/data/user_de/0/com.android.shell/files/bugreports/bugreport-xxx.zip)
-	filename := strings.TrimSpace(string(output))
-	if strings.HasPrefix(filename, "OK:") {
-		filename = strings.TrimPrefix(filename, "OK:")
-	} else {
-		return "", fmt.Errorf("bugreportz failed: %s", filename)
-	}
-
-	return filename, nil
+	return sp.BugreportToWriterContext(context.Background(), writer)
 }
 
-// cleanupDeviceFile removes a file from the device
-func (sp *StreamingPuller) cleanupDeviceFile(filename string) {
-	if filename == "" {
-		return
+// BugreportToWriterContext is like BugreportToWriter but aborts when the context is done
+func (sp *StreamingPuller) BugreportToWriterContext(ctx context.Context, writer io.Writer) error {
+	if writer == nil {
+		return fmt.Errorf("writer cannot be nil")
 	}
 
-	cleanupArgs := []string{"shell", "rm", filename}
-	if sp.serial != "" {
-		cleanupArgs = append([]string{"-s", sp.serial}, cleanupArgs...)
-	}
-	cleanupCmd := exec.Command(sp.adbPath, cleanupArgs...)
-	cleanupCmd.Run() // Ignore errors for cleanup
+	return sp.client.BugreportToWriterContext(ctx, writer)
 }
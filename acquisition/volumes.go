@@ -0,0 +1,313 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package acquisition
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	// MinVolumeSize is the smallest volume size, leaving room for the age
+	// header of every volume.
+	MinVolumeSize = 1 << 20
+
+	volumeIndexSuffix = ".volumes.json"
+
+	// age encrypts chunks of ageChunkSize bytes, adding ageChunkOverhead
+	// bytes to each.
+	ageChunkSize     = 64 << 10
+	ageChunkOverhead = 16
+)
+
+// volumeName matches the name of a volume, such as "<uuid>.zip.age.001".
+var volumeName = regexp.MustCompile(`^(.+)\.[0-9]{3,}$`)
+
+// VolumeIndex lists the volumes of an encrypted archive, in order. Every
+// volume is encrypted on its own, and the archive is their decrypted content
+// put back together.
+type VolumeIndex struct {
+	VolumeSize int64    `json:"volume_size"`
+	Volumes    []Volume `json:"volumes"`
+}
+
+// Volume is a file of an encrypted archive split into volumes.
+type Volume struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ParseSize parses a number of bytes, with an optional K, M or G suffix for
+// KiB, MiB and GiB, and an optional B, for example "3900M" or "100B".
+func ParseSize(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G"} {
+		if trimmed, ok := strings.CutSuffix(number, suffix); ok {
+			number = trimmed
+			multiplier = 1 << (10 * (i + 1))
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	if size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return size * multiplier, nil
+}
+
+// volumeWriter encrypts what is written to it to a single file, or with a
+// maximum size to numbered volumes of at most that size, each encrypted on
+// its own, and to their index.
+type volumeWriter struct {
+	path       string
+	recipients []age.Recipient
+	maxSize    int64
+
+	file    *os.File
+	hasher  hash.Hash
+	written int64
+	enc     io.WriteCloser
+	// left is how many more bytes fit in the current volume.
+	left    int64
+	volumes []Volume
+}
+
+func newVolumeWriter(path string, recipients []age.Recipient, maxSize int64) (*volumeWriter, error) {
+	if maxSize > 0 && maxSize < MinVolumeSize {
+		return nil, fmt.Errorf("volume size must be at least %d bytes", MinVolumeSize)
+	}
+
+	w := &volumeWriter{path: path, recipients: recipients, maxSize: maxSize}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// OutputPath returns the path of the encrypted file, or of the index of the
+// volumes.
+func (w *volumeWriter) OutputPath() string {
+	if w.maxSize == 0 {
+		return w.path
+	}
+	return w.path + volumeIndexSuffix
+}
+
+func (w *volumeWriter) open() error {
+	name := w.path
+	if w.maxSize > 0 {
+		name = fmt.Sprintf("%s.%03d", w.path, len(w.volumes)+1)
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	w.file = file
+	w.hasher = sha256.New()
+	w.written = 0
+
+	enc, err := age.Encrypt(w.fileWriter(), w.recipients...)
+	if err != nil {
+		file.Close()
+		os.Remove(name)
+		return fmt.Errorf("failed to create encrypted writer: %v", err)
+	}
+	w.enc = enc
+
+	if w.maxSize > 0 {
+		// The header is written already, every chunk adds its overhead.
+		space := w.maxSize - w.written
+		chunks := space / (ageChunkSize + ageChunkOverhead)
+		w.left = chunks*ageChunkSize + max(0, space%(ageChunkSize+ageChunkOverhead)-ageChunkOverhead)
+		if w.left <= 0 {
+			w.close()
+			return fmt.Errorf("volume size too small for the encryption header")
+		}
+	}
+
+	return nil
+}
+
+func (w *volumeWriter) fileWriter() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		n, err := w.file.Write(p)
+		w.hasher.Write(p[:n])
+		w.written += int64(n)
+		return n, err
+	})
+}
+
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	if w.maxSize == 0 {
+		return w.enc.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if w.left == 0 {
+			if err := w.close(); err != nil {
+				return written, err
+			}
+			if err := w.open(); err != nil {
+				return written, err
+			}
+		}
+
+		n, err := w.enc.Write(p[:min(int64(len(p)), w.left)])
+		written += n
+		w.left -= int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// close finishes the current file.
+func (w *volumeWriter) close() error {
+	if err := w.enc.Close(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to close encryption writer: %v", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close output file: %v", err)
+	}
+
+	w.volumes = append(w.volumes, Volume{
+		Name:   filepath.Base(w.file.Name()),
+		Size:   w.written,
+		SHA256: hex.EncodeToString(w.hasher.Sum(nil)),
+	})
+	return nil
+}
+
+// Close finishes the last file, and writes the index of the volumes.
+func (w *volumeWriter) Close() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+	if w.maxSize == 0 {
+		return nil
+	}
+
+	index, err := json.MarshalIndent(VolumeIndex{VolumeSize: w.maxSize, Volumes: w.volumes}, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to json marshal the volume index: %v", err)
+	}
+	if err := os.WriteFile(w.OutputPath(), index, 0o600); err != nil {
+		return fmt.Errorf("failed to write the volume index: %v", err)
+	}
+	return nil
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// readVolumes decrypts the archive at path, or the volumes listed in the
+// index at path, or the volumes of the volume at path, to dst. A file is only
+// taken for a volume when the index of its archive is next to it.
+func readVolumes(path string, identities []age.Identity, dst io.Writer) error {
+	indexPath := path
+	if !strings.HasSuffix(path, volumeIndexSuffix) {
+		match := volumeName.FindStringSubmatch(path)
+		if match == nil {
+			return decryptFile(path, identities, dst)
+		}
+		indexPath = match[1] + volumeIndexSuffix
+		if _, err := os.Stat(indexPath); err != nil {
+			return decryptFile(path, identities, dst)
+		}
+	}
+
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the volume index: %v", err)
+	}
+	var index VolumeIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("failed to parse the volume index: %v", err)
+	}
+	if len(index.Volumes) == 0 {
+		return fmt.Errorf("the volume index lists no volumes")
+	}
+
+	dir := filepath.Dir(indexPath)
+	for i, volume := range index.Volumes {
+		if volume.Name != filepath.Base(volume.Name) {
+			return fmt.Errorf("invalid volume name %q in the volume index", volume.Name)
+		}
+		volumePath := filepath.Join(dir, volume.Name)
+		if err := checkVolume(volumePath, volume); err != nil {
+			return fmt.Errorf("volume %d of %d: %v", i+1, len(index.Volumes), err)
+		}
+		if err := decryptFile(volumePath, identities, dst); err != nil {
+			return fmt.Errorf("volume %d of %d: %v", i+1, len(index.Volumes), err)
+		}
+	}
+
+	return nil
+}
+
+// checkVolume checks that the volume file is the one in the index, before
+// decrypting it.
+func checkVolume(path string, volume Volume) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", volume.Name, err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", volume.Name, err)
+	}
+	if size != volume.Size || !strings.EqualFold(hex.EncodeToString(hasher.Sum(nil)), volume.SHA256) {
+		return fmt.Errorf("%s does not match the volume index, it is incomplete or altered", volume.Name)
+	}
+	return nil
+}
+
+func decryptFile(path string, identities []age.Identity, dst io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := age.Decrypt(file, identities...)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt archive: %v", err)
+	}
+	if _, err := io.Copy(dst, reader); err != nil {
+		return fmt.Errorf("failed to decrypt archive: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package acquisition
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"1048576": 1 << 20,
+		"512K":    512 << 10,
+		"3900M":   3900 << 20,
+		"4g":      4 << 30,
+		"2GB":     2 << 30,
+		"100B":    100,
+	}
+	for value, want := range tests {
+		got, err := ParseSize(value)
+		if err != nil {
+			t.Errorf("ParseSize(%q) error = %v", value, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseSize(%q) = %d, want %d", value, got, want)
+		}
+	}
+
+	for _, value := range []string{"", "M", "B", "-1M", "1T", "1.5G", "9223372036854775807K"} {
+		if _, err := ParseSize(value); err == nil {
+			t.Errorf("ParseSize(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestVolumeWriter(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+
+	data := make([]byte, 3*MinVolumeSize+12345)
+	rand.Read(data)
+
+	path := filepath.Join(dir, "test.zip.age")
+	w, err := newVolumeWriter(path, []age.Recipient{identity.Recipient()}, MinVolumeSize)
+	if err != nil {
+		t.Fatalf("newVolumeWriter() error = %v", err)
+	}
+	// Odd sized writes, to cross the volume boundaries in the middle.
+	for chunk := data; len(chunk) > 0; {
+		n := min(len(chunk), 100000)
+		if _, err := w.Write(chunk[:n]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		chunk = chunk[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	var index VolumeIndex
+	indexData, err := os.ReadFile(w.OutputPath())
+	if err != nil {
+		t.Fatalf("ReadFile(index) error = %v", err)
+	}
+	if err := json.Unmarshal(indexData, &index); err != nil {
+		t.Fatalf("Unmarshal(index) error = %v", err)
+	}
+	if len(index.Volumes) != 4 {
+		t.Fatalf("got %d volumes, want 4", len(index.Volumes))
+	}
+	for i, volume := range index.Volumes {
+		if want := fmt.Sprintf("test.zip.age.%03d", i+1); volume.Name != want {
+			t.Errorf("volume %d name = %q, want %q", i+1, volume.Name, want)
+		}
+		stat, err := os.Stat(filepath.Join(dir, volume.Name))
+		if err != nil {
+			t.Fatalf("Stat(%s) error = %v", volume.Name, err)
+		}
+		if stat.Size() > MinVolumeSize || stat.Size() != volume.Size {
+			t.Errorf("%s is %d bytes, index says %d, limit is %d", volume.Name, stat.Size(), volume.Size, MinVolumeSize)
+		}
+	}
+
+	// From the index or from any volume.
+	for _, start := range []string{w.OutputPath(), path + ".001", path + ".003"} {
+		var plain bytes.Buffer
+		if err := readVolumes(start, []age.Identity{identity}, &plain); err != nil {
+			t.Fatalf("readVolumes(%s) error = %v", start, err)
+		}
+		if !bytes.Equal(plain.Bytes(), data) {
+			t.Fatalf("readVolumes(%s) returned different data", start)
+		}
+	}
+
+	if err := os.Remove(path + ".002"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	err = readVolumes(w.OutputPath(), []age.Identity{identity}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "volume 2 of 4") {
+		t.Fatalf("readVolumes() error = %v, want an error about volume 2", err)
+	}
+}
+
+func TestDecryptVolumes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+
+	ezw, err := NewEncryptedZipWriter("acquisition", Options{
+		Recipients: []age.Recipient{identity.Recipient()},
+		VolumeSize: MinVolumeSize,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewEncryptedZipWriter() error = %v", err)
+	}
+	content := make([]byte, 2*MinVolumeSize)
+	rand.Read(content)
+	if err := ezw.CreateFileFromBytes("backup.ab", content); err != nil {
+		t.Fatalf("CreateFileFromBytes() error = %v", err)
+	}
+	if err := ezw.CreateHashList(); err != nil {
+		t.Fatalf("CreateHashList() error = %v", err)
+	}
+	if err := ezw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !strings.HasSuffix(ezw.GetOutputPath(), ".zip.age.volumes.json") {
+		t.Fatalf("output path = %q, want the volume index", ezw.GetOutputPath())
+	}
+
+	verification, err := Decrypt("acquisition.zip.age.001", []age.Identity{identity}, "acquisition")
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if !verification.OK() || verification.Verified != 1 {
+		t.Fatalf("verification = %+v, want 1 verified file", verification)
+	}
+}
+
+func TestDecryptNumberedArchive(t *testing.T) {
+	t.Chdir(t.TempDir())
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+
+	ezw, err := NewEncryptedZipWriter("acquisition", Options{Recipients: []age.Recipient{identity.Recipient()}}, nil)
+	if err != nil {
+		t.Fatalf("NewEncryptedZipWriter() error = %v", err)
+	}
+	if err := ezw.CreateFileFromString("getprop.txt", "props"); err != nil {
+		t.Fatalf("CreateFileFromString() error = %v", err)
+	}
+	if err := ezw.CreateHashList(); err != nil {
+		t.Fatalf("CreateHashList() error = %v", err)
+	}
+	if err := ezw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Without a volume index next to it, the archive is not a volume.
+	if err := os.Rename(ezw.GetOutputPath(), "case.2024"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	verification, err := Decrypt("case.2024", []age.Identity{identity}, "acquisition")
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if !verification.OK() || verification.Verified != 1 {
+		t.Fatalf("verification = %+v, want 1 verified file", verification)
+	}
+}
@@ -6,21 +6,34 @@
 package adb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	saveSlice "github.com/botherder/go-savetime/slice"
 	"github.com/mvt-project/androidqf/log"
+	"github.com/mvt-project/androidqf/utils"
 )
 
 type ADB struct {
-	ExePath string
-	Serial  string
+	ExePath    string
+	Serial     string
+	ServerAddr string
+	// Log is where the client logs, the default logger if nil.
+	Log *log.Logger `json:"-"`
+
+	featuresMu sync.Mutex
+	features   map[string]bool
 }
 
-var Client *ADB
+// waitForDeviceInterval is how often WaitForDevice checks for the device.
+var waitForDeviceInterval = 5 * time.Second
 
 // New returns a new ADB instance.
 func New() (*ADB, error) {
@@ -35,6 +48,11 @@ func New() (*ADB, error) {
 	log.Debug("Killing existing ADB server if running")
 	adb.KillServer()
 
+	err = adb.StartServer()
+	if err != nil {
+		return nil, err
+	}
+
 	// Confirm that we can call "adb devices" without errors
 	_, err = adb.Devices()
 	if err != nil {
@@ -43,6 +61,30 @@ func New() (*ADB, error) {
 	return &adb, nil
 }
 
+// StartServer launches the adb server through the adb executable. All the
+// other operations talk to the running server directly over its socket.
+func (a *ADB) StartServer() error {
+	a.Log.Debug("Starting adb server")
+	out, err := exec.Command(a.ExePath, "start-server").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to start the adb server: %v: %s", err,
+			strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ForDevice returns a client for the device with the given serial, talking
+// to the same adb server. Clients for different devices can be used
+// concurrently.
+func (a *ADB) ForDevice(serial string, logger *log.Logger) *ADB {
+	return &ADB{
+		ExePath:    a.ExePath,
+		Serial:     serial,
+		ServerAddr: a.ServerAddr,
+		Log:        logger,
+	}
+}
+
 func (a *ADB) SetSerial(serial string) (string, error) {
 	devices, err := a.Devices()
 	if err != nil {
@@ -67,119 +109,353 @@ func (a *ADB) SetSerial(serial string) (string, error) {
 		if len(devices) > 1 {
 			return "", fmt.Errorf("multiple devices connected, please stop AndroidQF and provide a serial number")
 		}
-		a.Serial = ""
+		// Stick to this device, so that another one plugged in after a
+		// disconnection is not acquired in its place.
+		a.Serial = devices[0]
 	}
+	a.resetFeatures()
 	return a.Serial, nil
 }
 
 // List existing devices
 func (a *ADB) Devices() ([]string, error) {
-	var devices []string
-	out, err := exec.Command(a.ExePath, "devices").Output()
+	var serials []string
+	devices, err := a.DeviceStates()
+	for _, device := range devices {
+		serials = append(serials, device.Serial)
+	}
+	return serials, err
+}
+
+// DeviceState is a device known to the adb server, with its state such as
+// "device", "unauthorized" or "offline".
+type DeviceState struct {
+	Serial string
+	State  string
+}
+
+// DeviceStates lists the devices known to the adb server, whatever their
+// state.
+func (a *ADB) DeviceStates() ([]DeviceState, error) {
+	var devices []DeviceState
+	out, err := a.hostQuery(context.Background(), "host:devices")
 	if err != nil {
-		return devices, fmt.Errorf("failed to use the adb executable: %v",
-			err)
+		return devices, fmt.Errorf("failed to list devices: %v", err)
 	}
 
-	lines := strings.Split(string(out), "\n")
-	for _, s := range lines[1:] {
+	for _, s := range strings.Split(out, "\n") {
 		dev := strings.Split(s, "\t")
 		if len(dev) == 2 {
-			devices = append(devices, strings.TrimSpace(dev[0]))
-			log.Debug("Found new device: ", dev[0])
+			devices = append(devices, DeviceState{
+				Serial: strings.TrimSpace(dev[0]),
+				State:  strings.TrimSpace(dev[1]),
+			})
+			a.Log.Debug("Found new device: ", dev[0])
 		}
 	}
 
 	return devices, nil
 }
 
-// Run a command to the given phone using exec
-// Returns string and/or error
+// Connect asks the adb server to connect to a device over the network.
+func (a *ADB) Connect(addr string) (string, error) {
+	out, err := a.hostQuery(context.Background(), "host:connect:"+addr)
+	if err != nil {
+		return "", err
+	}
+	out = strings.TrimSpace(out)
+	if !strings.HasPrefix(out, "connected to") && !strings.HasPrefix(out, "already connected to") {
+		return out, errors.New(out)
+	}
+	return out, nil
+}
+
+// Exec runs an arbitrary command through the adb executable. Device
+// operations should use the dedicated methods, which talk to the adb server
+// directly instead of spawning a new process.
 func (a *ADB) Exec(args ...string) ([]byte, error) {
+	return a.ExecContext(context.Background(), args...)
+}
+
+// ExecContext is like Exec but kills the adb process when the context is
+// done.
+func (a *ADB) ExecContext(ctx context.Context, args ...string) ([]byte, error) {
 	if a.Serial == "" {
-		return exec.Command(a.ExePath, args...).Output()
+		return exec.CommandContext(ctx, a.ExePath, args...).Output()
 	} else {
 		var params []string
 		params = append(params, "-s", a.Serial)
 		params = append(params, args...)
-		return exec.Command(a.ExePath, params...).Output()
+		return exec.CommandContext(ctx, a.ExePath, params...).Output()
 	}
 }
 
-// GetState returns the output of `adb get-state`.
-// It is used to check whether a device is connected. If it is not, adb
-// will exit with status 1.
-func (a *ADB) GetState() (string, error) {
-	log.Debug("Starting get-state")
-	out, err := a.Exec("get-state")
+// Version returns the version of the adb executable, such as
+// "1.0.41 (35.0.2-12147458)".
+func (a *ADB) Version() (string, error) {
+	out, err := exec.Command(a.ExePath, "version").Output()
 	if err != nil {
-		log.Debug("get-state failed")
 		return "", err
 	}
+	return parseVersion(string(out)), nil
+}
 
-	log.Debug("get-state ok")
-	return strings.TrimSpace(string(out)), nil
+// parseVersion returns the version in the output of `adb version`, or the
+// first line of the output if it is not in the expected format.
+func parseVersion(out string) string {
+	lines := strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n")
+	version, ok := strings.CutPrefix(strings.TrimSpace(lines[0]), "Android Debug Bridge version ")
+	if !ok {
+		return strings.TrimSpace(lines[0])
+	}
+	if len(lines) > 1 {
+		if build, ok := strings.CutPrefix(strings.TrimSpace(lines[1]), "Version "); ok {
+			version += " (" + build + ")"
+		}
+	}
+	return version
 }
 
-// Shell executes a shell command through adb.
-func (a *ADB) Shell(cmd ...string) (string, error) {
-	fullCmd := append([]string{"shell"}, cmd...)
-	out, err := a.Exec(fullCmd...)
+// GetState returns the state of the device as `adb get-state` would.
+// It is used to check whether a device is connected. If it is not, the
+// adb server answers with an error.
+func (a *ADB) GetState() (string, error) {
+	a.Log.Debug("Starting get-state")
+	out, err := a.hostQuery(context.Background(), a.hostDeviceService("get-state"))
 	if err != nil {
-		if out == nil {
-			return "", err
+		a.Log.Debug("get-state failed")
+		return "", err
+	}
+
+	a.Log.Debug("get-state ok")
+	return strings.TrimSpace(out), nil
+}
+
+// Connected returns whether the device is connected and authorized.
+func (a *ADB) Connected() bool {
+	state, err := a.GetState()
+	return err == nil && state == "device"
+}
+
+// WaitForDevice waits until the device with the given serial, or the only
+// connected device if serial is empty, is connected and authorized, trying
+// again every few seconds. It returns the serial of the device.
+func (a *ADB) WaitForDevice(ctx context.Context, serial string) (string, error) {
+	for {
+		found, err := a.SetSerial(serial)
+		if err != nil {
+			a.Log.Error(fmt.Sprintf("Error trying to connect over ADB: %s", err))
+		} else {
+			_, err = a.GetState()
+			if err == nil {
+				return found, nil
+			}
+			a.Log.Debug(err)
+			a.Log.Error("Unable to get device state. Please make sure it is connected and authorized. Trying again in 5 seconds...")
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(waitForDeviceInterval):
 		}
-		// Still return a value because some commands returns 1 but still works.
-		return strings.TrimSpace(string(out)), err
 	}
+}
+
+// Reconnect waits for the device in use to be connected again. Unlike
+// WaitForDevice it does not change the client, so modules running at the
+// same time can wait for the device together.
+func (a *ADB) Reconnect(ctx context.Context) error {
+	for !a.Connected() {
+		a.Log.Error("Unable to get device state. Please make sure it is connected and authorized. Trying again in 5 seconds...")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitForDeviceInterval):
+		}
+	}
+	// The device can come back with another version of adbd.
+	a.resetFeatures()
+	return nil
+}
+
+// Shell executes a shell command through adb and returns its trimmed
+// stdout. Use RunShell to also get stderr and the exit status.
+func (a *ADB) Shell(cmd ...string) (string, error) {
+	return a.ShellContext(context.Background(), cmd...)
+}
 
-	return strings.TrimSpace(string(out)), nil
+// ShellContext is like Shell but kills the command when the context is done.
+func (a *ADB) ShellContext(ctx context.Context, cmd ...string) (string, error) {
+	res, err := a.RunShellContext(ctx, cmd...)
+	if res == nil {
+		return "", err
+	}
+
+	// Still return the output because some commands exit with a non-zero
+	// status but still print useful results.
+	return strings.TrimSpace(res.Stdout), err
 }
 
-// Pull downloads a file from the device to a local path.
+// Pull downloads a file from the device to a local path. In case of failure
+// the returned string contains the reason reported by the device.
 func (a *ADB) Pull(remotePath, localPath string) (string, error) {
-	out, err := a.Exec("pull", remotePath, localPath)
+	return a.PullContext(context.Background(), remotePath, localPath)
+}
+
+// PullContext is like Pull but aborts the transfer when the context is done.
+func (a *ADB) PullContext(ctx context.Context, remotePath, localPath string) (string, error) {
+	file, err := os.Create(localPath)
 	if err != nil {
-		return string(out), err
+		return err.Error(), err
 	}
 
-	return string(out), nil
+	err = a.PullToWriterContext(ctx, remotePath, file)
+	file.Close()
+	if err != nil {
+		utils.RemoveFile(localPath)
+		return err.Error(), err
+	}
+
+	return "", nil
 }
 
 // Push a file on the phone
 func (a *ADB) Push(localPath, remotePath string) (string, error) {
-	out, err := a.Exec("push", localPath, remotePath)
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err.Error(), err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
 	if err != nil {
-		return string(out), err
+		return err.Error(), err
 	}
 
-	return string(out), nil
+	s, err := a.openSync(context.Background())
+	if err != nil {
+		return err.Error(), err
+	}
+	defer s.Close()
+
+	err = s.send(file, remotePath, stat.Mode(), stat.ModTime())
+	if err != nil {
+		err = fmt.Errorf("failed to push %q: %v", remotePath, err)
+		return err.Error(), err
+	}
+
+	return "", nil
+}
+
+// PushFromReader writes what is read from r to a file on the phone with the
+// given permissions, without storing it on the local disk first.
+func (a *ADB) PushFromReader(r io.Reader, remotePath string, mode os.FileMode) error {
+	s, err := a.openSync(context.Background())
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	err = s.send(r, remotePath, mode, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to push %q: %v", remotePath, err)
+	}
+
+	return nil
+}
+
+// BackupToWriter generates a backup of the specified app or of all, and
+// streams the archive to the writer.
+func (a *ADB) BackupToWriter(arg string, w io.Writer) error {
+	return a.BackupToWriterContext(context.Background(), arg, w)
+}
+
+// BackupToWriterContext is like BackupToWriter but aborts the backup when the
+// context is done.
+func (a *ADB) BackupToWriterContext(ctx context.Context, arg string, w io.Writer) error {
+	_, err := a.deviceStream(ctx, "exec:bu backup -nocompress "+arg, w)
+	return err
 }
 
 // Backup generates a backup of the specified app or of all, writing the
 // archive directly to acquisition dir.
 func (a *ADB) Backup(outPath, arg string) error {
-	args := []string{"backup", "-nocompress", "-f", outPath, arg}
-	if a.Serial != "" {
-		args = append([]string{"-s", a.Serial}, args...)
+	return a.BackupContext(context.Background(), outPath, arg)
+}
+
+// BackupContext is like Backup but aborts the backup when the context is
+// done.
+func (a *ADB) BackupContext(ctx context.Context, outPath, arg string) error {
+	file, err := os.Create(outPath)
+	if err != nil {
+		return err
 	}
-	cmd := exec.Command(a.ExePath, args...)
-	output, err := cmd.CombinedOutput()
+	defer file.Close()
+
+	return a.BackupToWriterContext(ctx, arg, file)
+}
+
+// BugreportToWriter generates a bugreport with bugreportz and streams the
+// resulting zip to the writer.
+func (a *ADB) BugreportToWriter(w io.Writer) error {
+	return a.BugreportToWriterContext(context.Background(), w)
+}
+
+// BugreportToWriterContext is like BugreportToWriter but aborts the
+// generation or the transfer when the context is done.
+func (a *ADB) BugreportToWriterContext(ctx context.Context, w io.Writer) error {
+	filename, err := a.GenerateBugreport(ctx)
+	if err != nil {
+		return err
+	}
+	return a.PullBugreportContext(ctx, filename, w)
+}
+
+// PullBugreportContext streams the bugreport generated at filename on the
+// device to the writer, then deletes it from the device.
+func (a *ADB) PullBugreportContext(ctx context.Context, filename string, w io.Writer) error {
+	// Ensure cleanup happens regardless of success/failure, including when
+	// the context was cancelled.
+	defer a.Shell("rm", filename)
+
+	err := a.PullToWriterContext(ctx, filename, w)
 	if err != nil {
-		return fmt.Errorf("%w: %s", err, string(output))
+		return fmt.Errorf("failed to stream bugreport file: %w", err)
 	}
 	return nil
 }
 
 // Write bugreport directly to acquisition dir.
 func (a *ADB) Bugreport(outPath string) error {
-	args := []string{"bugreport", outPath}
-	if a.Serial != "" {
-		args = append([]string{"-s", a.Serial}, args...)
+	return a.BugreportContext(context.Background(), outPath)
+}
+
+// BugreportContext is like Bugreport but aborts when the context is done.
+func (a *ADB) BugreportContext(ctx context.Context, outPath string) error {
+	file, err := os.Create(outPath)
+	if err != nil {
+		return err
 	}
-	cmd := exec.Command(a.ExePath, args...)
-	err := cmd.Run()
-	return err
+	defer file.Close()
+
+	return a.BugreportToWriterContext(ctx, file)
+}
+
+// GenerateBugreport generates a bugreport on device with bugreportz, which
+// takes minutes, and returns the filename
+func (a *ADB) GenerateBugreport(ctx context.Context) (string, error) {
+	out, err := a.ShellContext(ctx, "bugreportz")
+	if err != nil {
+		return "", fmt.Errorf("failed to generate bugreport with bugreportz: %w", err)
+	}
+
+	// bugreportz outputs: OK:/data/user_de/0/com.android.shell/files/bugreports/bugreport-xxx.zip
+	if !strings.HasPrefix(out, "OK:") {
+		return "", fmt.Errorf("bugreportz failed: %s", out)
+	}
+
+	return strings.TrimPrefix(out, "OK:"), nil
 }
 
 // IL prompts the user to download Intrusion Logs
@@ -199,57 +475,64 @@ func (a *ADB) IL() error {
 
 // check if file exists
 func (a *ADB) FileExists(path string) (bool, error) {
-	out, err := a.Shell("[", "-f", path, "] || echo 1")
+	stat, err := a.Stat(path)
 	if err != nil {
 		return false, err
 	}
-	if out == "1" {
-		return false, nil
-	}
-	return true, nil
+	return stat.IsRegular(), nil
 }
 
 // List files in a folder using ls, returns array of strings.
 func (a *ADB) ListFiles(remotePath string, recursive bool) ([]string, error) {
+	return a.ListFilesContext(context.Background(), remotePath, recursive)
+}
+
+// ListFilesContext is like ListFiles but aborts when the context is done.
+func (a *ADB) ListFilesContext(ctx context.Context, remotePath string, recursive bool) ([]string, error) {
 	var remoteFiles []string
 
 	// Quote remotePath so files with spaces on their name work
-	qPath := fmt.Sprintf("'%s'", remotePath)
+	qPath := Quote(remotePath)
 
 	if recursive {
-		out, _ := a.Shell("find", qPath, "2>", "/dev/null")
-		if out != "" {
-			tmpFiles := strings.Split(out, "\n")
-			for _, file := range tmpFiles {
-				// Remove errors
-				if !strings.HasPrefix(file, "find:") {
-					remoteFiles = append(remoteFiles, file)
-				}
+		// find exits with a non-zero status when some folders cannot be
+		// read, but still lists everything else on stdout.
+		res, err := a.RunShellContext(ctx, "find", qPath)
+		if res == nil {
+			return remoteFiles, err
+		}
+		for _, file := range strings.Split(strings.TrimSpace(res.Stdout), "\n") {
+			if file != "" {
+				remoteFiles = append(remoteFiles, file)
 			}
 		}
 	} else {
-		out, err := a.Shell("ls", remotePath)
+		res, err := a.RunShellContext(ctx, "ls", qPath)
 		if err != nil {
 			return remoteFiles, err
 		}
-		if strings.HasPrefix(out, "ls:") {
-			// Error
-			return remoteFiles, errors.New(out)
+		for _, file := range strings.Split(strings.TrimSpace(res.Stdout), "\n") {
+			if file != "" {
+				remoteFiles = append(remoteFiles, file)
+			}
 		}
-		remoteFiles = strings.Split(out, "\n")
 	}
 
 	return remoteFiles, nil
 }
 
+// KillServer asks the running adb server to exit.
 func (a *ADB) KillServer() (string, error) {
-	log.Debug("Killing adb server")
-	out, err := exec.Command(a.ExePath, "kill-server").Output()
+	a.Log.Debug("Killing adb server")
+	conn, err := a.hostRequest(context.Background(), "host:kill")
 	if err != nil {
-		log.Debug("kill-server failed")
+		a.Log.Debug("kill-server failed")
 		return "", err
 	}
+	// The server closes the connection once it is shutting down.
+	io.Copy(io.Discard, conn)
+	conn.Close()
 
-	log.Debug("kill-server ok")
-	return strings.TrimSpace(string(out)), nil
+	a.Log.Debug("kill-server ok")
+	return "", nil
 }
@@ -12,7 +12,6 @@ import (
 	"path/filepath"
 
 	"github.com/mvt-project/androidqf/assets"
-	"github.com/mvt-project/androidqf/log"
 )
 
 func (a *ADB) findExe() error {
@@ -37,7 +36,7 @@ func (a *ADB) findExe() error {
 		a.ExePath = filepath.Join(filepath.Dir(ex), "adb.exe")
 		_, err = os.Stat(a.ExePath)
 		if err != nil {
-			log.Debugf("ADB doesn't exist at %s", a.ExePath)
+			a.Log.Debugf("ADB doesn't exist at %s", a.ExePath)
 			return errors.New("Impossible to find ADB")
 		}
 	}
@@ -6,14 +6,16 @@
 package adb
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-
-	"github.com/mvt-project/androidqf/log"
+	"sync"
+	"time"
 
 	"github.com/mvt-project/androidqf/assets"
 )
@@ -23,25 +25,42 @@ type Collector struct {
 	Installed    bool
 	Adb          *ADB
 	Architecture string
+
+	// installMu keeps modules running at the same time from installing
+	// the collector twice.
+	installMu sync.Mutex
 }
 
 type FileInfo struct {
-	Path         string `json:"path"`
-	Size         int64  `json:"size"`
-	Mode         string `json:"mode"`
-	UserId       uint32 `json:"user_id"`
-	UserName     string `json:"user_name"`
-	GroupId      uint32 `json:"group_id"`
-	GroupName    string `json:"group_name"`
-	ChangeTime   int64  `json:"changed_time"`
-	ModifiedTime int64  `json:"modified_time"`
-	AccessTime   int64  `json:"access_time"`
-	Error        string `json:"error"`
-	Context      string `json:"context"`
-	SHA1         string `json:"sha1"`
-	SHA256       string `json:"sha256"`
-	SHA512       string `json:"sha512"`
-	MD5          string `json:"md5"`
+	Path string `json:"path"`
+	// Type is one of file, directory, symlink, fifo, socket, char_device,
+	// block_device or other. The collector reports them all, find only
+	// regular files.
+	Type         string            `json:"type"`
+	Size         int64             `json:"size"`
+	Mode         string            `json:"mode"`
+	UserId       uint32            `json:"user_id"`
+	UserName     string            `json:"user_name"`
+	GroupId      uint32            `json:"group_id"`
+	GroupName    string            `json:"group_name"`
+	Inode        uint64            `json:"inode"`
+	Links        uint64            `json:"links"`
+	Device       uint64            `json:"device"`
+	ChangeTime   int64             `json:"changed_time"`
+	ModifiedTime int64             `json:"modified_time"`
+	AccessTime   int64             `json:"access_time"`
+	Error        string            `json:"error"`
+	Context      string            `json:"context"`
+	LinkTarget   string            `json:"link_target,omitempty"`
+	Capabilities []string          `json:"capabilities,omitempty"`
+	Xattrs       map[string]string `json:"xattrs,omitempty"`
+	// Format is elf, dex or apk for such files, when they are hashed.
+	Format   string `json:"format,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	SHA1     string `json:"sha1"`
+	SHA256   string `json:"sha256"`
+	SHA512   string `json:"sha512"`
+	MD5      string `json:"md5"`
 }
 
 type ProcessInfo struct {
@@ -61,6 +80,90 @@ type ProcessInfo struct {
 	CommandLine      []string `json:"command_line"`
 	Environment      []string `json:"env"`
 	WorkingDirectory string   `json:"cwd"`
+	EffectiveUid     uint32   `json:"effective_uid"`
+	Gid              uint32   `json:"gid"`
+	EffectiveGid     uint32   `json:"effective_gid"`
+	// TracerPid is the process tracing this one, if not zero.
+	TracerPid    uint32              `json:"tracer_pid"`
+	Capabilities ProcessCapabilities `json:"capabilities"`
+	// ExeSHA256 is the hash of the executable, even if deleted.
+	ExeSHA256       string           `json:"exe_sha256,omitempty"`
+	Maps            []MappedFile     `json:"maps,omitempty"`
+	FileDescriptors []FileDescriptor `json:"fds,omitempty"`
+	Threads         []Thread         `json:"threads,omitempty"`
+}
+
+type Connection struct {
+	// Protocol is one of tcp, tcp6, udp, udp6 or unix.
+	Protocol      string `json:"protocol"`
+	LocalAddress  string `json:"local_address,omitempty"`
+	LocalPort     uint16 `json:"local_port,omitempty"`
+	RemoteAddress string `json:"remote_address,omitempty"`
+	RemotePort    uint16 `json:"remote_port,omitempty"`
+	State         string `json:"state"`
+	// Type is the one of unix sockets, such as STREAM.
+	Type string `json:"type,omitempty"`
+	// Path is the one of unix sockets, starting with "@" if abstract.
+	Path string `json:"path,omitempty"`
+	// Uid is the owner of inet sockets, -1 for unix sockets.
+	Uid   int64  `json:"uid"`
+	Inode uint64 `json:"inode"`
+	// Pids are the processes with the socket open, only known with the
+	// collector and among the processes it can inspect.
+	Pids []uint32 `json:"pids,omitempty"`
+}
+
+// ProcessCapabilities are the capability sets of a process.
+type ProcessCapabilities struct {
+	Inheritable []string `json:"inheritable,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+// MappedFile is a file mapped in the memory of a process, with the
+// permissions of all its mappings, such as "r-x".
+type MappedFile struct {
+	Path        string `json:"path"`
+	Permissions string `json:"permissions"`
+	Deleted     bool   `json:"deleted"`
+}
+
+type FileDescriptor struct {
+	Fd     uint32 `json:"fd"`
+	Target string `json:"target"`
+}
+
+type Thread struct {
+	Tid  uint32 `json:"tid"`
+	Name string `json:"name"`
+}
+
+// ProcessOptions enable the slower parts of the process listing.
+type ProcessOptions struct {
+	Maps            bool
+	FileDescriptors bool
+	Threads         bool
+	// Hash hashes the executable of each process.
+	Hash bool
+}
+
+// args returns the arguments of `collector ps` for the options.
+func (o ProcessOptions) args() []string {
+	var args []string
+	if o.Maps {
+		args = append(args, "--maps")
+	}
+	if o.FileDescriptors {
+		args = append(args, "--fds")
+	}
+	if o.Threads {
+		args = append(args, "--threads")
+	}
+	if o.Hash {
+		args = append(args, "--hash")
+	}
+	return args
 }
 
 // Returns a new Collector instance.
@@ -84,6 +187,21 @@ func (c *Collector) isInstalled() bool {
 	return out
 }
 
+// ensureInstalled installs the collector unless it is already on the phone.
+func (c *Collector) ensureInstalled() error {
+	c.installMu.Lock()
+	defer c.installMu.Unlock()
+
+	if c.isInstalled() {
+		return nil
+	}
+	err := c.Install()
+	if err != nil {
+		c.Adb.Log.Debugf("Impossible to install collector: %v", err)
+	}
+	return err
+}
+
 // Clean the phone.
 func (c *Collector) Clean() error {
 	_, err := c.Adb.Shell("rm", c.ExePath)
@@ -111,26 +229,15 @@ func (c *Collector) Install() error {
 		return fmt.Errorf("unsupported architecture for collector: %s", c.Architecture)
 	}
 
-	log.Debugf("Deploying collector binary '%s' for architecture '%s'.", collectorName, c.Architecture)
+	c.Adb.Log.Debugf("Deploying collector binary '%s' for architecture '%s'.", collectorName, c.Architecture)
 	collectorBinary, err := assets.ReadCollectorFile(collectorName)
 	if err != nil {
 		// Somehow the file doesn't exist
 		return errors.New("couldn't find the collector binary")
 	}
 
-	collectorTemp, _ := os.CreateTemp("", "collector_")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(collectorTemp.Name())
-
-	// Write collector binary out to temporary path
-	if _, err := collectorTemp.Write(collectorBinary); err != nil {
-		collectorTemp.Close()
-		return err
-	}
-
-	_, err = c.Adb.Push(collectorTemp.Name(), c.ExePath)
+	// Push the binary from memory, nothing is written to the local disk.
+	err = c.Adb.PushFromReader(bytes.NewReader(collectorBinary), c.ExePath, 0o755)
 	if err != nil {
 		return err
 	}
@@ -142,70 +249,133 @@ func (c *Collector) Install() error {
 	return nil
 }
 
+// FindOptions select the files listed by the collector. The zero value lists
+// everything.
+type FindOptions struct {
+	// Exclude are globs of the paths which are neither listed nor walked.
+	Exclude []string
+	// MaxDepth is how many levels below the path are walked, if set. Zero
+	// only lists the path itself.
+	MaxDepth *int
+	// NewerThan and OlderThan bound the modified time, if not zero.
+	NewerThan time.Time
+	OlderThan time.Time
+	// OneFileSystem keeps the folders of other file systems from being
+	// walked.
+	OneFileSystem bool
+	// MinSize and MaxSize bound the size, if not zero.
+	MinSize int64
+	MaxSize int64
+	// Types are the types of the files listed, such as "file" or
+	// "directory", if not empty.
+	Types []string
+}
+
+// args returns the arguments of `collector find` for the options.
+func (o FindOptions) args() []string {
+	var args []string
+	for _, pattern := range o.Exclude {
+		args = append(args, "--exclude", Quote(pattern))
+	}
+	if o.MaxDepth != nil {
+		args = append(args, "--max-depth", strconv.Itoa(*o.MaxDepth))
+	}
+	if !o.NewerThan.IsZero() {
+		args = append(args, "--newer-than", strconv.FormatInt(o.NewerThan.Unix(), 10))
+	}
+	if !o.OlderThan.IsZero() {
+		args = append(args, "--older-than", strconv.FormatInt(o.OlderThan.Unix(), 10))
+	}
+	if o.OneFileSystem {
+		args = append(args, "--one-file-system")
+	}
+	if o.MinSize > 0 {
+		args = append(args, "--min-size", strconv.FormatInt(o.MinSize, 10))
+	}
+	if o.MaxSize > 0 {
+		args = append(args, "--max-size", strconv.FormatInt(o.MaxSize, 10))
+	}
+	if len(o.Types) > 0 {
+		args = append(args, "--type", strings.Join(o.Types, ","))
+	}
+	return args
+}
+
 // List files on the phone at the given path (no hash).
-func (c *Collector) Find(path string) ([]FileInfo, error) {
-	var results []FileInfo
-	var file FileInfo
-	if !c.isInstalled() {
-		err := c.Install()
-		if err != nil {
-			log.Debugf("Impossible to install collector: %v", err)
-			return results, err
-		}
+func (c *Collector) Find(ctx context.Context, path string, opts FindOptions) ([]FileInfo, error) {
+	if err := c.ensureInstalled(); err != nil {
+		return nil, err
 	}
 
-	out, err := c.Adb.Shell(c.ExePath, "find", path)
+	args := append([]string{c.ExePath, "find"}, opts.args()...)
+	out, err := c.Adb.ShellContext(ctx, append(args, Quote(path))...)
 	if err != nil {
-		return results, err
-	}
-	for _, line := range strings.Split(out, "\n") {
-		err = json.Unmarshal([]byte(line), &file)
-		if err == nil {
-			results = append(results, file)
-		}
+		return nil, err
 	}
 
-	return results, nil
+	return parseFindOutput(out), nil
 }
 
 // List files with their hash on the phone at the given path.
-func (c *Collector) FindHash(path string) ([]FileInfo, error) {
-	var results []FileInfo
-	var file FileInfo
-	if !c.isInstalled() {
-		err := c.Install()
-		if err != nil {
-			log.Debugf("Impossible to install collector: %v", err)
-			return results, err
-		}
+func (c *Collector) FindHash(ctx context.Context, path string, opts FindOptions) ([]FileInfo, error) {
+	if err := c.ensureInstalled(); err != nil {
+		return nil, err
 	}
 
-	out, err := c.Adb.Shell(c.ExePath, "find", "-H", path)
+	args := append([]string{c.ExePath, "find", "-H"}, opts.args()...)
+	out, err := c.Adb.ShellContext(ctx, append(args, Quote(path))...)
 	if err != nil {
-		return results, err
+		return nil, err
 	}
+
+	return parseFindOutput(out), nil
+}
+
+// parseFindOutput returns the files in the output of `collector find`, one
+// JSON object per line.
+func parseFindOutput(out string) []FileInfo {
+	var results []FileInfo
 	for _, line := range strings.Split(out, "\n") {
-		err = json.Unmarshal([]byte(line), &file)
+		// A new value for each line, as fields missing from the line would
+		// otherwise keep those of the previous one.
+		var file FileInfo
+		err := json.Unmarshal([]byte(line), &file)
 		if err == nil {
 			results = append(results, file)
 		}
 	}
+	return results
+}
+
+func (c *Collector) Processes(ctx context.Context, opts ProcessOptions) ([]ProcessInfo, error) {
+	var results []ProcessInfo
+
+	if err := c.ensureInstalled(); err != nil {
+		return results, err
+	}
+
+	out, err := c.Adb.ShellContext(ctx, append([]string{c.ExePath, "ps"}, opts.args()...)...)
+	if err != nil {
+		return results, err
+	}
+	err = json.Unmarshal([]byte(out), &results)
+	if err != nil {
+		return results, err
+	}
 
 	return results, nil
 }
 
-func (c *Collector) Processes() ([]ProcessInfo, error) {
-	var results []ProcessInfo
+// Network returns the TCP, UDP and unix sockets of the phone, with the
+// processes using them.
+func (c *Collector) Network(ctx context.Context) ([]Connection, error) {
+	var results []Connection
 
-	if c.isInstalled() {
-		err := c.Install()
-		if err != nil {
-			log.Debugf("Impossible to install collector: %v", err)
-			return results, err
-		}
+	if err := c.ensureInstalled(); err != nil {
+		return results, err
 	}
 
-	out, err := c.Adb.Shell(c.ExePath, "ps")
+	out, err := c.Adb.ShellContext(ctx, c.ExePath, "net")
 	if err != nil {
 		return results, err
 	}
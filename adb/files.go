@@ -6,21 +6,22 @@
 package adb
 
 import (
-	"fmt"
+	"context"
 	"strconv"
 	"strings"
 )
 
-func (a *ADB) FindFullCommand(path string) ([]FileInfo, error) {
+func (a *ADB) FindFullCommand(ctx context.Context, path string) ([]FileInfo, error) {
 	var results []FileInfo
-	out, err := a.Shell("find", fmt.Sprintf("'%s'", path), "-type", "f", "-printf", "'%T@ %m %s %u %g %p\n'", "2>", "/dev/null")
-
-	if err != nil {
+	// Unreadable folders make find exit with a non-zero status, while the
+	// rest of the listing is still valid.
+	res, err := a.RunShellContext(ctx, "find", Quote(path), "-type", "f", "-printf", "'%T@ %m %s %u %g %p\n'")
+	if res == nil {
 		return results, err
 	}
 
-	for _, line := range strings.Split(out, "\n") {
-		var new_file FileInfo
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		new_file := FileInfo{Type: "file"}
 		s := strings.Fields(line)
 		if len(s) == 0 {
 			continue
@@ -44,16 +45,18 @@ func (a *ADB) FindFullCommand(path string) ([]FileInfo, error) {
 	return results, nil
 }
 
-func (a *ADB) FindLimitedCommand(path string) ([]FileInfo, error) {
+func (a *ADB) FindLimitedCommand(ctx context.Context, path string) ([]FileInfo, error) {
 	var results []FileInfo
-	out, err := a.Shell("find", fmt.Sprintf("'%s'", path), "-type", "f", "2>", "/dev/null")
-	if err != nil {
+	res, err := a.RunShellContext(ctx, "find", Quote(path), "-type", "f")
+	if res == nil {
 		return results, err
 	}
 
-	for _, line := range strings.Split(out, "\n") {
-		var new_file FileInfo
-		new_file.Path = line
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		if line == "" {
+			continue
+		}
+		new_file := FileInfo{Type: "file", Path: line}
 		results = append(results, new_file)
 	}
 
@@ -0,0 +1,137 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package adb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// tcpStates are the states of the sockets in /proc/net/tcp and udp.
+	tcpStates = map[int64]string{
+		0x01: "ESTABLISHED",
+		0x02: "SYN_SENT",
+		0x03: "SYN_RECV",
+		0x04: "FIN_WAIT1",
+		0x05: "FIN_WAIT2",
+		0x06: "TIME_WAIT",
+		0x07: "CLOSE",
+		0x08: "CLOSE_WAIT",
+		0x09: "LAST_ACK",
+		0x0A: "LISTEN",
+		0x0B: "CLOSING",
+		0x0C: "NEW_SYN_RECV",
+	}
+	unixTypes = map[int64]string{
+		0x01: "STREAM",
+		0x02: "DGRAM",
+		0x05: "SEQPACKET",
+	}
+	unixStates = map[int64]string{
+		0x01: "UNCONNECTED",
+		0x02: "CONNECTING",
+		0x03: "CONNECTED",
+		0x04: "DISCONNECTING",
+	}
+)
+
+// NetworkCommand returns the sockets of the phone by reading /proc/net from
+// the shell, for when the collector is not available. The processes using
+// the sockets are not known.
+func (a *ADB) NetworkCommand(ctx context.Context) ([]Connection, error) {
+	var results []Connection
+	var errs []string
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6", "unix"} {
+		res, err := a.RunShellContext(ctx, "cat", fmt.Sprintf("/proc/net/%s", protocol))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", protocol, err))
+			continue
+		}
+		results = append(results, parseProcNet(protocol, res.Stdout)...)
+	}
+	if len(errs) == 5 {
+		return results, fmt.Errorf("failed to read /proc/net: %s", strings.Join(errs, ", "))
+	}
+
+	return results, nil
+}
+
+// parseProcNet returns the sockets in /proc/net/tcp, tcp6, udp, udp6 or unix.
+func parseProcNet(protocol, out string) []Connection {
+	var results []Connection
+	lines := strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n")
+	// Skip the header.
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if protocol == "unix" {
+			// Num RefCount Protocol Flags Type St Inode Path
+			if len(fields) < 7 {
+				continue
+			}
+			c := Connection{Protocol: protocol, Uid: -1}
+			socketType, _ := strconv.ParseInt(fields[4], 16, 64)
+			c.Type = unixTypes[socketType]
+			state, _ := strconv.ParseInt(fields[5], 16, 64)
+			c.State = unixStates[state]
+			c.Inode, _ = strconv.ParseUint(fields[6], 10, 64)
+			if len(fields) > 7 {
+				c.Path = strings.Join(fields[7:], " ")
+			}
+			results = append(results, c)
+			continue
+		}
+
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when
+		// retrnsmt uid timeout inode ...
+		if len(fields) < 10 {
+			continue
+		}
+		c := Connection{Protocol: protocol}
+		var err error
+		c.LocalAddress, c.LocalPort, err = parseSocketAddress(fields[1])
+		if err != nil {
+			continue
+		}
+		c.RemoteAddress, c.RemotePort, err = parseSocketAddress(fields[2])
+		if err != nil {
+			continue
+		}
+		state, _ := strconv.ParseInt(fields[3], 16, 64)
+		c.State = tcpStates[state]
+		c.Uid, _ = strconv.ParseInt(fields[7], 10, 64)
+		c.Inode, _ = strconv.ParseUint(fields[9], 10, 64)
+		results = append(results, c)
+	}
+	return results
+}
+
+// parseSocketAddress parses an address of /proc/net/tcp or tcp6, such as
+// "0100007F:0035". The address is in words of four bytes in the byte order
+// of the phone, little endian on all Android devices.
+func parseSocketAddress(value string) (string, uint16, error) {
+	address, port, found := strings.Cut(value, ":")
+	if !found {
+		return "", 0, fmt.Errorf("invalid address %q", value)
+	}
+	ip, err := hex.DecodeString(address)
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address %q", value)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(ip[i:]))
+	}
+	portNumber, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", value)
+	}
+	return net.IP(ip).String(), uint16(portNumber), nil
+}
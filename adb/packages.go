@@ -6,13 +6,13 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
 
 	"github.com/avast/apkverifier"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type PackageFile struct {
@@ -39,10 +39,10 @@ type Package struct {
 	ThirdParty bool          `json:"third_party"`
 }
 
-func (a *ADB) getPackageFiles(packageName string, fast bool) []PackageFile {
-	out, err := a.Shell("pm", "path", packageName)
+func (a *ADB) getPackageFiles(ctx context.Context, packageName string, fast bool) []PackageFile {
+	out, err := a.ShellContext(ctx, "pm", "path", packageName)
 	if err != nil {
-		log.Errorf("Failed to get file paths for package %s: %v: %s", packageName, err, out)
+		a.Log.Errorf("Failed to get file paths for package %s: %v: %s", packageName, err, out)
 		return []PackageFile{}
 	}
 
@@ -60,19 +60,19 @@ func (a *ADB) getPackageFiles(packageName string, fast bool) []PackageFile {
 		if !fast {
 			// Not sure if this is useful or not considering packages may
 			// be downloaded later on
-			md5Out, err := a.Shell("md5sum", packagePath)
+			md5Out, err := a.ShellContext(ctx, "md5sum", packagePath)
 			if err == nil {
 				packageFile.MD5 = strings.SplitN(md5Out, " ", 2)[0]
 			}
-			sha1Out, err := a.Shell("sha1sum", packagePath)
+			sha1Out, err := a.ShellContext(ctx, "sha1sum", packagePath)
 			if err == nil {
 				packageFile.SHA1 = strings.SplitN(sha1Out, " ", 2)[0]
 			}
-			sha256Out, err := a.Shell("sha256sum", packagePath)
+			sha256Out, err := a.ShellContext(ctx, "sha256sum", packagePath)
 			if err == nil {
 				packageFile.SHA256 = strings.SplitN(sha256Out, " ", 2)[0]
 			}
-			sha512Out, err := a.Shell("sha512sum", packagePath)
+			sha512Out, err := a.ShellContext(ctx, "sha512sum", packagePath)
 			if err == nil {
 				packageFile.SHA512 = strings.SplitN(sha512Out, " ", 2)[0]
 			}
@@ -84,16 +84,17 @@ func (a *ADB) getPackageFiles(packageName string, fast bool) []PackageFile {
 	return packageFiles
 }
 
-// GetPackages returns the list of installed package names.
-func (a *ADB) GetPackages(fast bool) ([]Package, error) {
+// GetPackages returns the list of installed package names. It stops early
+// with the context error when the context is done.
+func (a *ADB) GetPackages(ctx context.Context, fast bool) ([]Package, error) {
 	withInstaller := true
-	out, err := a.Shell("pm", "list", "packages", "-U", "-u", "-i")
+	out, err := a.ShellContext(ctx, "pm", "list", "packages", "-U", "-u", "-i")
 	if err != nil {
 		// Some phones do not support -i option
-		out, err = a.Shell("pm", "list", "packages", "-U", "-u")
+		out, err = a.ShellContext(ctx, "pm", "list", "packages", "-U", "-u")
 		if err != nil {
 			// old Samsung throw errors when trying to access installed packages of other users
-			out, err = a.Shell("pm", "list", "packages", "-U", "-u", "-i", "--user 0")
+			out, err = a.ShellContext(ctx, "pm", "list", "packages", "-U", "-u", "-i", "--user 0")
 			if err != nil {
 				return []Package{}, fmt.Errorf("failed to launch `pm list packages` command: %v",
 					err)
@@ -106,6 +107,10 @@ func (a *ADB) GetPackages(fast bool) ([]Package, error) {
 	var installer string
 	var uid int
 	for _, line := range strings.Split(out, "\n") {
+		if ctx.Err() != nil {
+			return packages, ctx.Err()
+		}
+
 		fields := strings.Fields(line)
 		packageName := strings.TrimPrefix(strings.TrimSpace(fields[0]), "package:")
 		if withInstaller {
@@ -127,7 +132,7 @@ func (a *ADB) GetPackages(fast bool) ([]Package, error) {
 			Disabled:   false,
 			System:     false,
 			ThirdParty: false,
-			Files:      a.getPackageFiles(packageName, fast),
+			Files:      a.getPackageFiles(ctx, packageName, fast),
 		}
 
 		packages = append(packages, newPackage)
@@ -139,9 +144,9 @@ func (a *ADB) GetPackages(fast bool) ([]Package, error) {
 		{"field": "ThirdParty", "arg": "-3"},
 	}
 	for _, cmd := range cmds {
-		out, err = a.Shell("pm", "list", "packages", cmd["arg"])
-		if err != nil && out == "" {
-			log.Infof("Failed to get packages filtered by `%s`: %v: %s\n",
+		out, err = a.ShellContext(ctx, "pm", "list", "packages", cmd["arg"])
+		if err != nil {
+			a.Log.Infof("Failed to get packages filtered by `%s`: %v: %s\n",
 				cmd["arg"], err, out)
 			continue
 		}
@@ -0,0 +1,204 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultServerAddr is the address the adb server listens on by default.
+const DefaultServerAddr = "127.0.0.1:5037"
+
+const dialTimeout = 5 * time.Second
+
+// ServerError is returned when the adb server answers a request with FAIL.
+type ServerError struct {
+	Request string
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("adb server refused %q: %s", e.Request, e.Message)
+}
+
+// serverAddr returns the address of the adb server to talk to.
+func (a *ADB) serverAddr() string {
+	if a.ServerAddr != "" {
+		return a.ServerAddr
+	}
+	return DefaultServerAddr
+}
+
+// ctxConn is a connection that gets closed as soon as its context is done,
+// which unblocks any read or write pending on it.
+type ctxConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *ctxConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// dial opens a new connection to the adb server. Every adb service uses its
+// own connection, which is closed once the service is done or the context
+// is cancelled.
+func (a *ADB) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", a.serverAddr())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to connect to adb server at %s: %v", a.serverAddr(), err)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	return &ctxConn{Conn: conn, stop: stop}, nil
+}
+
+// contextError returns the context error if the context is done, as the
+// failure is then a consequence of the connection being closed.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// sendRequest writes a smart-socket request, prefixed by its length as four
+// hexadecimal digits.
+func sendRequest(w io.Writer, request string) error {
+	if len(request) > 0xffff {
+		return fmt.Errorf("adb request too long (%d bytes)", len(request))
+	}
+	_, err := fmt.Fprintf(w, "%04x%s", len(request), request)
+	return err
+}
+
+// readStatus reads the OKAY/FAIL answer to a request.
+func readStatus(r io.Reader, request string) error {
+	status := make([]byte, 4)
+	if _, err := io.ReadFull(r, status); err != nil {
+		return fmt.Errorf("failed to read adb status for %q: %v", request, err)
+	}
+
+	switch string(status) {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		msg, err := readHexString(r)
+		if err != nil {
+			return fmt.Errorf("failed to read adb failure for %q: %v", request, err)
+		}
+		return &ServerError{Request: request, Message: msg}
+	default:
+		return fmt.Errorf("unexpected adb status %q for %q", status, request)
+	}
+}
+
+// readHexString reads a payload prefixed by its length as four hexadecimal
+// digits.
+func readHexString(r io.Reader) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid adb length header %q", header)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// hostRequest sends a host service request and returns the connection once
+// the server acknowledged it.
+func (a *ADB) hostRequest(ctx context.Context, service string) (net.Conn, error) {
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendRequest(conn, service); err != nil {
+		conn.Close()
+		return nil, contextError(ctx, err)
+	}
+	if err := readStatus(conn, service); err != nil {
+		conn.Close()
+		return nil, contextError(ctx, err)
+	}
+	return conn, nil
+}
+
+// hostQuery sends a host service request and returns its length-prefixed
+// answer.
+func (a *ADB) hostQuery(ctx context.Context, service string) (string, error) {
+	conn, err := a.hostRequest(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	out, err := readHexString(conn)
+	return out, contextError(ctx, err)
+}
+
+// hostDeviceService returns the host service name addressing the selected
+// device, for example "host-serial:<serial>:get-state".
+func (a *ADB) hostDeviceService(service string) string {
+	if a.Serial == "" {
+		return "host:" + service
+	}
+	return fmt.Sprintf("host-serial:%s:%s", a.Serial, service)
+}
+
+// deviceRequest switches a new connection to the selected device and opens
+// the given local service on it (for example "shell:ls" or "sync:").
+func (a *ADB) deviceRequest(ctx context.Context, service string) (net.Conn, error) {
+	transport := "host:transport-any"
+	if a.Serial != "" {
+		transport = "host:transport:" + a.Serial
+	}
+
+	conn, err := a.hostRequest(ctx, transport)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendRequest(conn, service); err != nil {
+		conn.Close()
+		return nil, contextError(ctx, err)
+	}
+	if err := readStatus(conn, service); err != nil {
+		conn.Close()
+		return nil, contextError(ctx, err)
+	}
+	return conn, nil
+}
+
+// deviceStream opens a device service and copies everything it outputs to
+// the writer until the device closes the stream.
+func (a *ADB) deviceStream(ctx context.Context, service string, w io.Writer) (int64, error) {
+	conn, err := a.deviceRequest(ctx, service)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	n, err := io.Copy(w, conn)
+	return n, contextError(ctx, err)
+}
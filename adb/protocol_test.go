@@ -0,0 +1,812 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is a minimal adb server speaking the smart-socket protocol
+// with a single emulated device.
+type fakeServer struct {
+	t        *testing.T
+	listener net.Listener
+	serial   string
+
+	mu       sync.Mutex
+	features string
+	shell    map[string]fakeCommand
+	files    map[string][]byte
+	// sizes overrides the sizes of files reported by the sync requests.
+	sizes    map[string]uint64
+	requests []string
+	// unplugged hides the device as if its cable was pulled.
+	unplugged bool
+	// others are more lines listed by host:devices, for devices which can
+	// not be used.
+	others string
+}
+
+type fakeCommand struct {
+	stdout string
+	stderr string
+	exit   byte
+	// hang keeps the command running until the client goes away.
+	hang bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	fs := &fakeServer{
+		t:        t,
+		listener: listener,
+		serial:   "FAKE0001",
+		features: "shell_v2,cmd,stat_v2",
+		shell:    make(map[string]fakeCommand),
+		files:    make(map[string][]byte),
+		sizes:    make(map[string]uint64),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go fs.serve()
+	return fs
+}
+
+func (fs *fakeServer) client() *ADB {
+	return &ADB{ServerAddr: fs.listener.Addr().String(), Serial: fs.serial}
+}
+
+func (fs *fakeServer) serve() {
+	for {
+		conn, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		go fs.handle(conn)
+	}
+}
+
+func (fs *fakeServer) readRequest(conn net.Conn) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return "", err
+	}
+	request := make([]byte, length)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+
+	fs.mu.Lock()
+	fs.requests = append(fs.requests, string(request))
+	fs.mu.Unlock()
+	return string(request), nil
+}
+
+func okay(conn net.Conn, payload string) {
+	fmt.Fprintf(conn, "OKAY%04x%s", len(payload), payload)
+}
+
+func fail(conn net.Conn, msg string) {
+	fmt.Fprintf(conn, "FAIL%04x%s", len(msg), msg)
+}
+
+func (fs *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	request, err := fs.readRequest(conn)
+	if err != nil {
+		return
+	}
+
+	fs.mu.Lock()
+	unplugged, others := fs.unplugged, fs.others
+	fs.mu.Unlock()
+
+	switch {
+	case request == "host:devices" && unplugged:
+		okay(conn, "")
+	case unplugged && request != "host:kill":
+		fail(conn, "device '"+fs.serial+"' not found")
+	case request == "host:devices":
+		okay(conn, fs.serial+"\tdevice\n"+others)
+	case request == "host:kill":
+		conn.Write([]byte("OKAY"))
+	case request == "host-serial:"+fs.serial+":get-state":
+		okay(conn, "device")
+	case request == "host-serial:"+fs.serial+":features":
+		okay(conn, fs.features)
+	case strings.HasPrefix(request, "host-serial:"):
+		fail(conn, "device not found")
+	case request == "host:transport:"+fs.serial:
+		conn.Write([]byte("OKAY"))
+		fs.handleDevice(conn)
+	case strings.HasPrefix(request, "host:transport:"):
+		fail(conn, "device '"+strings.TrimPrefix(request, "host:transport:")+"' not found")
+	default:
+		fail(conn, "unknown host service")
+	}
+}
+
+func (fs *fakeServer) handleDevice(conn net.Conn) {
+	service, err := fs.readRequest(conn)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(service, "shell,v2,raw:"):
+		res := fs.command(strings.TrimPrefix(service, "shell,v2,raw:"))
+		conn.Write([]byte("OKAY"))
+		if res.hang {
+			io.Copy(io.Discard, conn)
+			return
+		}
+		writeShellPacket(conn, shellIDStdout, []byte(res.stdout))
+		writeShellPacket(conn, shellIDStderr, []byte(res.stderr))
+		writeShellPacket(conn, shellIDExit, []byte{res.exit})
+	case strings.HasPrefix(service, "shell:"):
+		cmd, hasMarker := strings.CutSuffix(strings.TrimPrefix(service, "shell:"), "; echo -n \""+exitMarker+"$?\"")
+		res := fs.command(cmd)
+		conn.Write([]byte("OKAY"))
+		conn.Write([]byte(res.stdout + res.stderr))
+		if hasMarker {
+			fmt.Fprintf(conn, "%s%d", exitMarker, res.exit)
+		}
+	case strings.HasPrefix(service, "exec:"):
+		res := fs.command(strings.TrimPrefix(service, "exec:"))
+		conn.Write([]byte("OKAY"))
+		conn.Write([]byte(res.stdout))
+		if res.hang {
+			io.Copy(io.Discard, conn)
+		}
+	case service == "sync:":
+		conn.Write([]byte("OKAY"))
+		fs.handleSync(conn)
+	default:
+		fail(conn, "unknown device service")
+	}
+}
+
+func (fs *fakeServer) handleSync(conn net.Conn) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		id := string(header[:4])
+		length := binary.LittleEndian.Uint32(header[4:])
+		if id == "QUIT" {
+			return
+		}
+
+		arg := make([]byte, length)
+		if _, err := io.ReadFull(conn, arg); err != nil {
+			return
+		}
+		name := string(arg)
+
+		fs.mu.Lock()
+		switch id {
+		case "STAT":
+			reply := make([]byte, 16)
+			copy(reply, "STAT")
+			if _, ok := fs.files[name]; ok {
+				binary.LittleEndian.PutUint32(reply[4:], syncModeRegular|0o644)
+				binary.LittleEndian.PutUint32(reply[8:], uint32(fs.size(name)))
+				binary.LittleEndian.PutUint32(reply[12:], 1700000000)
+			}
+			conn.Write(reply)
+		case "STA2":
+			reply := make([]byte, 72)
+			copy(reply, "STA2")
+			if _, ok := fs.files[name]; ok {
+				binary.LittleEndian.PutUint32(reply[24:], syncModeRegular|0o644)
+				binary.LittleEndian.PutUint64(reply[40:], fs.size(name))
+				binary.LittleEndian.PutUint64(reply[56:], 1700000000)
+			} else {
+				binary.LittleEndian.PutUint32(reply[4:], syncENOENT)
+			}
+			conn.Write(reply)
+		case "LIS2":
+			prefix := strings.TrimSuffix(name, "/") + "/"
+			for path := range fs.files {
+				if !strings.HasPrefix(path, prefix) {
+					continue
+				}
+				entry := strings.TrimPrefix(path, prefix)
+				reply := make([]byte, 76)
+				copy(reply, "DNT2")
+				binary.LittleEndian.PutUint32(reply[24:], syncModeRegular|0o644)
+				binary.LittleEndian.PutUint64(reply[40:], fs.size(path))
+				binary.LittleEndian.PutUint32(reply[72:], uint32(len(entry)))
+				conn.Write(append(reply, entry...))
+			}
+			conn.Write(append([]byte("DONE"), make([]byte, 72)...))
+		case "LIST":
+			prefix := strings.TrimSuffix(name, "/") + "/"
+			for path := range fs.files {
+				if !strings.HasPrefix(path, prefix) {
+					continue
+				}
+				entry := strings.TrimPrefix(path, prefix)
+				reply := make([]byte, 20)
+				copy(reply, "DENT")
+				binary.LittleEndian.PutUint32(reply[4:], syncModeRegular|0o644)
+				binary.LittleEndian.PutUint32(reply[8:], uint32(fs.size(path)))
+				binary.LittleEndian.PutUint32(reply[16:], uint32(len(entry)))
+				conn.Write(append(reply, entry...))
+			}
+			conn.Write(append([]byte("DONE"), make([]byte, 16)...))
+		case "RECV":
+			data, ok := fs.files[name]
+			if !ok {
+				msg := "open failed: Permission denied"
+				writeSyncHeader(conn, "FAIL", uint32(len(msg)))
+				conn.Write([]byte(msg))
+				break
+			}
+			for len(data) > 0 {
+				n := min(len(data), 3)
+				writeSyncHeader(conn, "DATA", uint32(n))
+				conn.Write(data[:n])
+				data = data[n:]
+			}
+			writeSyncHeader(conn, "DONE", 0)
+		case "SEND":
+			path, _, _ := strings.Cut(name, ",")
+			var content bytes.Buffer
+			for {
+				header := make([]byte, 8)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					fs.mu.Unlock()
+					return
+				}
+				if string(header[:4]) == "DONE" {
+					break
+				}
+				if _, err := io.CopyN(&content, conn, int64(binary.LittleEndian.Uint32(header[4:]))); err != nil {
+					fs.mu.Unlock()
+					return
+				}
+			}
+			fs.files[path] = content.Bytes()
+			writeSyncHeader(conn, "OKAY", 0)
+		}
+		fs.mu.Unlock()
+	}
+}
+
+func (fs *fakeServer) command(cmd string) fakeCommand {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	res, ok := fs.shell[cmd]
+	if !ok {
+		return fakeCommand{stderr: "/system/bin/sh: " + cmd + ": not found\n", exit: 127}
+	}
+	return res
+}
+
+// size returns the size of a file as reported by the sync requests. It must
+// be called with mu held.
+func (fs *fakeServer) size(name string) uint64 {
+	if size, ok := fs.sizes[name]; ok {
+		return size
+	}
+	return uint64(len(fs.files[name]))
+}
+
+func writeSyncHeader(w io.Writer, id string, length uint32) {
+	header := make([]byte, 8)
+	copy(header, id)
+	binary.LittleEndian.PutUint32(header[4:], length)
+	w.Write(header)
+}
+
+func TestDevicesAndGetState(t *testing.T) {
+	fs := newFakeServer(t)
+	client := fs.client()
+
+	devices, err := client.Devices()
+	if err != nil {
+		t.Fatalf("Devices() error = %v", err)
+	}
+	if len(devices) != 1 || devices[0] != fs.serial {
+		t.Fatalf("Devices() = %v, want [%s]", devices, fs.serial)
+	}
+
+	state, err := client.GetState()
+	if err != nil {
+		t.Fatalf("GetState() error = %v", err)
+	}
+	if state != "device" {
+		t.Fatalf("GetState() = %q, want %q", state, "device")
+	}
+
+	fs.mu.Lock()
+	fs.others = "FAKE0002\tunauthorized\nFAKE0003\toffline\n"
+	fs.mu.Unlock()
+	states, err := client.DeviceStates()
+	if err != nil {
+		t.Fatalf("DeviceStates() error = %v", err)
+	}
+	want := []DeviceState{{fs.serial, "device"}, {"FAKE0002", "unauthorized"}, {"FAKE0003", "offline"}}
+	if !reflect.DeepEqual(states, want) {
+		t.Fatalf("DeviceStates() = %v, want %v", states, want)
+	}
+
+	client.Serial = "MISSING"
+	if _, err := client.GetState(); err == nil {
+		t.Fatal("GetState() error = nil for an unknown serial")
+	}
+}
+
+func TestWaitForDevice(t *testing.T) {
+	previous := waitForDeviceInterval
+	waitForDeviceInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitForDeviceInterval = previous })
+
+	fs := newFakeServer(t)
+	client := &ADB{ServerAddr: fs.listener.Addr().String()}
+
+	serial, err := client.WaitForDevice(context.Background(), "")
+	if err != nil {
+		t.Fatalf("WaitForDevice() error = %v", err)
+	}
+	if serial != fs.serial || client.Serial != fs.serial {
+		t.Fatalf("WaitForDevice() = %q, serial in use %q, want %q", serial, client.Serial, fs.serial)
+	}
+	if !client.Connected() {
+		t.Fatal("Connected() = false for a connected device")
+	}
+
+	fs.mu.Lock()
+	fs.unplugged = true
+	fs.mu.Unlock()
+	if client.Connected() {
+		t.Fatal("Connected() = true for an unplugged device")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Reconnect(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Reconnect() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() {
+		fs.mu.Lock()
+		fs.unplugged = false
+		fs.mu.Unlock()
+	})
+	if err := client.Reconnect(context.Background()); err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	if client.Serial != fs.serial {
+		t.Fatalf("serial in use after reconnecting = %q, want %q", client.Serial, fs.serial)
+	}
+
+	// The features are queried again after reconnecting.
+	if !client.HasFeature("shell_v2") {
+		t.Fatal("HasFeature(shell_v2) = false before the device changed")
+	}
+	fs.mu.Lock()
+	fs.features = "cmd"
+	fs.mu.Unlock()
+	if err := client.Reconnect(context.Background()); err != nil {
+		t.Fatalf("Reconnect() error = %v", err)
+	}
+	if client.HasFeature("shell_v2") {
+		t.Fatal("HasFeature(shell_v2) = true, the features were kept across Reconnect()")
+	}
+}
+
+func TestHasFeatureNotCachedOnFailure(t *testing.T) {
+	fs := newFakeServer(t)
+	fs.unplugged = true
+	client := fs.client()
+
+	if client.HasFeature("shell_v2") {
+		t.Fatal("HasFeature() = true while the device is gone")
+	}
+
+	fs.mu.Lock()
+	fs.unplugged = false
+	fs.mu.Unlock()
+	if !client.HasFeature("shell_v2") {
+		t.Fatal("HasFeature() = false once the device is back, the failed query was cached")
+	}
+}
+
+func TestForDevice(t *testing.T) {
+	fs := newFakeServer(t)
+	server := &ADB{ServerAddr: fs.listener.Addr().String()}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := server.ForDevice(fs.serial, nil)
+			if !client.Connected() {
+				t.Error("Connected() = false for a device client")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if server.Serial != "" {
+		t.Fatalf("ForDevice() changed the serial of the original client to %q", server.Serial)
+	}
+}
+
+func TestShell(t *testing.T) {
+	fs := newFakeServer(t)
+	fs.shell["getprop ro.product.cpu.abi"] = fakeCommand{stdout: "arm64-v8a\n"}
+	client := fs.client()
+
+	out, err := client.Shell("getprop", "ro.product.cpu.abi")
+	if err != nil {
+		t.Fatalf("Shell() error = %v", err)
+	}
+	if out != "arm64-v8a" {
+		t.Fatalf("Shell() = %q, want %q", out, "arm64-v8a")
+	}
+
+	client.Serial = "MISSING"
+	if _, err := client.Shell("id"); err == nil {
+		t.Fatal("Shell() error = nil for an unknown serial")
+	}
+}
+
+func TestSyncStatListAndPull(t *testing.T) {
+	fs := newFakeServer(t)
+	fs.files["/data/local/tmp/a.txt"] = []byte("first file")
+	fs.files["/data/local/tmp/b.txt"] = []byte("second")
+	client := fs.client()
+
+	stat, err := client.Stat("/data/local/tmp/a.txt")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if !stat.Exists() || !stat.IsRegular() || stat.Size != 10 {
+		t.Fatalf("Stat() = %+v, want a 10 bytes regular file", stat)
+	}
+
+	stat, err = client.Stat("/data/local/tmp/missing")
+	if err != nil {
+		t.Fatalf("Stat(missing) error = %v", err)
+	}
+	if stat.Exists() {
+		t.Fatalf("Stat(missing) = %+v, want a missing file", stat)
+	}
+
+	entries, err := client.ListDir("/data/local/tmp")
+	if err != nil {
+		t.Fatalf("ListDir() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ListDir() returned %d entries, want 2", len(entries))
+	}
+
+	var buf bytes.Buffer
+	if err := client.PullToWriter("/data/local/tmp/a.txt", &buf); err != nil {
+		t.Fatalf("PullToWriter() error = %v", err)
+	}
+	if buf.String() != "first file" {
+		t.Fatalf("PullToWriter() content = %q, want %q", buf.String(), "first file")
+	}
+
+	err = client.PullToWriter("/proc/kmsg", &buf)
+	if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Fatalf("PullToWriter() error = %v, want the device failure message", err)
+	}
+}
+
+func TestSyncStatListLargeFiles(t *testing.T) {
+	var large uint64 = 5 << 30
+
+	for _, features := range []string{"stat_v2,ls_v2", "cmd"} {
+		t.Run(features, func(t *testing.T) {
+			fs := newFakeServer(t)
+			fs.features = features
+			fs.files["/sdcard/backup.ab"] = []byte("content")
+			fs.sizes["/sdcard/backup.ab"] = large
+			client := fs.client()
+
+			// Without the v2 requests the sizes are truncated to 32 bits.
+			want := large
+			if features == "cmd" {
+				want = uint64(uint32(large))
+			}
+
+			stat, err := client.Stat("/sdcard/backup.ab")
+			if err != nil {
+				t.Fatalf("Stat() error = %v", err)
+			}
+			if !stat.IsRegular() || stat.Size != want {
+				t.Fatalf("Stat() = %+v, want a regular file of %d bytes", stat, want)
+			}
+
+			stat, err = client.Stat("/sdcard/missing")
+			if err != nil {
+				t.Fatalf("Stat(missing) error = %v", err)
+			}
+			if stat.Exists() {
+				t.Fatalf("Stat(missing) = %+v, want a missing file", stat)
+			}
+
+			entries, err := client.ListDir("/sdcard")
+			if err != nil {
+				t.Fatalf("ListDir() error = %v", err)
+			}
+			if len(entries) != 1 || entries[0].Name != "backup.ab" || entries[0].Size != want {
+				t.Fatalf("ListDir() = %+v, want backup.ab of %d bytes", entries, want)
+			}
+		})
+	}
+}
+
+func TestPullAndPush(t *testing.T) {
+	fs := newFakeServer(t)
+	fs.files["/sdcard/file.bin"] = []byte("pulled content")
+	client := fs.client()
+
+	localPath := t.TempDir() + "/file.bin"
+	if out, err := client.Pull("/sdcard/file.bin", localPath); err != nil {
+		t.Fatalf("Pull() error = %v: %s", err, out)
+	}
+
+	if _, err := client.Push(localPath, "/data/local/tmp/copy.bin"); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	fs.mu.Lock()
+	pushed := string(fs.files["/data/local/tmp/copy.bin"])
+	fs.mu.Unlock()
+	if pushed != "pulled content" {
+		t.Fatalf("pushed content = %q, want %q", pushed, "pulled content")
+	}
+
+	exists, err := client.FileExists("/data/local/tmp/copy.bin")
+	if err != nil {
+		t.Fatalf("FileExists() error = %v", err)
+	}
+	if !exists {
+		t.Fatal("FileExists() = false after Push()")
+	}
+
+	if err := client.PushFromReader(strings.NewReader("from memory"), "/data/local/tmp/collector", 0o755); err != nil {
+		t.Fatalf("PushFromReader() error = %v", err)
+	}
+	fs.mu.Lock()
+	pushed = string(fs.files["/data/local/tmp/collector"])
+	fs.mu.Unlock()
+	if pushed != "from memory" {
+		t.Fatalf("pushed content = %q, want %q", pushed, "from memory")
+	}
+}
+
+func TestBugreportToWriter(t *testing.T) {
+	fs := newFakeServer(t)
+	fs.shell["bugreportz"] = fakeCommand{stdout: "OK:/bugreports/bugreport-1.zip\n"}
+	fs.files["/bugreports/bugreport-1.zip"] = []byte("PK zip content")
+	client := fs.client()
+
+	var buf bytes.Buffer
+	if err := client.BugreportToWriter(&buf); err != nil {
+		t.Fatalf("BugreportToWriter() error = %v", err)
+	}
+	if buf.String() != "PK zip content" {
+		t.Fatalf("bugreport content = %q, want %q", buf.String(), "PK zip content")
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	found := false
+	for _, request := range fs.requests {
+		if strings.HasSuffix(request, ":rm /bugreports/bugreport-1.zip") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("bugreport was not removed from the device")
+	}
+}
+
+func TestRunShell(t *testing.T) {
+	for _, features := range []string{"shell_v2,cmd", "cmd"} {
+		t.Run(features, func(t *testing.T) {
+			fs := newFakeServer(t)
+			fs.features = features
+			fs.shell["which -a su"] = fakeCommand{exit: 1}
+			fs.shell["ls /data"] = fakeCommand{
+				stdout: "local\n",
+				stderr: "ls: /data/system: Permission denied\n",
+				exit:   1,
+			}
+			client := fs.client()
+
+			res, err := client.RunShell("which", "-a", "su")
+			if !IsExitError(err) {
+				t.Fatalf("RunShell() error = %v, want an exit error", err)
+			}
+			if res == nil || res.ExitCode != 1 {
+				t.Fatalf("RunShell() result = %+v, want exit code 1", res)
+			}
+
+			res, err = client.RunShell("ls", "/data")
+			if !IsExitError(err) {
+				t.Fatalf("RunShell() error = %v, want an exit error", err)
+			}
+			if !strings.Contains(res.Stdout, "local") {
+				t.Fatalf("RunShell() stdout = %q, want the listing", res.Stdout)
+			}
+			if features == "shell_v2,cmd" && res.Stdout != "local\n" {
+				t.Fatalf("RunShell() stdout = %q, want stderr kept separately", res.Stdout)
+			}
+			if !strings.Contains(err.Error(), "status 1") {
+				t.Fatalf("exit error = %q, want the exit status", err.Error())
+			}
+
+			if _, err := client.RunShell("missing-binary"); err == nil {
+				t.Fatal("RunShell() error = nil for a missing binary")
+			}
+		})
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	fs := newFakeServer(t)
+	fs.shell["dumpsys"] = fakeCommand{hang: true}
+	fs.shell["bu backup -nocompress -all"] = fakeCommand{stdout: "ANDROID BACKUP\n", hang: true}
+	client := fs.client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.RunShellContext(ctx, "dumpsys"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunShellContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("RunShellContext() returned after %s", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	var buf bytes.Buffer
+	if err := client.BackupToWriterContext(ctx, "-all", &buf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("BackupToWriterContext() error = %v, want %v", err, context.Canceled)
+	}
+	if buf.String() != "ANDROID BACKUP\n" {
+		t.Fatalf("BackupToWriterContext() wrote %q before cancellation", buf.String())
+	}
+}
+
+func TestParseShellV1Output(t *testing.T) {
+	res := parseShellV1Output("line one\nline two\n" + exitMarker + "3")
+	if res.Stdout != "line one\nline two\n" || res.ExitCode != 3 {
+		t.Fatalf("parseShellV1Output() = %+v", res)
+	}
+
+	res = parseShellV1Output("no marker")
+	if res.Stdout != "no marker" || res.ExitCode != -1 {
+		t.Fatalf("parseShellV1Output() without marker = %+v", res)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	out := "Android Debug Bridge version 1.0.41\r\nVersion 35.0.2-12147458\r\nInstalled as /usr/bin/adb\r\n"
+	if got := parseVersion(out); got != "1.0.41 (35.0.2-12147458)" {
+		t.Fatalf("parseVersion() = %q", got)
+	}
+	if got := parseVersion("unexpected\n"); got != "unexpected" {
+		t.Fatalf("parseVersion() of unknown output = %q", got)
+	}
+}
+
+func TestParseFindOutput(t *testing.T) {
+	out := `{"path":"/system/bin/ping","type":"file","links":1,"capabilities":["cap_net_raw"],"format":"elf"}` + "\n" +
+		`{"path":"/d","type":"symlink","link_target":"/sys/kernel/debug"}` + "\n" +
+		`{"path":"/data","type":"directory","error":"permission denied"}` + "\n"
+
+	files := parseFindOutput(out)
+	if len(files) != 3 {
+		t.Fatalf("parseFindOutput() returned %d files, want 3", len(files))
+	}
+	if files[0].Format != "elf" || len(files[0].Capabilities) != 1 || files[0].Capabilities[0] != "cap_net_raw" {
+		t.Fatalf("unexpected first file %+v", files[0])
+	}
+	if files[1].LinkTarget != "/sys/kernel/debug" || files[1].Capabilities != nil || files[1].Format != "" {
+		t.Fatalf("fields of the previous file leaked into %+v", files[1])
+	}
+	if files[2].Type != "directory" || files[2].LinkTarget != "" || files[2].Error != "permission denied" {
+		t.Fatalf("unexpected directory %+v", files[2])
+	}
+}
+
+func TestFindOptionsArgs(t *testing.T) {
+	if args := (FindOptions{}).args(); len(args) != 0 {
+		t.Fatalf("args() of the zero value = %q", args)
+	}
+
+	maxDepth := 0
+	opts := FindOptions{
+		Exclude:       []string{"/proc", "/data/it's/*"},
+		MaxDepth:      &maxDepth,
+		NewerThan:     time.Unix(1700000000, 0),
+		OneFileSystem: true,
+		MaxSize:       1024,
+		Types:         []string{"file", "symlink"},
+	}
+	got := strings.Join(opts.args(), " ")
+	want := `--exclude '/proc' --exclude '/data/it'\''s/*' --max-depth 0 --newer-than 1700000000 --one-file-system --max-size 1024 --type file,symlink`
+	if got != want {
+		t.Fatalf("args() = %q, want %q", got, want)
+	}
+}
+
+func TestProcessOptionsArgs(t *testing.T) {
+	if args := (ProcessOptions{}).args(); len(args) != 0 {
+		t.Fatalf("args() of the zero value = %q", args)
+	}
+	got := strings.Join(ProcessOptions{Maps: true, Threads: true, Hash: true}.args(), " ")
+	if got != "--maps --threads --hash" {
+		t.Fatalf("args() = %q", got)
+	}
+}
+
+func TestParseProcNet(t *testing.T) {
+	tcp := parseProcNet("tcp", "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"+
+		"   0: 0100007F:13AD 00000000:0000 0A 00000000:00000000 00:00000000 00000000  2000        0 31514 1 0000000000000000 100 0 0 10 0\n"+
+		"   1: 1701A8C0:B3F2 22D8B85D:01BB 01 00000000:00000000 02:000007C1 00000000 10123        0 82034 2 0000000000000000 20 4 30 10 -1\n")
+	if len(tcp) != 2 {
+		t.Fatalf("parseProcNet(tcp) returned %d sockets, want 2", len(tcp))
+	}
+	want := Connection{Protocol: "tcp", LocalAddress: "127.0.0.1", LocalPort: 5037, RemoteAddress: "0.0.0.0", State: "LISTEN", Uid: 2000, Inode: 31514}
+	if !reflect.DeepEqual(tcp[0], want) {
+		t.Fatalf("parseProcNet(tcp)[0] = %+v, want %+v", tcp[0], want)
+	}
+	want = Connection{Protocol: "tcp", LocalAddress: "192.168.1.23", LocalPort: 46066, RemoteAddress: "93.184.216.34", RemotePort: 443, State: "ESTABLISHED", Uid: 10123, Inode: 82034}
+	if !reflect.DeepEqual(tcp[1], want) {
+		t.Fatalf("parseProcNet(tcp)[1] = %+v, want %+v", tcp[1], want)
+	}
+
+	tcp6 := parseProcNet("tcp6", "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"+
+		"   0: 00000000000000000000000001000000:0035 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1051        0 20000 1 0000000000000000 100 0 0 10 0\n")
+	if len(tcp6) != 1 || tcp6[0].LocalAddress != "::1" || tcp6[0].LocalPort != 53 {
+		t.Fatalf("parseProcNet(tcp6) = %+v", tcp6)
+	}
+
+	unix := parseProcNet("unix", "Num       RefCount Protocol Flags    Type St Inode Path\n"+
+		"0000000000000000: 00000002 00000000 00010000 0001 01 12345 /dev/socket/adbd\n"+
+		"0000000000000000: 00000003 00000000 00000000 0001 03 12346 @jdwp-control\n"+
+		"0000000000000000: 00000003 00000000 00000000 0002 03 12347\n")
+	wantUnix := []Connection{
+		{Protocol: "unix", Type: "STREAM", State: "UNCONNECTED", Path: "/dev/socket/adbd", Uid: -1, Inode: 12345},
+		{Protocol: "unix", Type: "STREAM", State: "CONNECTED", Path: "@jdwp-control", Uid: -1, Inode: 12346},
+		{Protocol: "unix", Type: "DGRAM", State: "CONNECTED", Uid: -1, Inode: 12347},
+	}
+	if !reflect.DeepEqual(unix, wantUnix) {
+		t.Fatalf("parseProcNet(unix) = %+v, want %+v", unix, wantUnix)
+	}
+}
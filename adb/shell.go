@@ -0,0 +1,221 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Packet identifiers of the shell v2 protocol.
+const (
+	shellIDStdout     = 1
+	shellIDStderr     = 2
+	shellIDExit       = 3
+	shellIDCloseStdin = 4
+)
+
+// exitMarker is appended to the output of commands run on devices that do
+// not support shell v2, so that the exit status can still be recovered.
+const exitMarker = ":androidqf-exit:"
+
+// ShellResult is the outcome of a shell command run on the device.
+type ShellResult struct {
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ExitError is returned by RunShell when the command exited with a non-zero
+// status.
+type ExitError struct {
+	Command string
+	Result  *ShellResult
+}
+
+func (e *ExitError) Error() string {
+	msg := strings.TrimSpace(e.Result.Stderr)
+	if msg == "" {
+		msg = strings.TrimSpace(e.Result.Stdout)
+	}
+	if msg == "" {
+		return fmt.Sprintf("`%s` exited with status %d", e.Command, e.Result.ExitCode)
+	}
+	return fmt.Sprintf("`%s` exited with status %d: %s", e.Command, e.Result.ExitCode, msg)
+}
+
+// HasFeature reports whether the device advertises the given adb feature,
+// such as "shell_v2". Features are queried once per device, and again after
+// a failed query so that a device briefly gone does not lose them for good.
+func (a *ADB) HasFeature(feature string) bool {
+	a.featuresMu.Lock()
+	defer a.featuresMu.Unlock()
+
+	if a.features == nil {
+		out, err := a.hostQuery(context.Background(), a.hostDeviceService("features"))
+		if err != nil {
+			a.Log.Debugf("Failed to get adb features of the device: %v", err)
+			return false
+		}
+		a.features = make(map[string]bool)
+		for _, f := range strings.Split(strings.TrimSpace(out), ",") {
+			a.features[f] = true
+		}
+	}
+
+	return a.features[feature]
+}
+
+// resetFeatures forgets the cached features, for example when another
+// device is selected.
+func (a *ADB) resetFeatures() {
+	a.featuresMu.Lock()
+	a.features = nil
+	a.featuresMu.Unlock()
+}
+
+// RunShell executes a shell command on the device and returns its stdout,
+// stderr and exit status separately. The result is returned whenever the
+// command ran; if it exited with a non-zero status the error is an
+// *ExitError. Anything written to stderr is recorded in the log.
+func (a *ADB) RunShell(cmd ...string) (*ShellResult, error) {
+	return a.RunShellContext(context.Background(), cmd...)
+}
+
+// RunShellContext is like RunShell but kills the command when the context is
+// done, in which case the context error is returned.
+func (a *ADB) RunShellContext(ctx context.Context, cmd ...string) (*ShellResult, error) {
+	command := strings.Join(cmd, " ")
+	start := time.Now()
+
+	var res *ShellResult
+	var err error
+	if a.HasFeature("shell_v2") {
+		res, err = a.runShellV2(ctx, command)
+	} else {
+		res, err = a.runShellV1(ctx, command)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			a.Log.Debugf("`%s` aborted after %s: %v", command, time.Since(start).Round(time.Millisecond), ctx.Err())
+		}
+		return nil, contextError(ctx, err)
+	}
+	res.Duration = time.Since(start)
+
+	if stderr := strings.TrimSpace(res.Stderr); stderr != "" {
+		a.Log.Debugf("stderr of `%s`: %s", command, stderr)
+	}
+	if res.ExitCode != 0 {
+		a.Log.Debugf("`%s` exited with status %d", command, res.ExitCode)
+		return res, &ExitError{Command: command, Result: res}
+	}
+
+	return res, nil
+}
+
+func (a *ADB) runShellV2(ctx context.Context, command string) (*ShellResult, error) {
+	conn, err := a.deviceRequest(ctx, "shell,v2,raw:"+command)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Nothing is ever sent on stdin.
+	if err := writeShellPacket(conn, shellIDCloseStdin, nil); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil, fmt.Errorf("shell stream for `%s` ended without an exit status: %v", command, err)
+		}
+		length := int64(binary.LittleEndian.Uint32(header[1:]))
+
+		switch header[0] {
+		case shellIDStdout:
+			_, err = io.CopyN(&stdout, conn, length)
+		case shellIDStderr:
+			_, err = io.CopyN(&stderr, conn, length)
+		case shellIDExit:
+			status := make([]byte, length)
+			if _, err := io.ReadFull(conn, status); err != nil || length == 0 {
+				return nil, fmt.Errorf("failed to read exit status of `%s`: %v", command, err)
+			}
+			return &ShellResult{
+				Stdout:   stdout.String(),
+				Stderr:   stderr.String(),
+				ExitCode: int(status[0]),
+			}, nil
+		default:
+			_, err = io.CopyN(io.Discard, conn, length)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output of `%s`: %v", command, err)
+		}
+	}
+}
+
+func writeShellPacket(w io.Writer, id byte, data []byte) error {
+	packet := make([]byte, 5, 5+len(data))
+	packet[0] = id
+	binary.LittleEndian.PutUint32(packet[1:], uint32(len(data)))
+	_, err := w.Write(append(packet, data...))
+	return err
+}
+
+// runShellV1 is used with devices predating shell v2. Stdout and stderr are
+// merged by the device, and the exit status is echoed after the command.
+func (a *ADB) runShellV1(ctx context.Context, command string) (*ShellResult, error) {
+	var out bytes.Buffer
+	_, err := a.deviceStream(ctx, fmt.Sprintf("shell:%s; echo -n \"%s$?\"", command, exitMarker), &out)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseShellV1Output(out.String()), nil
+}
+
+func parseShellV1Output(out string) *ShellResult {
+	res := &ShellResult{ExitCode: -1}
+
+	idx := strings.LastIndex(out, exitMarker)
+	if idx < 0 {
+		// The command exited the shell before the marker was printed.
+		res.Stdout = out
+		return res
+	}
+
+	res.Stdout = out[:idx]
+	code, err := strconv.Atoi(strings.TrimSpace(out[idx+len(exitMarker):]))
+	if err == nil {
+		res.ExitCode = code
+	}
+	return res
+}
+
+// IsExitError reports whether err is an *ExitError, meaning that the command
+// ran on the device but exited with a non-zero status.
+func IsExitError(err error) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr)
+}
+
+// Quote quotes the argument for the shell of the device, so that it is
+// passed as is even if it has spaces, quotes or other special characters.
+func Quote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
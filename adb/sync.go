@@ -0,0 +1,379 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package adb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	syncMaxPath  = 1024
+	syncMaxChunk = 64 * 1024
+
+	// Sizes of the answers to STA2, and of the entries answering LIS2
+	// without their name.
+	syncStatV2Size = 72
+	syncDentV2Size = 76
+	// syncENOENT is the error of STA2 for missing files.
+	syncENOENT = 2
+
+	// File type bits of the st_mode returned by STAT and LIST.
+	syncModeTypeMask = 0o170000
+	syncModeDir      = 0o040000
+	syncModeRegular  = 0o100000
+	syncModeSymlink  = 0o120000
+)
+
+// RemoteFile is a file entry as returned by the sync STAT and LIST requests,
+// or STA2 and LIS2 where the device supports them. Without them, the sizes
+// are 32-bit: those of files of 4 GiB or more are truncated.
+type RemoteFile struct {
+	Name         string `json:"name"`
+	Mode         uint32 `json:"mode"`
+	Size         uint64 `json:"size"`
+	ModifiedTime int64  `json:"modified_time"`
+}
+
+// Exists reports whether STAT found the file. adbd answers STAT for missing
+// files with an all-zero record.
+func (f *RemoteFile) Exists() bool {
+	return f.Mode != 0
+}
+
+// IsDir reports whether the entry is a directory.
+func (f *RemoteFile) IsDir() bool {
+	return f.Mode&syncModeTypeMask == syncModeDir
+}
+
+// IsRegular reports whether the entry is a regular file.
+func (f *RemoteFile) IsRegular() bool {
+	return f.Mode&syncModeTypeMask == syncModeRegular
+}
+
+// IsSymlink reports whether the entry is a symbolic link.
+func (f *RemoteFile) IsSymlink() bool {
+	return f.Mode&syncModeTypeMask == syncModeSymlink
+}
+
+// syncConn is a connection switched to the file sync sub-protocol.
+type syncConn struct {
+	conn net.Conn
+	// statV2 and listV2 are set when the device supports STA2 and LIS2,
+	// with 64-bit sizes.
+	statV2 bool
+	listV2 bool
+}
+
+// openSync opens the sync service on the selected device.
+func (a *ADB) openSync(ctx context.Context) (*syncConn, error) {
+	statV2, listV2 := a.HasFeature("stat_v2"), a.HasFeature("ls_v2")
+	conn, err := a.deviceRequest(ctx, "sync:")
+	if err != nil {
+		return nil, err
+	}
+	return &syncConn{conn: conn, statV2: statV2, listV2: listV2}, nil
+}
+
+// Close ends the sync session and closes the connection.
+func (s *syncConn) Close() error {
+	_ = s.writeHeader("QUIT", 0)
+	return s.conn.Close()
+}
+
+func (s *syncConn) writeHeader(id string, length uint32) error {
+	header := make([]byte, 8)
+	copy(header, id)
+	binary.LittleEndian.PutUint32(header[4:], length)
+	_, err := s.conn.Write(header)
+	return err
+}
+
+func (s *syncConn) readHeader() (string, uint32, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return "", 0, err
+	}
+	return string(header[:4]), binary.LittleEndian.Uint32(header[4:]), nil
+}
+
+// readFail reads the message following a FAIL header.
+func (s *syncConn) readFail(length uint32) error {
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(s.conn, msg); err != nil {
+		return fmt.Errorf("failed to read sync failure: %v", err)
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// request sends a sync request carrying a remote path.
+func (s *syncConn) request(id, remotePath string) error {
+	if len(remotePath) > syncMaxPath {
+		return fmt.Errorf("remote path too long: %q", remotePath)
+	}
+	if err := s.writeHeader(id, uint32(len(remotePath))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.conn, remotePath)
+	return err
+}
+
+func (s *syncConn) stat(remotePath string) (*RemoteFile, error) {
+	if s.statV2 {
+		return s.statV2Request(remotePath)
+	}
+	if err := s.request("STAT", remotePath); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(s.conn, buf); err != nil {
+		return nil, fmt.Errorf("failed to read stat of %q: %v", remotePath, err)
+	}
+	if string(buf[:4]) != "STAT" {
+		return nil, fmt.Errorf("unexpected sync answer %q to STAT", buf[:4])
+	}
+
+	return &RemoteFile{
+		Name:         remotePath,
+		Mode:         binary.LittleEndian.Uint32(buf[4:]),
+		Size:         uint64(binary.LittleEndian.Uint32(buf[8:])),
+		ModifiedTime: int64(binary.LittleEndian.Uint32(buf[12:])),
+	}, nil
+}
+
+// statV2Request is stat with STA2. Missing files are returned with a zero
+// mode, as STAT does.
+func (s *syncConn) statV2Request(remotePath string) (*RemoteFile, error) {
+	if err := s.request("STA2", remotePath); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, syncStatV2Size)
+	if _, err := io.ReadFull(s.conn, buf); err != nil {
+		return nil, fmt.Errorf("failed to read stat of %q: %v", remotePath, err)
+	}
+	if string(buf[:4]) != "STA2" {
+		return nil, fmt.Errorf("unexpected sync answer %q to STA2", buf[:4])
+	}
+	errno := binary.LittleEndian.Uint32(buf[4:])
+	switch errno {
+	case 0:
+	case syncENOENT:
+		return &RemoteFile{Name: remotePath}, nil
+	default:
+		return nil, fmt.Errorf("failed to stat %q: error %d", remotePath, errno)
+	}
+
+	return &RemoteFile{
+		Name:         remotePath,
+		Mode:         binary.LittleEndian.Uint32(buf[24:]),
+		Size:         binary.LittleEndian.Uint64(buf[40:]),
+		ModifiedTime: int64(binary.LittleEndian.Uint64(buf[56:])),
+	}, nil
+}
+
+func (s *syncConn) list(remotePath string) ([]RemoteFile, error) {
+	if s.listV2 {
+		return s.listV2Request(remotePath)
+	}
+	if err := s.request("LIST", remotePath); err != nil {
+		return nil, err
+	}
+
+	var entries []RemoteFile
+	buf := make([]byte, 20)
+	for {
+		if _, err := io.ReadFull(s.conn, buf); err != nil {
+			return entries, fmt.Errorf("failed to read listing of %q: %v", remotePath, err)
+		}
+
+		switch string(buf[:4]) {
+		case "DONE":
+			return entries, nil
+		case "DENT":
+			name := make([]byte, binary.LittleEndian.Uint32(buf[16:]))
+			if _, err := io.ReadFull(s.conn, name); err != nil {
+				return entries, fmt.Errorf("failed to read listing of %q: %v", remotePath, err)
+			}
+			if string(name) == "." || string(name) == ".." {
+				continue
+			}
+			entries = append(entries, RemoteFile{
+				Name:         string(name),
+				Mode:         binary.LittleEndian.Uint32(buf[4:]),
+				Size:         uint64(binary.LittleEndian.Uint32(buf[8:])),
+				ModifiedTime: int64(binary.LittleEndian.Uint32(buf[12:])),
+			})
+		default:
+			return entries, fmt.Errorf("unexpected sync answer %q to LIST", buf[:4])
+		}
+	}
+}
+
+// listV2Request is list with LIS2. Entries which could not be read are
+// skipped.
+func (s *syncConn) listV2Request(remotePath string) ([]RemoteFile, error) {
+	if err := s.request("LIS2", remotePath); err != nil {
+		return nil, err
+	}
+
+	var entries []RemoteFile
+	buf := make([]byte, syncDentV2Size)
+	for {
+		if _, err := io.ReadFull(s.conn, buf); err != nil {
+			return entries, fmt.Errorf("failed to read listing of %q: %v", remotePath, err)
+		}
+
+		switch string(buf[:4]) {
+		case "DONE":
+			return entries, nil
+		case "DNT2":
+			length := binary.LittleEndian.Uint32(buf[72:])
+			if length > syncMaxPath {
+				return entries, fmt.Errorf("sync entry name too long (%d bytes)", length)
+			}
+			name := make([]byte, length)
+			if _, err := io.ReadFull(s.conn, name); err != nil {
+				return entries, fmt.Errorf("failed to read listing of %q: %v", remotePath, err)
+			}
+			if string(name) == "." || string(name) == ".." || binary.LittleEndian.Uint32(buf[4:]) != 0 {
+				continue
+			}
+			entries = append(entries, RemoteFile{
+				Name:         string(name),
+				Mode:         binary.LittleEndian.Uint32(buf[24:]),
+				Size:         binary.LittleEndian.Uint64(buf[40:]),
+				ModifiedTime: int64(binary.LittleEndian.Uint64(buf[56:])),
+			})
+		default:
+			return entries, fmt.Errorf("unexpected sync answer %q to LIS2", buf[:4])
+		}
+	}
+}
+
+func (s *syncConn) recv(remotePath string, w io.Writer) (int64, error) {
+	if err := s.request("RECV", remotePath); err != nil {
+		return 0, err
+	}
+
+	var written int64
+	for {
+		id, length, err := s.readHeader()
+		if err != nil {
+			return written, fmt.Errorf("failed to read %q: %v", remotePath, err)
+		}
+
+		switch id {
+		case "DATA":
+			if length > syncMaxChunk {
+				return written, fmt.Errorf("sync data chunk too large (%d bytes)", length)
+			}
+			n, err := io.CopyN(w, s.conn, int64(length))
+			written += n
+			if err != nil {
+				return written, err
+			}
+		case "DONE":
+			return written, nil
+		case "FAIL":
+			return written, s.readFail(length)
+		default:
+			return written, fmt.Errorf("unexpected sync answer %q to RECV", id)
+		}
+	}
+}
+
+func (s *syncConn) send(r io.Reader, remotePath string, mode os.FileMode, mtime time.Time) error {
+	if err := s.request("SEND", fmt.Sprintf("%s,%d", remotePath, uint32(mode.Perm())|syncModeRegular)); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, syncMaxChunk)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			if werr := s.writeHeader("DATA", uint32(n)); werr != nil {
+				return werr
+			}
+			if _, werr := s.conn.Write(chunk[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.writeHeader("DONE", uint32(mtime.Unix())); err != nil {
+		return err
+	}
+
+	id, length, err := s.readHeader()
+	if err != nil {
+		return fmt.Errorf("failed to read answer to SEND: %v", err)
+	}
+	switch id {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		return s.readFail(length)
+	default:
+		return fmt.Errorf("unexpected sync answer %q to SEND", id)
+	}
+}
+
+// Stat returns the metadata of a file on the device. Missing files are
+// returned as an entry for which Exists() is false.
+func (a *ADB) Stat(remotePath string) (*RemoteFile, error) {
+	s, err := a.openSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	return s.stat(remotePath)
+}
+
+// ListDir returns the entries of a directory on the device.
+func (a *ADB) ListDir(remotePath string) ([]RemoteFile, error) {
+	s, err := a.openSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	return s.list(remotePath)
+}
+
+// PullToWriter downloads a file from the device and streams it to a writer.
+func (a *ADB) PullToWriter(remotePath string, w io.Writer) error {
+	return a.PullToWriterContext(context.Background(), remotePath, w)
+}
+
+// PullToWriterContext is like PullToWriter but aborts the transfer when the
+// context is done.
+func (a *ADB) PullToWriterContext(ctx context.Context, remotePath string, w io.Writer) error {
+	s, err := a.openSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	_, err = s.recv(remotePath, w)
+	if err = contextError(ctx, err); err != nil {
+		return fmt.Errorf("failed to pull %q: %w", remotePath, err)
+	}
+	return nil
+}
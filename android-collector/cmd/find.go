@@ -9,12 +9,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"hash"
-	"log"
+	"io"
 	"math"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -26,30 +27,83 @@ import (
 )
 
 type FileInfo struct {
-	Path         string `json:"path"`
-	Size         int64  `json:"size"`
-	Mode         string `json:"mode"`
-	UserId       uint32 `json:"user_id"`
-	GroupId      uint32 `json:"group_id"`
-	ChangeTime   int64  `json:"changed_time"`
-	ModifiedTime int64  `json:"modified_time"`
-	AccessTime   int64  `json:"access_time"`
-	Error        string `json:"error"`
-	Context      string `json:"context"`
-	MD5          string `json:"md5"`
-	SHA1         string `json:"sha1"`
-	SHA256       string `json:"sha256"`
-	SHA512       string `json:"sha512"`
-	MimeType     string `json:"mime_type"`
+	Path string `json:"path"`
+	// Type is one of file, directory, symlink, fifo, socket, char_device,
+	// block_device or other.
+	Type         string            `json:"type"`
+	Size         int64             `json:"size"`
+	Mode         string            `json:"mode"`
+	UserId       uint32            `json:"user_id"`
+	GroupId      uint32            `json:"group_id"`
+	Inode        uint64            `json:"inode"`
+	Links        uint64            `json:"links"`
+	Device       uint64            `json:"device"`
+	ChangeTime   int64             `json:"changed_time"`
+	ModifiedTime int64             `json:"modified_time"`
+	AccessTime   int64             `json:"access_time"`
+	Error        string            `json:"error"`
+	Context      string            `json:"context"`
+	LinkTarget   string            `json:"link_target,omitempty"`
+	Capabilities []string          `json:"capabilities,omitempty"`
+	Xattrs       map[string]string `json:"xattrs,omitempty"`
+	// Format is elf, dex or apk for such files, when they are hashed.
+	Format   string `json:"format,omitempty"`
+	MD5      string `json:"md5"`
+	SHA1     string `json:"sha1"`
+	SHA256   string `json:"sha256"`
+	SHA512   string `json:"sha512"`
+	MimeType string `json:"mime_type"`
 }
 
 type Job struct {
 	FilePath string
 	FileInfo os.FileInfo
 	Hash     bool
+	// Error is set if the file could not be read, or the directory could
+	// not be listed.
+	Error error
 }
 
-var hashOption bool
+var (
+	hashOption          bool
+	maxHashOption       int64
+	excludeOption       []string
+	maxDepthOption      int
+	newerThanOption     string
+	olderThanOption     string
+	oneFileSystemOption bool
+	minSizeOption       int64
+	maxSizeOption       int64
+	typeOption          []string
+)
+
+// fileTypes are the values of the type of a file.
+var fileTypes = []string{
+	"file", "directory", "symlink", "fifo", "socket", "char_device",
+	"block_device", "other",
+}
+
+// findFilter selects the files which are walked and listed.
+type findFilter struct {
+	exclude       []string
+	maxDepth      int
+	newerThan     time.Time
+	olderThan     time.Time
+	oneFileSystem bool
+	// device is the one of the folder being listed, with oneFileSystem.
+	device  uint64
+	minSize int64
+	maxSize int64
+	types   []string
+}
+
+const (
+	// sniffSize is how much of the start of a file is used to guess its
+	// MIME type.
+	sniffSize = 8 << 10
+	// chunkSize is how much of a file is read at once while hashing it.
+	chunkSize = 256 << 10
+)
 
 func getMimeType(buf []byte) (string, error) {
 	kind, err := filetype.Match(buf)
@@ -69,82 +123,256 @@ func init() {
 
 	findCmd.PersistentFlags().BoolVarP(&hashOption, "hash", "H", false,
 		"Check the file hash")
+	findCmd.PersistentFlags().Int64Var(&maxHashOption, "max-hash-size", 0,
+		"Do not hash files larger than this many bytes (default no limit)")
+	findCmd.PersistentFlags().StringArrayVar(&excludeOption, "exclude", nil,
+		"Do not list or walk the paths matching this glob, can be repeated")
+	findCmd.PersistentFlags().IntVar(&maxDepthOption, "max-depth", -1,
+		"Do not walk deeper than this many levels below the folder, -1 for no limit")
+	findCmd.PersistentFlags().StringVar(&newerThanOption, "newer-than", "",
+		"Only list files modified after this time, in Unix seconds or RFC 3339")
+	findCmd.PersistentFlags().StringVar(&olderThanOption, "older-than", "",
+		"Only list files modified before this time, in Unix seconds or RFC 3339")
+	findCmd.PersistentFlags().BoolVar(&oneFileSystemOption, "one-file-system", false,
+		"Do not walk folders on other file systems than the one of the folder")
+	findCmd.PersistentFlags().Int64Var(&minSizeOption, "min-size", 0,
+		"Only list files of at least this many bytes")
+	findCmd.PersistentFlags().Int64Var(&maxSizeOption, "max-size", 0,
+		"Only list files of at most this many bytes (default no limit)")
+	findCmd.PersistentFlags().StringSliceVar(&typeOption, "type", nil,
+		"Only list files of these types: "+strings.Join(fileTypes, ", "))
 }
 
 var findCmd = &cobra.Command{
 	Use:   "find",
 	Short: "List files in a given folder",
 	Long:  `List files in a given folder`,
-	Run:   find,
+	RunE:  find,
+	// The error is printed by Execute.
+	SilenceErrors: true,
 }
 
-func processFile(filePath string, fileInfo os.FileInfo, getHash bool) FileInfo {
-	f := FileInfo{
-		Path:         filePath,
-		Size:         fileInfo.Size(),
-		Mode:         fileInfo.Mode().String(),
-		ModifiedTime: fileInfo.ModTime().Unix(),
+// parseTime parses a time in Unix seconds or in RFC 3339 format.
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// newFindFilter returns the filter of the command line options.
+func newFindFilter() (*findFilter, error) {
+	filter := findFilter{
+		maxDepth:      maxDepthOption,
+		oneFileSystem: oneFileSystemOption,
+		minSize:       minSizeOption,
+		maxSize:       maxSizeOption,
 	}
 
+	for _, pattern := range excludeOption {
+		pattern = filepath.Clean(pattern)
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+		filter.exclude = append(filter.exclude, pattern)
+	}
+	for _, value := range typeOption {
+		if !contains(fileTypes, value) {
+			return nil, fmt.Errorf("invalid type %q, expected one of %s", value, strings.Join(fileTypes, ", "))
+		}
+		filter.types = append(filter.types, value)
+	}
+
+	var err error
+	if newerThanOption != "" {
+		filter.newerThan, err = parseTime(newerThanOption)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --newer-than time: %v", err)
+		}
+	}
+	if olderThanOption != "" {
+		filter.olderThan, err = parseTime(olderThanOption)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --older-than time: %v", err)
+		}
+	}
+
+	return &filter, nil
+}
+
+// excluded returns whether the path matches one of the exclude patterns.
+func (f *findFilter) excluded(path string) bool {
+	for _, pattern := range f.exclude {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// listed returns whether the file matches the time, size and type bounds.
+func (f *findFilter) listed(info os.FileInfo) bool {
+	if len(f.types) > 0 && !contains(f.types, fileType(info.Mode())) {
+		return false
+	}
+	if !f.newerThan.IsZero() && !info.ModTime().After(f.newerThan) {
+		return false
+	}
+	if !f.olderThan.IsZero() && !info.ModTime().Before(f.olderThan) {
+		return false
+	}
+	if info.Size() < f.minSize || (f.maxSize > 0 && info.Size() > f.maxSize) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func processFile(job Job) FileInfo {
+	f := FileInfo{Path: job.FilePath}
+	if job.Error != nil {
+		f.Error = job.Error.Error()
+	}
+	fileInfo := job.FileInfo
+	if fileInfo == nil {
+		return f
+	}
+
+	f.Type = fileType(fileInfo.Mode())
+	f.Size = fileInfo.Size()
+	f.Mode = fileInfo.Mode().String()
+	f.ModifiedTime = fileInfo.ModTime().Unix()
+
 	stat := fileInfo.Sys().(*syscall.Stat_t)
 	f.AccessTime = time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)).Unix()
 	f.ChangeTime = time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec)).Unix()
 	f.UserId = stat.Uid
 	f.GroupId = stat.Gid
-	label, err := selinux.FileLabel(filePath)
+	f.Inode = uint64(stat.Ino)
+	f.Links = uint64(stat.Nlink)
+	f.Device = uint64(stat.Dev)
+	// The label of the link itself, not of its target.
+	label, err := selinux.LfileLabel(f.Path)
 	if err == nil {
 		f.Context = label
 	}
 
-	if getHash {
-		// no hash for /proc/
-		if strings.HasPrefix(filePath, "/proc/") || strings.HasPrefix(filePath, "/sys/") || strings.HasPrefix(filePath, "/system/") {
-			return f
+	if f.Type == "symlink" {
+		target, err := os.Readlink(f.Path)
+		if err == nil {
+			f.LinkTarget = target
 		}
+		return f
+	}
 
-		file, err := os.Open(filePath)
-		if err != nil {
-			return f
+	// Extended attributes of links cannot be read without following them.
+	xattrs, err := readXattrs(f.Path)
+	if err == nil && len(xattrs) > 0 {
+		f.Xattrs = make(map[string]string, len(xattrs))
+		for name, value := range xattrs {
+			f.Xattrs[name] = xattrString(value)
 		}
-		defer file.Close()
-
-		buf := make([]byte, f.Size)
-		_, err = file.Read(buf)
-		if err != nil {
-			return f
+		if value, ok := xattrs[capabilityXattr]; ok {
+			if capabilities, err := parseCapabilities(value); err == nil {
+				f.Capabilities = capabilities
+			}
 		}
+	}
 
-		mimeType, err := getMimeType(buf)
-		if err == nil {
-			f.MimeType = mimeType
-		}
+	if f.Type == "directory" || f.Error != "" {
+		return f
+	}
+	// The content, and so the format, is only read when hashing: listing
+	// files only reads their metadata, and leaves their access times.
+	if job.Hash {
+		hashFile(&f, fileInfo)
+	}
 
-		hashes := []hash.Hash{
-			md5.New(),
-			sha1.New(),
-			sha256.New(),
-			sha512.New(),
-		}
+	return f
+}
 
-		for _, h := range hashes {
-			h.Write(buf)
+// hashFile sets the hashes and MIME type of the file, reading it in chunks so
+// that large files do not use more memory. The reason the file was not hashed
+// is set as its error.
+func hashFile(f *FileInfo, fileInfo os.FileInfo) {
+	// no hash for /proc/
+	for _, prefix := range []string{"/proc/", "/sys/", "/system/"} {
+		if strings.HasPrefix(f.Path, prefix) {
+			f.Error = fmt.Sprintf("not hashed, in %s", prefix)
+			return
 		}
+	}
+	if !fileInfo.Mode().IsRegular() {
+		f.Error = "not hashed, not a regular file"
+		return
+	}
+	if maxHashOption > 0 && f.Size > maxHashOption {
+		f.Error = fmt.Sprintf("not hashed, larger than %d bytes", maxHashOption)
+		return
+	}
 
-		f.MD5 = hex.EncodeToString(hashes[0].Sum(nil))
-		f.SHA1 = hex.EncodeToString(hashes[1].Sum(nil))
-		f.SHA256 = hex.EncodeToString(hashes[2].Sum(nil))
-		f.SHA512 = hex.EncodeToString(hashes[3].Sum(nil))
+	file, err := os.Open(f.Path)
+	if err != nil {
+		f.Error = fmt.Sprintf("not hashed, failed to open: %v", err)
+		return
+	}
+	defer file.Close()
 
+	hashes := []hash.Hash{
+		md5.New(),
+		sha1.New(),
+		sha256.New(),
+		sha512.New(),
 	}
+	writers := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		writers[i] = h
+	}
+	writer := io.MultiWriter(writers...)
 
-	return f
+	// The MIME type is guessed from the start of the file only.
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		f.Error = fmt.Sprintf("not hashed, failed to read: %v", err)
+		return
+	}
+	head = head[:n]
+	if mimeType, err := getMimeType(head); err == nil {
+		f.MimeType = mimeType
+	}
+	f.Format = fileFormat(f.Path, head)
+	writer.Write(head)
+
+	read, err := io.CopyBuffer(writer, file, make([]byte, chunkSize))
+	read += int64(n)
+	if err != nil {
+		f.Error = fmt.Sprintf("not hashed, partially read %d of %d bytes: %v", read, f.Size, err)
+		return
+	}
+	if read != f.Size {
+		f.Error = fmt.Sprintf("read %d bytes instead of %d, the file changed while hashed", read, f.Size)
+	}
+
+	f.MD5 = hex.EncodeToString(hashes[0].Sum(nil))
+	f.SHA1 = hex.EncodeToString(hashes[1].Sum(nil))
+	f.SHA256 = hex.EncodeToString(hashes[2].Sum(nil))
+	f.SHA512 = hex.EncodeToString(hashes[3].Sum(nil))
 }
 
 func worker(jobChan chan Job, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for job := range jobChan {
-		f := processFile(job.FilePath, job.FileInfo, job.Hash)
+		f := processFile(job)
 		jsonData, err := json.Marshal(&f)
 		if err != nil {
 			continue
@@ -154,7 +382,12 @@ func worker(jobChan chan Job, wg *sync.WaitGroup) {
 }
 
 // Execute the command
-func find(cmd *cobra.Command, args []string) {
+func find(cmd *cobra.Command, args []string) error {
+	filter, err := newFindFilter()
+	if err != nil {
+		return err
+	}
+
 	var target_path string
 	if len(args) == 0 {
 		target_path = "/"
@@ -163,7 +396,7 @@ func find(cmd *cobra.Command, args []string) {
 	}
 
 	if _, err := os.Stat(target_path); os.IsNotExist(err) {
-		return
+		return nil
 	}
 
 	jobChan := make(chan Job)
@@ -176,22 +409,52 @@ func find(cmd *cobra.Command, args []string) {
 		go worker(jobChan, wg)
 	}
 
-	err := filepath.Walk(target_path,
-		func(path string, info os.FileInfo, err error) error {
-			if err == nil {
-				if !info.IsDir() {
-					jobChan <- Job{
-						FilePath: path,
-						FileInfo: info,
-						Hash:     hashOption,
-					}
-				}
-			}
-			return nil
-		})
-	if err != nil {
-		log.Fatal(err)
+	if filter.oneFileSystem {
+		if info, err := os.Lstat(target_path); err == nil {
+			filter.device = uint64(info.Sys().(*syscall.Stat_t).Dev)
+		}
 	}
+	filter.walk(target_path, 0, jobChan)
 	close(jobChan)
 	wg.Wait()
+	return nil
+}
+
+// walk sends a job for the path and, if it is a directory, for everything
+// in it. Unlike filepath.Walk, directories and the files which cannot be
+// read are reported too. Symbolic links are not followed. Excluded paths
+// are neither listed nor walked, while the files outside of the time, size
+// and type bounds are only not listed.
+func (f *findFilter) walk(path string, depth int, jobChan chan Job) {
+	if f.excluded(filepath.Clean(path)) {
+		return
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		jobChan <- Job{FilePath: path, Error: err}
+		return
+	}
+	if !info.IsDir() {
+		if f.listed(info) {
+			jobChan <- Job{FilePath: path, FileInfo: info, Hash: hashOption}
+		}
+		return
+	}
+
+	// Folders at the maximum depth and mount points of other file systems
+	// are listed, but not walked.
+	var entries []os.DirEntry
+	walked := f.maxDepth < 0 || depth < f.maxDepth
+	if f.oneFileSystem && uint64(info.Sys().(*syscall.Stat_t).Dev) != f.device {
+		walked = false
+	}
+	if walked {
+		entries, err = os.ReadDir(path)
+	}
+	if f.listed(info) || err != nil {
+		jobChan <- Job{FilePath: path, FileInfo: info, Error: err}
+	}
+	for _, entry := range entries {
+		f.walk(filepath.Join(path, entry.Name()), depth+1, jobChan)
+	}
 }
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+)
+
+const capabilityXattr = "security.capability"
+
+// capabilityNames are the Linux capabilities by number.
+var capabilityNames = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner",
+	"cap_fsetid", "cap_kill", "cap_setgid", "cap_setuid", "cap_setpcap",
+	"cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast",
+	"cap_net_admin", "cap_net_raw", "cap_ipc_lock", "cap_ipc_owner",
+	"cap_sys_module", "cap_sys_rawio", "cap_sys_chroot", "cap_sys_ptrace",
+	"cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice",
+	"cap_sys_resource", "cap_sys_time", "cap_sys_tty_config", "cap_mknod",
+	"cap_lease", "cap_audit_write", "cap_audit_control", "cap_setfcap",
+	"cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm",
+	"cap_block_suspend", "cap_audit_read", "cap_perfmon", "cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// fileType returns the type of the file from its mode.
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "char_device"
+	case mode&os.ModeDevice != 0:
+		return "block_device"
+	default:
+		return "other"
+	}
+}
+
+// readXattrs returns the extended attributes of the file.
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	list := make([]byte, size)
+	size, err = syscall.Listxattr(path, list)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range strings.Split(string(list[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		value, err := getXattr(path, name)
+		if err != nil {
+			continue
+		}
+		xattrs[name] = value
+	}
+	return xattrs, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
+
+// xattrString returns the value of an extended attribute as text, or hex
+// encoded with a "0x" prefix if it is not printable.
+func xattrString(value []byte) string {
+	text := strings.TrimRight(string(value), "\x00")
+	if !utf8.ValidString(text) {
+		return "0x" + hex.EncodeToString(value)
+	}
+	for _, r := range text {
+		if !unicode.IsPrint(r) {
+			return "0x" + hex.EncodeToString(value)
+		}
+	}
+	return text
+}
+
+// parseCapabilities returns the names of the permitted capabilities in the
+// value of the security.capability extended attribute, a vfs_cap_data
+// structure.
+func parseCapabilities(value []byte) ([]string, error) {
+	if len(value) < 12 {
+		return nil, fmt.Errorf("invalid capabilities of %d bytes", len(value))
+	}
+	permitted := uint64(binary.LittleEndian.Uint32(value[4:8]))
+	revision := binary.LittleEndian.Uint32(value[0:4]) & 0xff000000
+	if revision != 0x01000000 {
+		// Revisions 2 and 3 have the upper 32 capabilities after the
+		// lower ones.
+		if len(value) < 20 {
+			return nil, fmt.Errorf("invalid capabilities of %d bytes", len(value))
+		}
+		permitted |= uint64(binary.LittleEndian.Uint32(value[12:16])) << 32
+	}
+
+	return capabilitySet(permitted), nil
+}
+
+// capabilitySet returns the names of the capabilities in the mask.
+func capabilitySet(mask uint64) []string {
+	capabilities := []string{}
+	for i := 0; i < 64; i++ {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		if i < len(capabilityNames) {
+			capabilities = append(capabilities, capabilityNames[i])
+		} else {
+			capabilities = append(capabilities, fmt.Sprintf("cap_%d", i))
+		}
+	}
+	return capabilities
+}
+
+// fileFormat returns "elf", "dex" or "apk" if the start of the file is the
+// one of such a file, or an empty string.
+func fileFormat(path string, head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return "elf"
+	case bytes.HasPrefix(head, []byte("dex\n")):
+		return "dex"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		// APKs are zip files with a manifest.
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return ""
+		}
+		defer archive.Close()
+		for _, file := range archive.File {
+			if file.Name == "AndroidManifest.xml" {
+				return "apk"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type Connection struct {
+	// Protocol is one of tcp, tcp6, udp, udp6 or unix.
+	Protocol      string `json:"protocol"`
+	LocalAddress  string `json:"local_address,omitempty"`
+	LocalPort     int    `json:"local_port,omitempty"`
+	RemoteAddress string `json:"remote_address,omitempty"`
+	RemotePort    int    `json:"remote_port,omitempty"`
+	State         string `json:"state"`
+	// Type is the one of unix sockets, such as STREAM.
+	Type string `json:"type,omitempty"`
+	// Path is the one of unix sockets, starting with "@" if abstract.
+	Path string `json:"path,omitempty"`
+	// Uid is the owner of inet sockets, -1 for unix sockets.
+	Uid   int    `json:"uid"`
+	Inode uint64 `json:"inode"`
+	// Pids are the processes with the socket open, among those whose file
+	// descriptors can be read.
+	Pids []int `json:"pids,omitempty"`
+}
+
+// tcpStates are the states of the sockets in /proc/net/tcp and udp.
+var tcpStates = map[int64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0A: "LISTEN",
+	0x0B: "CLOSING",
+	0x0C: "NEW_SYN_RECV",
+}
+
+var (
+	unixTypes = map[int64]string{
+		0x01: "STREAM",
+		0x02: "DGRAM",
+		0x05: "SEQPACKET",
+	}
+	unixStates = map[int64]string{
+		0x01: "UNCONNECTED",
+		0x02: "CONNECTING",
+		0x03: "CONNECTED",
+		0x04: "DISCONNECTING",
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(netCmd)
+}
+
+var netCmd = &cobra.Command{
+	Use:   "net",
+	Short: "List network connections and sockets",
+	Long:  `List the TCP, UDP and unix sockets, with the processes using them.`,
+	Run:   netstat,
+}
+
+// parseAddress parses an address of /proc/net/tcp or tcp6, such as
+// "0100007F:0035". The address is in words of four bytes in host order.
+func parseAddress(value string) (string, int, error) {
+	address, port, found := strings.Cut(value, ":")
+	if !found {
+		return "", 0, fmt.Errorf("invalid address %q", value)
+	}
+	ip, err := hex.DecodeString(address)
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address %q", value)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(ip[i:]))
+	}
+	portNumber, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", value)
+	}
+	return net.IP(ip).String(), int(portNumber), nil
+}
+
+// readInetSockets returns the sockets in /proc/net/tcp, tcp6, udp or udp6.
+func readInetSockets(protocol string) ([]Connection, error) {
+	data, err := os.ReadFile(filepath.Join("/proc/net", protocol))
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []Connection
+	// sl local_address rem_address st tx_queue:rx_queue tr:tm->when
+	// retrnsmt uid timeout inode ...
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+		c := Connection{Protocol: protocol}
+		c.LocalAddress, c.LocalPort, err = parseAddress(fields[1])
+		if err != nil {
+			continue
+		}
+		c.RemoteAddress, c.RemotePort, err = parseAddress(fields[2])
+		if err != nil {
+			continue
+		}
+		state, _ := strconv.ParseInt(fields[3], 16, 64)
+		c.State = tcpStates[state]
+		c.Uid, _ = strconv.Atoi(fields[7])
+		c.Inode, _ = strconv.ParseUint(fields[9], 10, 64)
+		connections = append(connections, c)
+	}
+	return connections, nil
+}
+
+// readUnixSockets returns the sockets in /proc/net/unix.
+func readUnixSockets() ([]Connection, error) {
+	data, err := os.ReadFile("/proc/net/unix")
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []Connection
+	// Num RefCount Protocol Flags Type St Inode Path
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue
+		}
+		c := Connection{Protocol: "unix", Uid: -1}
+		socketType, _ := strconv.ParseInt(fields[4], 16, 64)
+		c.Type = unixTypes[socketType]
+		state, _ := strconv.ParseInt(fields[5], 16, 64)
+		c.State = unixStates[state]
+		c.Inode, _ = strconv.ParseUint(fields[6], 10, 64)
+		if len(fields) > 7 {
+			c.Path = strings.Join(fields[7:], " ")
+		}
+		connections = append(connections, c)
+	}
+	return connections, nil
+}
+
+// socketOwners returns the processes with each socket open, by inode. Only
+// the file descriptors of the processes which can be read are known.
+func socketOwners() map[uint64][]int {
+	owners := make(map[uint64][]int)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fdPath := filepath.Join("/proc", entry.Name(), "fd")
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdPath, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			pids := owners[inode]
+			if len(pids) == 0 || pids[len(pids)-1] != pid {
+				owners[inode] = append(pids, pid)
+			}
+		}
+	}
+	for _, pids := range owners {
+		sort.Ints(pids)
+	}
+	return owners
+}
+
+// Execute the command
+func netstat(cmd *cobra.Command, args []string) {
+	connections := []Connection{}
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		sockets, err := readInetSockets(protocol)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read /proc/net/%s: %v\n", protocol, err)
+			continue
+		}
+		connections = append(connections, sockets...)
+	}
+	sockets, err := readUnixSockets()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read /proc/net/unix: %v\n", err)
+	}
+	connections = append(connections, sockets...)
+
+	owners := socketOwners()
+	for i := range connections {
+		// Sockets which are not open yet, or in TIME_WAIT, have no inode.
+		if connections[i].Inode != 0 {
+			connections[i].Pids = owners[connections[i].Inode]
+		}
+	}
+
+	jsonData, err := json.Marshal(&connections)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(jsonData))
+}
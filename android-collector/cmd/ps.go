@@ -2,13 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/tklauser/go-sysconf"
@@ -31,10 +36,63 @@ type ProcessInfo struct {
 	CommandLine     []string `json:"command_line"`
 	Env             []string `json:"env"`
 	Cwd             string   `json:"cwd"`
+	EffectiveUid    int      `json:"effective_uid"`
+	Gid             int      `json:"gid"`
+	EffectiveGid    int      `json:"effective_gid"`
+	// TracerPid is the process tracing this one, if not zero.
+	TracerPid    int                 `json:"tracer_pid"`
+	Capabilities ProcessCapabilities `json:"capabilities"`
+	// ExeSHA256 is the hash of the executable, even if deleted.
+	ExeSHA256       string           `json:"exe_sha256,omitempty"`
+	Maps            []MappedFile     `json:"maps,omitempty"`
+	FileDescriptors []FileDescriptor `json:"fds,omitempty"`
+	Threads         []Thread         `json:"threads,omitempty"`
 }
 
+// ProcessCapabilities are the capability sets of a process.
+type ProcessCapabilities struct {
+	Inheritable []string `json:"inheritable,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+// MappedFile is a file mapped in the memory of a process, with the
+// permissions of all its mappings.
+type MappedFile struct {
+	Path        string `json:"path"`
+	Permissions string `json:"permissions"`
+	Deleted     bool   `json:"deleted"`
+}
+
+type FileDescriptor struct {
+	Fd     int    `json:"fd"`
+	Target string `json:"target"`
+}
+
+type Thread struct {
+	Tid  int    `json:"tid"`
+	Name string `json:"name"`
+}
+
+var (
+	mapsOption    bool
+	fdsOption     bool
+	threadsOption bool
+	psHashOption  bool
+)
+
 func init() {
 	rootCmd.AddCommand(processCmd)
+
+	processCmd.PersistentFlags().BoolVar(&mapsOption, "maps", false,
+		"List the files mapped in the memory of each process")
+	processCmd.PersistentFlags().BoolVar(&fdsOption, "fds", false,
+		"List the open file descriptors of each process")
+	processCmd.PersistentFlags().BoolVar(&threadsOption, "threads", false,
+		"List the threads of each process")
+	processCmd.PersistentFlags().BoolVarP(&psHashOption, "hash", "H", false,
+		"Hash the executable of each process")
 }
 
 var processCmd = &cobra.Command{
@@ -147,6 +205,198 @@ func (p *ProcessInfo) readCwd() error {
 	return nil
 }
 
+// readExe sets the path of the executable, not available for kernel threads.
+func (p *ProcessInfo) readExe() error {
+	exe, err := os.Readlink(filepath.Join("/proc/", fmt.Sprint(p.Pid), "exe"))
+	if err != nil {
+		return err
+	}
+	p.Path = exe
+	return nil
+}
+
+// readStatus sets the ids, tracer and capabilities from the status file.
+func (p *ProcessInfo) readStatus() error {
+	status, err := os.ReadFile(filepath.Join("/proc/", fmt.Sprint(p.Pid), "status"))
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch key {
+		case "Uid", "Gid":
+			// The real, effective, saved and file system ids.
+			if len(fields) < 2 {
+				continue
+			}
+			real, _ := strconv.Atoi(fields[0])
+			effective, _ := strconv.Atoi(fields[1])
+			if key == "Uid" {
+				p.Uid, p.EffectiveUid = real, effective
+			} else {
+				p.Gid, p.EffectiveGid = real, effective
+			}
+		case "TracerPid":
+			p.TracerPid, _ = strconv.Atoi(fields[0])
+		case "CapInh", "CapPrm", "CapEff", "CapAmb":
+			mask, err := strconv.ParseUint(fields[0], 16, 64)
+			if err != nil {
+				continue
+			}
+			set := capabilitySet(mask)
+			if len(set) == 0 {
+				set = nil
+			}
+			switch key {
+			case "CapInh":
+				p.Capabilities.Inheritable = set
+			case "CapPrm":
+				p.Capabilities.Permitted = set
+			case "CapEff":
+				p.Capabilities.Effective = set
+			case "CapAmb":
+				p.Capabilities.Ambient = set
+			}
+		}
+	}
+	return nil
+}
+
+// readMaps sets the files mapped by the process, such as libraries. Memory
+// without a file, or with a name such as "[stack]", is left out.
+func (p *ProcessInfo) readMaps() error {
+	maps, err := os.ReadFile(filepath.Join("/proc/", fmt.Sprint(p.Pid), "maps"))
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]int)
+	for _, line := range strings.Split(string(maps), "\n") {
+		// address perms offset dev inode path
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		path := strings.Join(fields[5:], " ")
+		deleted := strings.HasSuffix(path, " (deleted)")
+		path = strings.TrimSuffix(path, " (deleted)")
+
+		i, ok := files[path]
+		if !ok {
+			i = len(p.Maps)
+			files[path] = i
+			p.Maps = append(p.Maps, MappedFile{Path: path, Permissions: "---"})
+		}
+		p.Maps[i].Permissions = mergePermissions(p.Maps[i].Permissions, fields[1])
+		p.Maps[i].Deleted = p.Maps[i].Deleted || deleted
+	}
+	return nil
+}
+
+// mergePermissions adds the read, write and execute permissions of a
+// mapping, such as "r-xp", to those of the file, such as "r--".
+func mergePermissions(permissions, mapping string) string {
+	merged := []byte(permissions)
+	for i := 0; i < len(merged) && i < len(mapping); i++ {
+		if mapping[i] != '-' {
+			merged[i] = mapping[i]
+		}
+	}
+	return string(merged)
+}
+
+func (p *ProcessInfo) readFileDescriptors() error {
+	fdPath := filepath.Join("/proc/", fmt.Sprint(p.Pid), "fd")
+	entries, err := os.ReadDir(fdPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(fdPath, entry.Name()))
+		if err != nil {
+			continue
+		}
+		p.FileDescriptors = append(p.FileDescriptors, FileDescriptor{Fd: fd, Target: target})
+	}
+	sort.Slice(p.FileDescriptors, func(i, j int) bool {
+		return p.FileDescriptors[i].Fd < p.FileDescriptors[j].Fd
+	})
+	return nil
+}
+
+func (p *ProcessInfo) readThreads() error {
+	taskPath := filepath.Join("/proc/", fmt.Sprint(p.Pid), "task")
+	entries, err := os.ReadDir(taskPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(taskPath, entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		p.Threads = append(p.Threads, Thread{Tid: tid, Name: strings.TrimSpace(string(comm))})
+	}
+	sort.Slice(p.Threads, func(i, j int) bool {
+		return p.Threads[i].Tid < p.Threads[j].Tid
+	})
+	return nil
+}
+
+// exeHashes caches the hashes of the executables by device and inode, as
+// most processes share a few executables.
+type exeHashes map[[2]uint64]string
+
+// readExeHash sets the hash of the executable. It is read through the exe
+// link, which still works if the executable was deleted.
+func (p *ProcessInfo) readExeHash(hashes exeHashes) error {
+	exePath := filepath.Join("/proc/", fmt.Sprint(p.Pid), "exe")
+	file, err := os.Open(exePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	key := [2]uint64{uint64(stat.Dev), uint64(stat.Ino)}
+	if hash, ok := hashes[key]; ok {
+		p.ExeSHA256 = hash
+		return nil
+	}
+
+	h := sha256.New()
+	_, err = io.CopyBuffer(h, file, make([]byte, chunkSize))
+	if err != nil {
+		return err
+	}
+	p.ExeSHA256 = hex.EncodeToString(h.Sum(nil))
+	hashes[key] = p.ExeSHA256
+	return nil
+}
+
 // Execute the command
 func ps(cmd *cobra.Command, args []string) {
 	fh, err := os.Open("/proc")
@@ -162,6 +412,7 @@ func ps(cmd *cobra.Command, args []string) {
 
 	var processes []ProcessInfo
 	clktck, _ := sysconf.Sysconf(sysconf.SC_CLK_TCK)
+	hashes := make(exeHashes)
 
 	for _, file := range files {
 		if !file.IsDir() {
@@ -185,6 +436,20 @@ func ps(cmd *cobra.Command, args []string) {
 		new_process.readContext()
 		new_process.readEnv()
 		new_process.readCwd()
+		new_process.readExe()
+		new_process.readStatus()
+		if mapsOption {
+			new_process.readMaps()
+		}
+		if fdsOption {
+			new_process.readFileDescriptors()
+		}
+		if threadsOption {
+			new_process.readThreads()
+		}
+		if psHashOption {
+			new_process.readExeHash(hashes)
+		}
 
 		processes = append(processes, new_process)
 	}
@@ -13,6 +13,8 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+
+	"github.com/mvt-project/androidqf/utils"
 )
 
 //go:embed collector_*
@@ -85,7 +87,8 @@ func DeployAssets() (string, error) {
 	return dir, nil
 }
 
-// Remove assets from the local disk
+// Remove assets from the local disk, overwriting them first if utils.Wipe
+// is set.
 func CleanAssets() error {
 	deployMu.Lock()
 	dir := deployedDir
@@ -96,5 +99,5 @@ func CleanAssets() error {
 		return nil
 	}
 
-	return os.RemoveAll(dir)
+	return utils.RemoveAll(dir)
 }
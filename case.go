@@ -0,0 +1,38 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package main
+
+import (
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/mvt-project/androidqf/acquisition"
+)
+
+// askCase asks for the details of the case which were not given. Empty
+// answers leave them unset.
+func askCase(c *acquisition.Case) error {
+	for _, field := range []struct {
+		label string
+		dest  *string
+	}{
+		{"Case identifier", &c.ID},
+		{"Examiner", &c.Examiner},
+		{"Notes", &c.Notes},
+	} {
+		if *field.dest != "" {
+			continue
+		}
+
+		prompt := promptui.Prompt{Label: field.label}
+		value, err := prompt.Run()
+		if err != nil {
+			return err
+		}
+		*field.dest = strings.TrimSpace(value)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+
+	"filippo.io/age"
+	"github.com/mvt-project/androidqf/acquisition"
+	"github.com/mvt-project/androidqf/log"
+	"github.com/mvt-project/androidqf/utils"
+)
+
+// archiveSuffix matches the extensions of an encrypted archive, of one of its
+// volumes or of their index.
+var archiveSuffix = regexp.MustCompile(`(\.zip)?\.age(\.volumes\.json|\.[0-9]{3,})?$`)
+
+// decrypt runs "androidqf decrypt", which decrypts and extracts an encrypted
+// acquisition and verifies it against its hashes.csv. It returns the exit
+// code, which is not zero if the archive does not verify.
+func decrypt(args []string) int {
+	var identity string
+	var output string
+	var passphrase bool
+
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: androidqf decrypt --identity key.txt|--passphrase [--output folder] <archive.zip.age|volume|volume index>")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&identity, "identity", "", "File with the age private keys or an SSH private key")
+	flags.StringVar(&identity, "i", "", "File with the age private keys or an SSH private key")
+	flags.BoolVar(&passphrase, "passphrase", false, "Decrypt with a passphrase, asked for or read from "+passphraseEnv)
+	flags.StringVar(&output, "output", "", "Folder to extract to (default the archive name without .zip.age)")
+	flags.StringVar(&output, "o", "", "Folder to extract to (default the archive name without .zip.age)")
+	flags.BoolVar(&utils.Wipe, "wipe", false, "Overwrite the temporary decrypted archive before deleting it")
+	flags.Parse(args)
+
+	if (identity == "") == !passphrase || flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	identities, err := loadIdentities(identity, passphrase)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	archive := flags.Arg(0)
+	if output == "" {
+		output = archiveSuffix.ReplaceAllString(archive, "")
+		if output == archive {
+			output = archive + ".extracted"
+		}
+	}
+
+	log.Infof("Decrypting %s to %s...", archive, output)
+	verification, err := acquisition.Decrypt(archive, identities, output)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	return printVerification(verification, "hashes.csv")
+}
+
+// loadIdentities returns the identities in the identity file, or the one of
+// the passphrase.
+func loadIdentities(identity string, passphrase bool) ([]age.Identity, error) {
+	if !passphrase {
+		return acquisition.ParseIdentityFile(identity)
+	}
+
+	value, err := readPassphrase(false, false)
+	if err != nil {
+		return nil, err
+	}
+	scrypt, err := age.NewScryptIdentity(value)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Identity{scrypt}, nil
+}
+
+// printVerification lists the differences found by a verification, and
+// returns the exit code.
+func printVerification(verification *acquisition.Verification, reference string) int {
+	for _, name := range verification.Missing {
+		log.Errorf("Missing: %s", name)
+	}
+	for _, name := range verification.Extra {
+		log.Errorf("Not in %s: %s", reference, name)
+	}
+	for _, name := range verification.Mismatched {
+		log.Errorf("Hash mismatch: %s", name)
+	}
+	if !verification.OK() {
+		log.Errorf("Verification failed: %d files verified, %d missing, %d not in %s, %d mismatched",
+			verification.Verified, len(verification.Missing), len(verification.Extra), reference, len(verification.Mismatched))
+		return 1
+	}
+
+	log.Infof("All %d files verified against %s.", verification.Verified, reference)
+	return 0
+}
@@ -0,0 +1,166 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/mvt-project/androidqf/acquisition"
+	"github.com/mvt-project/androidqf/adb"
+	"github.com/mvt-project/androidqf/log"
+	"github.com/mvt-project/androidqf/modules"
+)
+
+// deviceProgress is where the acquisition of a device is at.
+type deviceProgress struct {
+	serial      string
+	done        int
+	failed      int
+	finished    bool
+	err         error
+	output      string
+	interrupted bool
+}
+
+// progress prints how the acquisitions of several devices advance, one line
+// per module, and a summary at the end.
+type progress struct {
+	mu      sync.Mutex
+	modules int
+	devices []*deviceProgress
+}
+
+// update records that a module is done, ignoring the modules starting.
+func (p *progress) update(device *deviceProgress, name string, result *acquisition.ModuleResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if result == nil {
+		return
+	}
+
+	device.done++
+	if result.Status != acquisition.ModuleCompleted && result.Status != acquisition.ModuleSkipped {
+		device.failed++
+	}
+
+	done, running := 0, 0
+	for _, d := range p.devices {
+		done += d.done
+		if !d.finished {
+			running++
+		}
+	}
+	log.Infof("[%s] %s %s (%d/%d), all devices: %d/%d modules, %d running",
+		device.serial, name, result.Status, device.done, p.modules,
+		done, p.modules*len(p.devices), running)
+}
+
+// finish records the end of the acquisition of a device.
+func (p *progress) finish(device *deviceProgress, acq *acquisition.Acquisition, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device.finished = true
+	device.err = err
+	if acq != nil {
+		device.interrupted = acq.Interrupted
+		device.output = acq.StoragePath
+		if acq.EncryptedWriter != nil {
+			device.output = acq.EncryptedWriter.GetOutputPath()
+		}
+	}
+}
+
+// summary prints the outcome of the acquisition of every device.
+func (p *progress) summary() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERIAL\tSTATUS\tMODULES\tFAILED\tOUTPUT")
+	for _, d := range p.devices {
+		status := "completed"
+		switch {
+		case d.err != nil:
+			status = fmt.Sprintf("failed: %v", d.err)
+		case d.interrupted:
+			status = "interrupted"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d/%d\t%d\t%s\n", d.serial, status, d.done, p.modules, d.failed, d.output)
+	}
+	tw.Flush()
+}
+
+// acquireAll acquires every connected device in parallel, each into a folder
+// or an encrypted archive named after the name template in the output folder,
+// and logging to the console with its serial in front.
+func acquireAll(ctx context.Context, client *adb.ADB, opts acquireOptions, verbose bool) {
+	devices, err := client.DeviceStates()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Unauthorized or offline devices can not be acquired.
+	var serials []string
+	for _, device := range devices {
+		if device.State != "device" {
+			log.Warningf("Skipping device %s, its state is %s", device.Serial, device.State)
+			continue
+		}
+		serials = append(serials, device.Serial)
+	}
+	if len(serials) == 0 {
+		log.Fatal("No devices detected over ADB")
+	}
+
+	mods, err := modules.Select(modules.List(), opts.include, opts.exclude)
+	if err != nil {
+		log.Fatal("Invalid module selection: ", err)
+	}
+	p := &progress{modules: len(mods)}
+	for _, serial := range serials {
+		p.devices = append(p.devices, &deviceProgress{serial: serial})
+	}
+	log.Infof("Acquiring %d devices in parallel...", len(serials))
+
+	var wg sync.WaitGroup
+	for _, device := range p.devices {
+		logger := log.WithPrefix(fmt.Sprintf("[%s] ", device.serial))
+		if !verbose {
+			// Only warnings and errors, the progress tells the rest.
+			logger.LogLevel = log.WARNING
+		}
+
+		deviceOpts := opts
+		if len(opts.storage.Recipients) == 0 {
+			// Each device gets its own folder in the output folder,
+			// like the encrypted archives.
+			deviceOpts.output = ""
+			deviceOpts.storage.OutputDir = opts.output
+		}
+		deviceOpts.runner.Progress = func(name string, result *acquisition.ModuleResult) {
+			p.update(device, name, result)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			acq, err := acquire(ctx, client.ForDevice(device.serial, logger), deviceOpts)
+			if err != nil {
+				logger.ErrorExc("Impossible to initialise the acquisition", err)
+			}
+			p.finish(device, acq, err)
+		}()
+	}
+	wg.Wait()
+
+	p.summary()
+}
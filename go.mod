@@ -9,9 +9,11 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/i582/cfmt v1.4.0
 	github.com/manifoldco/promptui v0.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/avast/apkparser v0.0.0-20250626104540-d53391f4d69d // indirect
 	github.com/chzyer/readline v1.5.1 // indirect
 	github.com/gookit/color v1.5.4 // indirect
@@ -36,7 +36,10 @@ type Logger struct {
 	writer       io.Writer
 	writerActive bool
 	Color        bool
-	mu           sync.Mutex
+	// Prefix starts the console messages, to tell apart the messages of
+	// concurrent acquisitions.
+	Prefix string
+	mu     sync.Mutex
 }
 
 var (
@@ -70,7 +73,22 @@ func Get() *Logger {
 	return log
 }
 
+// WithPrefix returns a Logger printing to the console like the singleton,
+// with messages starting with prefix, and logging to its own file or writer.
+func WithPrefix(prefix string) *Logger {
+	l := New()
+	l.LogLevel = log.LogLevel
+	l.Color = log.Color
+	l.Prefix = prefix
+	return l
+}
+
 func (log *Logger) out(level LEVEL, format string, v ...any) {
+	// A nil Logger is the singleton
+	if log == nil {
+		log = Get()
+	}
+
 	// Start with printing in the console
 	if level >= log.LogLevel {
 		var msg string
@@ -84,7 +102,7 @@ func (log *Logger) out(level LEVEL, format string, v ...any) {
 			msg = fmt.Sprintf("DEBUG: %s", msg)
 		}
 		// Make sure to trim end of line
-		msg = strings.TrimSuffix(msg, "\n")
+		msg = log.Prefix + strings.TrimSuffix(msg, "\n")
 		if log.Color {
 			if level > INFO {
 				cfmt.Printf("{{%s}}::red|bold\n", msg)
@@ -152,6 +170,10 @@ func Coloring(enable bool) {
 }
 
 func EnableFileLog(level LEVEL, filePath string) (func(), error) {
+	return log.EnableFileLog(level, filePath)
+}
+
+func (log *Logger) EnableFileLog(level LEVEL, filePath string) (func(), error) {
 	if filePath == "" {
 		return nil, errors.New("invalid file path")
 	}
@@ -160,17 +182,23 @@ func EnableFileLog(level LEVEL, filePath string) (func(), error) {
 	if err != nil {
 		return nil, err
 	}
+	log.mu.Lock()
 	log.fd = file
 	log.fileName = filePath
+	log.mu.Unlock()
 
 	// Return cleanup function for defer pattern
 	cleanup := func() {
-		CloseFileLog()
+		log.CloseFileLog()
 	}
 	return cleanup, nil
 }
 
 func EnableWriterLog(level LEVEL, writer io.Writer) (func(), error) {
+	return log.EnableWriterLog(level, writer)
+}
+
+func (log *Logger) EnableWriterLog(level LEVEL, writer io.Writer) (func(), error) {
 	if writer == nil {
 		return nil, errors.New("writer cannot be nil")
 	}
@@ -183,12 +211,16 @@ func EnableWriterLog(level LEVEL, writer io.Writer) (func(), error) {
 
 	// Return cleanup function for defer pattern
 	cleanup := func() {
-		CloseWriterLog()
+		log.CloseWriterLog()
 	}
 	return cleanup, nil
 }
 
 func CloseWriterLog() {
+	log.CloseWriterLog()
+}
+
+func (log *Logger) CloseWriterLog() {
 	log.mu.Lock()
 	defer log.mu.Unlock()
 	log.writerActive = false
@@ -196,6 +228,10 @@ func CloseWriterLog() {
 }
 
 func CloseFileLog() {
+	log.CloseFileLog()
+}
+
+func (log *Logger) CloseFileLog() {
 	log.mu.Lock()
 	defer log.mu.Unlock()
 	if log.fd != nil {
@@ -205,6 +241,42 @@ func CloseFileLog() {
 	}
 }
 
+func (log *Logger) Debug(v ...any) {
+	log.out(DEBUG, "%s", fmt.Sprint(v...))
+}
+
+func (log *Logger) Debugf(format string, v ...any) {
+	log.out(DEBUG, format, v...)
+}
+
+func (log *Logger) Info(v ...any) {
+	log.out(INFO, "%s", fmt.Sprint(v...))
+}
+
+func (log *Logger) Infof(format string, v ...any) {
+	log.out(INFO, format, v...)
+}
+
+func (log *Logger) Warning(v ...any) {
+	log.out(WARNING, "%s", fmt.Sprint(v...))
+}
+
+func (log *Logger) Warningf(format string, v ...any) {
+	log.out(WARNING, format, v...)
+}
+
+func (log *Logger) Error(v ...any) {
+	log.out(ERROR, "%s", fmt.Sprint(v...))
+}
+
+func (log *Logger) Errorf(format string, v ...any) {
+	log.out(ERROR, format, v...)
+}
+
+func (log *Logger) ErrorExc(desc string, err error) {
+	log.out(ERROR, "ERROR: %s: %s\n", desc, err.Error())
+}
+
 func Debug(v ...any) {
 	log.out(DEBUG, "%s", fmt.Sprint(v...))
 }
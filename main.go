@@ -6,21 +6,28 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/i582/cfmt/cmd/cfmt"
 	"github.com/mvt-project/androidqf/acquisition"
 	"github.com/mvt-project/androidqf/adb"
+	"github.com/mvt-project/androidqf/assets"
 	"github.com/mvt-project/androidqf/log"
 	"github.com/mvt-project/androidqf/modules"
 	"github.com/mvt-project/androidqf/utils"
 )
 
-func init() {
+func printBanner() {
 	cfmt.Print(`
 	{{                    __           _     __      ____ }}::green
 	{{   ____  ____  ____/ /________  (_)___/ /___  / __/ }}::yellow
@@ -39,34 +46,99 @@ func systemPause() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "decrypt":
+			printBanner()
+			os.Exit(decrypt(os.Args[2:]))
+		case "verify":
+			printBanner()
+			os.Exit(verify(os.Args[2:]))
+		}
+	}
+
 	var err error
 	var verbose bool
 	var version_flag bool
 	var list_modules bool
+	var list_format string
 	var fast bool
 	var module string
+	var skip string
 	var output_folder string
 	var serial string
 	var tcpAddr string
+	var timeout time.Duration
+	var parallel int
+	var module_timeouts string
+	var profile_path string
+	var resume_folder string
+	var all_devices bool
+	var batch bool
+	var answers acquisition.Profile
+	var encryption acquisition.Encryption
+	var passphrase bool
+	var signing_key string
+	var volume_size string
+	var name_template string
+	var ask_case bool
 
 	// Command line options
 	flag.BoolVar(&verbose, "verbose", false, "Verbose mode")
 	flag.BoolVar(&verbose, "v", false, "Verbose mode")
 	flag.BoolVar(&fast, "fast", false, "Fast mode")
-	flag.BoolVar(&verbose, "f", false, "Fast mode")
+	flag.BoolVar(&fast, "f", false, "Fast mode")
 	flag.BoolVar(&list_modules, "list", false, "List modules and exit")
 	flag.BoolVar(&list_modules, "l", false, "List modules and exit")
-	flag.StringVar(&module, "module", "", "Only execute a specific module")
-	flag.StringVar(&module, "m", "", "Only execute a specific module")
-	flag.StringVar(&output_folder, "output", "", "Output folder")
-	flag.StringVar(&output_folder, "o", "", "Output folder")
+	flag.StringVar(&list_format, "list-format", "table", "Format of the list of modules: table or json")
+	flag.StringVar(&module, "modules", "", "Only execute these modules or tags, comma-separated")
+	flag.StringVar(&module, "module", "", "Only execute these modules or tags, comma-separated")
+	flag.StringVar(&module, "m", "", "Only execute these modules or tags, comma-separated")
+	flag.StringVar(&skip, "skip", "", "Do not execute these modules or tags, comma-separated")
+	flag.StringVar(&output_folder, "output", "", "Output folder, or folder of the archive when encrypting")
+	flag.StringVar(&output_folder, "o", "", "Output folder, or folder of the archive when encrypting")
+	flag.StringVar(&name_template, "name", acquisition.DefaultNameTemplate, "Name of the acquisition folder or archive, with {uuid}, {serial}, {model}, {date}, {time} or {case}")
+	flag.StringVar(&answers.CaseID, "case-id", "", "Identifier of the case, recorded in acquisition.json")
+	flag.StringVar(&answers.Examiner, "examiner", "", "Name of the examiner, recorded in acquisition.json")
+	flag.StringVar(&answers.Notes, "notes", "", "Notes about the acquisition, recorded in acquisition.json")
+	flag.BoolVar(&ask_case, "ask-case", false, "Ask for the case identifier, examiner and notes not given as options or in the profile")
+	flag.StringVar(&resume_folder, "resume", "", "Resume the unencrypted acquisition in this folder, running only the modules it is missing")
 	flag.StringVar(&serial, "serial", "", "Phone serial number")
 	flag.StringVar(&serial, "s", "", "Phone serial number")
+	flag.BoolVar(&all_devices, "all-devices", false, "Acquire all the connected devices in parallel, each in a folder or archive named after -name")
 	flag.StringVar(&tcpAddr, "connect", "", "Connect to device over network using ip:port")
 	flag.StringVar(&tcpAddr, "c", "", "Connect to device over network using ip:port")
+	flag.IntVar(&parallel, "parallel", 1, "How many non-interactive modules to run at the same time")
+	flag.DurationVar(&timeout, "timeout", 0, "Time limit for each module, e.g. 10m (default no limit)")
+	flag.StringVar(&module_timeouts, "module-timeout", "", "Time limits for specific modules, e.g. bugreport=20m,dumpsys=5m")
+	flag.StringVar(&profile_path, "profile", "", "YAML or JSON profile answering the acquisition questions")
+	flag.BoolVar(&batch, "yes", false, "Batch mode, never wait for input and use default answers")
+	flag.BoolVar(&batch, "y", false, "Batch mode, never wait for input and use default answers")
+	flag.StringVar(&answers.Backup, "backup", "", "Backup to take: sms, everything or none")
+	flag.StringVar(&answers.APKs, "apks", "", "APKs to download: all, non-system or none")
+	flag.StringVar(&answers.RemoveTrustedAPKs, "remove-trusted-apks", "", "Remove APKs signed with a trusted certificate: yes or no")
+	flag.StringVar(&answers.IntrusionLogs, "intrusion-logs", "", "Download Intrusion Logs: yes or no")
+	flag.StringVar(&answers.IntrusionLogsWait, "intrusion-logs-wait", "", "How long to wait for new Intrusion Logs, e.g. 5m (default 15m)")
+	flag.StringVar(&answers.ProcessDetails, "process-details", "", "Slower details of the processes to collect, comma-separated: maps, fds, threads or hash")
+	flag.Func("recipient", "Also encrypt to this age or SSH public key, can be repeated", func(value string) error {
+		encryption.Recipients = append(encryption.Recipients, value)
+		return nil
+	})
+	flag.Func("recipients-file", "Also encrypt to the age or SSH public keys in this file, one per line, can be repeated", func(value string) error {
+		encryption.RecipientsFiles = append(encryption.RecipientsFiles, value)
+		return nil
+	})
+	flag.BoolVar(&passphrase, "passphrase", false, "Encrypt with a passphrase, asked for or read from "+passphraseEnv)
+	flag.StringVar(&volume_size, "volume-size", "", "Split the encrypted archive into volumes of at most this size, e.g. 3900M for FAT32 drives")
+	flag.BoolVar(&utils.Wipe, "wipe", false, "Overwrite the unencrypted files androidqf deletes, such as the acquisition folder once encrypted, before deleting them")
+	flag.StringVar(&signing_key, "signing-key", "", "ed25519 private key in PEM format signing the manifest of the acquisitions")
 	flag.BoolVar(&version_flag, "version", false, "Show version")
 
 	flag.Parse()
+	// Keep the JSON list of modules parseable.
+	if !list_modules || list_format != "json" {
+		printBanner()
+	}
 	if verbose {
 		log.SetLogLevel(log.DEBUG)
 	}
@@ -76,107 +148,324 @@ func main() {
 		os.Exit(0)
 	}
 
+	timeouts, err := modules.ParseTimeouts(module_timeouts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	profile, err := loadProfile(profile_path, &answers, batch)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if list_modules {
-		mods := modules.List()
-		log.Info("List of modules:")
-		for _, mod := range mods {
-			log.Infof("- %s", mod.Name())
+		err = printModules(os.Stdout, list_format)
+		if err != nil {
+			log.Fatal(err)
 		}
 		os.Exit(0)
 	}
 
+	// Check the selection now, each acquisition selects its own instances.
+	include, exclude := modules.SplitList(module), modules.SplitList(skip)
+	_, err = modules.Select(modules.List(), include, exclude)
+	if err != nil {
+		log.Fatal("Invalid module selection: ", err)
+	}
+	if resume_folder != "" && output_folder != "" {
+		log.Fatal("-resume and -output cannot be used together")
+	}
+	if all_devices && (resume_folder != "" || serial != "") {
+		log.Fatal("-all-devices cannot be used with -resume or -serial")
+	}
+	if parallel < 1 {
+		log.Fatal("-parallel must be at least 1")
+	}
+
+	if passphrase {
+		encryption.Passphrase, err = readPassphrase(profile.IsBatch(), true)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = acquisition.CheckNameTemplate(name_template)
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage := acquisition.Options{NameTemplate: name_template, Case: profile.Case()}
+	if ask_case && !profile.IsBatch() {
+		err = askCase(&storage.Case)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	storage.Recipients, err = encryption.Parse()
+	if err != nil {
+		log.Fatal("Invalid encryption settings: ", err)
+	}
+	if volume_size != "" {
+		storage.VolumeSize, err = acquisition.ParseSize(volume_size)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if storage.VolumeSize < acquisition.MinVolumeSize {
+			log.Fatalf("The volume size must be at least %d bytes", acquisition.MinVolumeSize)
+		}
+		if len(storage.Recipients) == 0 {
+			log.Fatal("-volume-size only applies to encrypted acquisitions")
+		}
+	}
+	var signingKey ed25519.PrivateKey
+	if signing_key != "" {
+		signingKey, err = acquisition.LoadSigningKey(signing_key)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	log.Debug("Starting androidqf")
-	adb.Client, err = adb.New()
+	client, err := adb.New()
 	if err != nil {
 		log.Fatal("Impossible to initialize ADB: ", err)
 	}
 
 	if tcpAddr != "" {
 		log.Infof("Attempting to connect to %s over network...", tcpAddr)
-		out, err := adb.Client.Exec("connect", tcpAddr)
+		out, err := client.Connect(tcpAddr)
 		if err != nil {
 			log.Error(fmt.Sprintf("Failed to connect to %s: %v", tcpAddr, err))
 		} else {
-			log.Infof("ADB connect output: %s", strings.TrimSpace(string(out)))
+			log.Infof("ADB connect output: %s", out)
 			// If no serial was explicitly provided, use the ip:port as the serial
-			if serial == "" {
+			if serial == "" && !all_devices {
 				serial = tcpAddr
 			}
 		}
 	}
 
-	// Initialization
-	for {
-		serial, err = adb.Client.SetSerial(serial)
+	// Ctrl+C aborts the running modules, the acquisitions are still finalized.
+	ctx, stopInterrupts := modules.HandleInterrupts(context.Background())
+
+	opts := acquireOptions{
+		output:     output_folder,
+		include:    include,
+		exclude:    exclude,
+		profile:    profile,
+		storage:    storage,
+		signingKey: signingKey,
+		runner: modules.Runner{
+			Fast:     fast,
+			Parallel: parallel,
+			Timeout:  timeout,
+			Timeouts: timeouts,
+		},
+	}
+
+	if all_devices {
+		if !profile.IsBatch() {
+			log.Info("Acquiring several devices: questions are answered from the profile or with their default answer.")
+			profile.Batch = true
+		}
+		acquireAll(ctx, client, opts, verbose)
+	} else {
+		// Initialization
+		_, err = client.WaitForDevice(ctx, serial)
 		if err != nil {
-			log.Error(fmt.Sprintf("Error trying to connect over ADB: %s", err))
-		} else {
-			_, err = adb.Client.GetState()
-			if err == nil {
-				break
-			}
-			log.Debug(err)
-			log.Error("Unable to get device state. Please make sure it is connected and authorized. Trying again in 5 seconds...")
+			log.Fatal(err)
+		}
+
+		opts.resume = resume_folder
+		_, err = acquire(ctx, client, opts)
+		if err != nil {
+			log.FatalExc("Impossible to initialise the acquisition", err)
 		}
-		time.Sleep(5 * time.Second)
 	}
+	stopInterrupts()
 
-	acq, err := acquisition.New(output_folder)
-	if err != nil {
-		log.Debug(err)
-		log.FatalExc("Impossible to initialise the acquisition", err)
+	// Stop ADB server before trying to remove extracted assets
+	client.KillServer()
+	assets.CleanAssets()
+	log.Info("Acquisition completed.")
+
+	if !profile.IsBatch() {
+		systemPause()
 	}
+}
+
+// acquireOptions are the settings of the acquisition of a device.
+type acquireOptions struct {
+	output  string
+	resume  string
+	include []string
+	exclude []string
+	profile *acquisition.Profile
+	// storage is how the acquisition is encrypted, if it is.
+	storage acquisition.Options
+	// signingKey, if set, signs the manifest of the acquisition.
+	signingKey ed25519.PrivateKey
+	runner     modules.Runner
+}
 
-	// Start acquisitions
-	log.Info(fmt.Sprintf("Started new acquisition in %s", acq.StoragePath))
+// acquire runs the selected modules against the device of the client and
+// finalizes the acquisition. The error is returned if the acquisition could
+// not be started, failed modules are only recorded.
+func acquire(ctx context.Context, client *adb.ADB, opts acquireOptions) (*acquisition.Acquisition, error) {
+	mods, err := modules.Select(modules.List(), opts.include, opts.exclude)
+	if err != nil {
+		return nil, err
+	}
 
-	mods := modules.List()
-	for _, mod := range mods {
-		if (module != "") && (module != mod.Name()) {
-			continue
+	var acq *acquisition.Acquisition
+	if opts.resume != "" {
+		acq, err = acquisition.Resume(client, opts.resume, opts.storage)
+		if err != nil {
+			return nil, err
 		}
-		err = mod.InitStorage(acq.StoragePath)
+		mods = slices.DeleteFunc(mods, func(mod modules.Module) bool {
+			return !acq.Pending(mod.Name())
+		})
+		acq.Log.Info(fmt.Sprintf("Resumed acquisition in %s, %d modules to run", acq.StoragePath, len(mods)))
+	} else {
+		acq, err = acquisition.New(client, opts.output, opts.storage)
 		if err != nil {
-			log.Infof(
-				"ERROR: failed to initialize storage for module %s: %v",
-				mod.Name(),
-				err,
-			)
-			continue
+			return nil, err
 		}
+		// Start acquisitions
+		if acq.StreamingMode {
+			acq.Log.Info(fmt.Sprintf("Started new acquisition in %s", acq.EncryptedWriter.GetOutputPath()))
+		} else {
+			acq.Log.Info(fmt.Sprintf("Started new acquisition in %s", acq.StoragePath))
+		}
+	}
 
-		err = mod.Run(acq, fast)
-		if err != nil {
-			log.Infof("ERROR: failed to run module %s: %v", mod.Name(), err)
+	acq.Profile = opts.profile
+	acq.SigningKey = opts.signingKey
+
+	runner := opts.runner
+	runner.Device = client
+	if runner.Run(ctx, acq, mods) != nil {
+		acq.Log.Warningf("Acquisition interrupted during module %s, finalizing what was collected so far.", acq.InterruptedIn)
+	}
+	for _, info := range modules.Registered() {
+		if _, ok := acq.Result(info.Name); !ok {
+			acq.AddModuleResult(acquisition.ModuleResult{
+				Name:   info.Name,
+				Status: acquisition.ModuleSkipped,
+				Note:   acquisition.NoteNotSelected,
+			})
 		}
 	}
 
 	if acq.StreamingMode {
 		// In streaming mode, all data is already encrypted in the zip stream
-		log.Info("Finalizing encrypted acquisition...")
+		acq.Log.Info("Finalizing encrypted acquisition...")
 	} else {
-		// Traditional mode: hash files, then encrypt if key exists
-		err = acq.HashFiles()
-		if err != nil {
-			log.ErrorExc("Failed to generate list of file hashes", err)
-			return
-		}
+		storeAcquisition(acq)
+	}
 
-		err = acq.StoreInfo()
-		if err != nil {
-			log.ErrorExc("Failed to store acquisition info", err)
-			return
+	acq.Complete()
+	return acq, nil
+}
+
+// storeAcquisition hashes the files of a traditional mode acquisition, signs
+// its manifest if a signing key was given, then encrypts it if a key exists.
+func storeAcquisition(acq *acquisition.Acquisition) {
+	err := acq.HashFiles()
+	if err != nil {
+		acq.Log.ErrorExc("Failed to generate list of file hashes", err)
+		return
+	}
+
+	err = acq.StoreInfo()
+	if err != nil {
+		acq.Log.ErrorExc("Failed to store acquisition info", err)
+		return
+	}
+
+	err = acq.StoreManifest()
+	if err != nil {
+		acq.Log.ErrorExc("Failed to store the signed manifest", err)
+	}
+
+	err = acq.StoreSecurely()
+	if err != nil {
+		acq.Log.ErrorExc("Something failed while encrypting the acquisition", err)
+		acq.Log.Warning("WARNING: The secure storage of the acquisition folder failed! The data is unencrypted!")
+	}
+}
+
+// printModules writes the description of the modules as a table or JSON.
+func printModules(w io.Writer, format string) error {
+	infos := modules.Registered()
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(infos)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tDURATION\tINTERACTIVE\tCOLLECTOR\tTAGS\tOUTPUTS\tDESCRIPTION")
+		for _, info := range infos {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				info.Name,
+				info.Duration,
+				yesNo(info.Interactive),
+				yesNo(info.NeedsCollector),
+				strings.Join(info.Tags, ","),
+				strings.Join(info.Outputs, ", "),
+				info.Description,
+			)
 		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown list format %q, expected table or json", format)
+	}
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
 
-		err = acq.StoreSecurely()
+// loadProfile reads the profile file, if any, and overrides its answers with
+// the ones given on the command line.
+func loadProfile(path string, answers *acquisition.Profile, batch bool) (*acquisition.Profile, error) {
+	profile := &acquisition.Profile{}
+	if path != "" {
+		var err error
+		profile, err = acquisition.LoadProfile(path)
 		if err != nil {
-			log.ErrorExc("Something failed while encrypting the acquisition", err)
-			log.Warning("WARNING: The secure storage of the acquisition folder failed! The data is unencrypted!")
+			return nil, err
 		}
 	}
 
-	acq.Complete()
-	log.Info("Acquisition completed.")
+	if batch {
+		profile.Batch = true
+	}
+	for _, override := range []struct {
+		value string
+		dest  *string
+	}{
+		{answers.Backup, &profile.Backup},
+		{answers.APKs, &profile.APKs},
+		{answers.RemoveTrustedAPKs, &profile.RemoveTrustedAPKs},
+		{answers.IntrusionLogs, &profile.IntrusionLogs},
+		{answers.IntrusionLogsWait, &profile.IntrusionLogsWait},
+		{answers.ProcessDetails, &profile.ProcessDetails},
+		{answers.CaseID, &profile.CaseID},
+		{answers.Examiner, &profile.Examiner},
+		{answers.Notes, &profile.Notes},
+	} {
+		if override.value != "" {
+			*override.dest = override.value
+		}
+	}
 
-	systemPause()
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
 }
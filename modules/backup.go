@@ -6,25 +6,32 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
-	"github.com/manifoldco/promptui"
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 const (
-	backupOnlySMS    = "Only SMS"
-	backupEverything = "Everything"
-	backupNothing    = "No backup"
+	backupOnlySMS    = "sms"
+	backupEverything = "everything"
+	backupNothing    = "none"
 )
 
 type Backup struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Takes an adb backup of the SMS and MMS messages or of all apps allowing it.",
+		Duration:    "1-10 minutes",
+		Outputs:     []string{"backup.ab"},
+		New:         func() Module { return NewBackup() },
+	})
+}
+
 func NewBackup() *Backup {
 	return &Backup{}
 }
@@ -33,18 +40,23 @@ func (b *Backup) Name() string {
 	return "backup"
 }
 
+func (b *Backup) Tags() []string {
+	return []string{TagInteractive, TagHeavy}
+}
+
 func (b *Backup) InitStorage(storagePath string) error {
 	b.StoragePath = storagePath
 	return nil
 }
 
-func (b *Backup) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Would you like to take a backup of the device?")
-	promptBackup := promptui.Select{
-		Label: "Backup",
-		Items: []string{backupOnlySMS, backupEverything, backupNothing},
-	}
-	_, backupOption, err := promptBackup.Run()
+func (b *Backup) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	backupOption, err := ask(acq, acquisition.AnswerBackup,
+		"Would you like to take a backup of the device?", "Backup",
+		[]choice{
+			{backupOnlySMS, "Only SMS"},
+			{backupEverything, "Everything"},
+			{backupNothing, "No backup"},
+		}, backupNothing)
 	if err != nil {
 		return fmt.Errorf("failed to make selection for backup option: %v", err)
 	}
@@ -59,28 +71,28 @@ func (b *Backup) Run(acq *acquisition.Acquisition, fast bool) error {
 		return nil
 	}
 
-	log.Infof(
+	acq.Log.Infof(
 		"Generating a backup with argument %s. Please check the device to authorize the backup...\n",
 		arg,
 	)
 
 	if acq.StreamingMode && acq.EncryptedWriter != nil {
 		// Streaming mode: stream backup directly to encrypted zip without temp files
-		err = acq.StreamBackupToZip(arg, "backup.ab")
+		err = acq.StreamBackupToZip(ctx, arg, "backup.ab")
 		if err != nil {
 			return fmt.Errorf("failed to stream backup to encrypted archive: %v", err)
 		}
 	} else {
 		// Traditional mode: write backup directly into acquisition directory
 		backupPath := filepath.Join(b.StoragePath, "backup.ab")
-		err = adb.Client.Backup(backupPath, arg)
+		err = acq.Client.BackupContext(ctx, backupPath, arg)
 		if err != nil {
-			log.Debugf("Impossible to get backup: %v", err)
+			acq.Log.Debugf("Impossible to get backup: %v", err)
 			return err
 		}
 	}
 
-	log.Info("Backup completed!")
+	acq.Log.Info("Backup completed!")
 
 	return nil
 }
@@ -6,18 +6,26 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Bugreport struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Generates a bug report with system and app logs.",
+		Duration:    "2-10 minutes",
+		Outputs:     []string{"bugreport.zip"},
+		New:         func() Module { return NewBugreport() },
+	})
+}
+
 func NewBugreport() *Bugreport {
 	return &Bugreport{}
 }
@@ -26,33 +34,37 @@ func (b *Bugreport) Name() string {
 	return "bugreport"
 }
 
+func (b *Bugreport) Tags() []string {
+	return []string{TagHeavy}
+}
+
 func (b *Bugreport) InitStorage(storagePath string) error {
 	b.StoragePath = storagePath
 	return nil
 }
 
-func (b *Bugreport) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info(
+func (b *Bugreport) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info(
 		"Generating a bugreport for the device...",
 	)
 
 	if acq.StreamingMode && acq.EncryptedWriter != nil {
 		// Streaming mode: stream bugreport directly to encrypted zip without temp files
-		err := acq.StreamBugreportToZip("bugreport.zip")
+		err := acq.StreamBugreportToZip(ctx, "bugreport.zip")
 		if err != nil {
 			return fmt.Errorf("failed to stream bugreport to encrypted archive: %v", err)
 		}
 	} else {
 		// Traditional mode: write directly into acquisition dir.
 		bugreportPath := filepath.Join(b.StoragePath, "bugreport.zip")
-		err := adb.Client.Bugreport(bugreportPath)
+		err := acq.Client.BugreportContext(ctx, bugreportPath)
 		if err != nil {
-			log.Debugf("Impossible to generate bugreport: %v", err)
+			acq.Log.Debugf("Impossible to generate bugreport: %v", err)
 			return err
 		}
 	}
 
-	log.Debug("Bugreport completed!")
+	acq.Log.Debug("Bugreport completed!")
 
 	return nil
 }
@@ -0,0 +1,193 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mvt-project/androidqf/acquisition"
+)
+
+var (
+	// parcelWord matches the 32-bit words printed by `service call`.
+	parcelWord = regexp.MustCompile(`^[0-9a-fA-F]{8}$`)
+	imeiValue  = regexp.MustCompile(`^[0-9]{14,16}$`)
+)
+
+type DeviceInfo struct {
+	StoragePath string
+}
+
+func init() {
+	Register(Info{
+		Description: "Collects the identity and security state of the device (model, build, patch level, bootloader, encryption).",
+		Duration:    "seconds",
+		Outputs:     []string{"device_info.json"},
+		New:         func() Module { return NewDeviceInfo() },
+	})
+}
+
+func NewDeviceInfo() *DeviceInfo {
+	return &DeviceInfo{}
+}
+
+func (d *DeviceInfo) Name() string {
+	return "device_info"
+}
+
+func (d *DeviceInfo) Tags() []string {
+	return []string{TagQuick}
+}
+
+func (d *DeviceInfo) InitStorage(storagePath string) error {
+	d.StoragePath = storagePath
+	return nil
+}
+
+func (d *DeviceInfo) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting device information...")
+
+	res, err := acq.Client.RunShellContext(ctx, "getprop")
+	if err != nil {
+		return fmt.Errorf("failed to run `adb shell getprop`: %v", err)
+	}
+	info := deviceInfoFromProps(parseProps(res.Stdout))
+	if info.Serial == "" {
+		info.Serial = acq.Serial
+	}
+
+	res, err = acq.Client.RunShellContext(ctx, "cat /proc/uptime")
+	if err != nil {
+		acq.Log.Debugf("Failed to get the uptime of the device: %v", err)
+	} else if uptime, ok := parseUptime(res.Stdout); ok {
+		info.UptimeSeconds = int64(uptime.Seconds())
+		info.BootTime = time.Now().UTC().Add(-uptime).Truncate(time.Second)
+	}
+
+	// getDeviceId, only allowed to the shell on older versions of Android.
+	res, err = acq.Client.RunShellContext(ctx, "service call iphonesubinfo 1 s16 com.android.shell")
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		acq.Log.Debugf("Failed to call iphonesubinfo: %v", err)
+		info.IMEIStatus = acquisition.IMEIUnavailable
+	} else {
+		info.IMEI, info.IMEIStatus = parseIMEI(res.Stdout)
+	}
+
+	acq.SetDevice(info.Summary())
+	return saveDataToAcquisition(acq, "device_info.json", info)
+}
+
+// deviceInfoFromProps fills the device information found in the properties.
+func deviceInfoFromProps(props map[string]string) *acquisition.DeviceInfo {
+	// first returns the first of the properties which is set.
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := strings.TrimSpace(props[key]); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	info := &acquisition.DeviceInfo{
+		Manufacturer:      first("ro.product.manufacturer", "ro.product.vendor.manufacturer"),
+		Brand:             first("ro.product.brand", "ro.product.vendor.brand"),
+		Model:             first("ro.product.model", "ro.product.vendor.model"),
+		Device:            first("ro.product.device", "ro.product.vendor.device"),
+		Serial:            first("ro.serialno", "ro.boot.serialno"),
+		ABI:               first("ro.product.cpu.abi"),
+		Fingerprint:       first("ro.build.fingerprint", "ro.system.build.fingerprint", "ro.vendor.build.fingerprint"),
+		AndroidVersion:    first("ro.build.version.release_or_codename", "ro.build.version.release"),
+		SecurityPatch:     first("ro.build.version.security_patch"),
+		VerifiedBootState: first("ro.boot.verifiedbootstate"),
+		EncryptionState:   first("ro.crypto.state"),
+		EncryptionType:    first("ro.crypto.type"),
+		Timezone:          first("persist.sys.timezone"),
+	}
+	info.SDK, _ = strconv.Atoi(first("ro.build.version.sdk"))
+
+	switch first("ro.boot.flash.locked", "ro.boot.vbmeta.device_state") {
+	case "1", "locked":
+		info.BootloaderState = "locked"
+	case "0", "unlocked":
+		info.BootloaderState = "unlocked"
+	}
+
+	return info
+}
+
+// parseUptime returns the uptime in the content of /proc/uptime.
+func parseUptime(out string) (time.Duration, bool) {
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(math.Round(seconds*1000)) * time.Millisecond, true
+}
+
+// parseIMEI returns the IMEI in the parcel printed by `service call
+// iphonesubinfo`, and its status. The parcel starts with the exception code,
+// then the length of the string and its UTF-16 characters, two per word.
+func parseIMEI(out string) (string, string) {
+	_, parcel, ok := strings.Cut(out, "Result: Parcel(")
+	if !ok {
+		return "", acquisition.IMEIUnavailable
+	}
+
+	var words []uint32
+	for _, line := range strings.Split(parcel, "\n") {
+		// Skip the offset at the start and the text at the end.
+		if _, rest, ok := strings.Cut(line, ": "); ok && strings.HasPrefix(strings.TrimSpace(line), "0x") {
+			line = rest
+		}
+		line, _, _ = strings.Cut(line, "'")
+		for _, field := range strings.Fields(line) {
+			if !parcelWord.MatchString(field) {
+				continue
+			}
+			word, _ := strconv.ParseUint(field, 16, 32)
+			words = append(words, uint32(word))
+		}
+	}
+
+	if len(words) == 0 {
+		return "", acquisition.IMEIUnavailable
+	}
+	if words[0] != 0 {
+		// An exception, such as a SecurityException.
+		return "", acquisition.IMEIDenied
+	}
+	if len(words) < 2 || int32(words[1]) <= 0 {
+		return "", acquisition.IMEIUnavailable
+	}
+
+	length := int(words[1])
+	var imei strings.Builder
+	for _, word := range words[2:] {
+		for _, char := range []uint32{word & 0xffff, word >> 16} {
+			if imei.Len() < length {
+				imei.WriteRune(rune(char))
+			}
+		}
+	}
+	if !imeiValue.MatchString(imei.String()) {
+		return "", acquisition.IMEIUnavailable
+	}
+	return imei.String(), acquisition.IMEIAvailable
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mvt-project/androidqf/acquisition"
+)
+
+func TestDeviceInfoFromProps(t *testing.T) {
+	props := parseProps(`[ro.boot.flash.locked]: [1]
+[ro.boot.verifiedbootstate]: [green]
+[ro.build.fingerprint]: [google/husky/husky:15/AP4A.250105.002/12701944:user/release-keys]
+[ro.build.version.release]: [15]
+[ro.build.version.sdk]: [35]
+[ro.build.version.security_patch]: [2025-01-05]
+[ro.crypto.state]: [encrypted]
+[ro.crypto.type]: [file]
+[ro.product.manufacturer]: [Google]
+[ro.product.model]: [Pixel 8 Pro]
+[persist.sys.timezone]: [Europe/Berlin]
+`)
+
+	info := deviceInfoFromProps(props)
+	want := acquisition.DeviceInfo{
+		Manufacturer:      "Google",
+		Model:             "Pixel 8 Pro",
+		Fingerprint:       "google/husky/husky:15/AP4A.250105.002/12701944:user/release-keys",
+		AndroidVersion:    "15",
+		SDK:               35,
+		SecurityPatch:     "2025-01-05",
+		BootloaderState:   "locked",
+		VerifiedBootState: "green",
+		EncryptionState:   "encrypted",
+		EncryptionType:    "file",
+		Timezone:          "Europe/Berlin",
+	}
+	if *info != want {
+		t.Fatalf("deviceInfoFromProps() = %+v, want %+v", *info, want)
+	}
+}
+
+func TestParseUptime(t *testing.T) {
+	uptime, ok := parseUptime("35123.45 139000.12\n")
+	if !ok || uptime != 35123450*time.Millisecond {
+		t.Fatalf("parseUptime() = %s, %v", uptime, ok)
+	}
+	if _, ok := parseUptime("cat: /proc/uptime: Permission denied"); ok {
+		t.Fatal("parseUptime() of an error succeeded")
+	}
+}
+
+func TestParseIMEI(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    string
+		imei   string
+		status string
+	}{
+		{
+			name: "available",
+			out: `Result: Parcel(
+  0x00000000: 00000000 0000000f 00350033 00340035 '........3.5.5.4.'
+  0x00000010: 00300030 00300031 00300030 00300030 '0.0.1.0.0.0.0.0.'
+  0x00000020: 00300030 00000031                   '0.0.1...        ')
+`,
+			imei:   "355400100000001",
+			status: acquisition.IMEIAvailable,
+		},
+		{
+			name: "denied",
+			out: `Result: Parcel(
+  0x00000000: ffffffff 0000004e 00650052 00750071 '....N...R.e.q.u.'
+  0x00000010: 00720069 00640065 00720020 00610065 'i.r.e.d. .r.e.a.')
+`,
+			status: acquisition.IMEIDenied,
+		},
+		{
+			name:   "null",
+			out:    "Result: Parcel(00000000 ffffffff   '........')\n",
+			status: acquisition.IMEIUnavailable,
+		},
+		{
+			name:   "no service",
+			out:    "service: Service iphonesubinfo does not exist\n",
+			status: acquisition.IMEIUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imei, status := parseIMEI(tt.out)
+			if imei != tt.imei || status != tt.status {
+				t.Fatalf("parseIMEI() = %q, %q, want %q, %q", imei, status, tt.imei, tt.status)
+			}
+		})
+	}
+}
@@ -5,37 +5,243 @@
 package modules
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/mvt-project/androidqf/acquisition"
 	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
+// DefaultDumpsysServiceTimeout is how long a single service can take to dump.
+const DefaultDumpsysServiceTimeout = 2 * time.Minute
+
+// dumpsysPriority are the services dumped first in fast mode, the most
+// useful ones for an analysis.
+var dumpsysPriority = []string{
+	"package", "activity", "batterystats", "appops", "dbinfo",
+	"usagestats", "accessibility", "notification",
+}
+
+// dumpsysSeparator precedes every service in dumpsys.txt, as in the output
+// of dumpsys without arguments.
+const dumpsysSeparator = "-------------------------------------------------------------------------------"
+
+// unsafeServiceChars are replaced in the file names of the services, such
+// as "android.hardware.power.IPower/default".
+var unsafeServiceChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
 type Dumpsys struct {
 	StoragePath string
+	DumpsysPath string
+	// ServiceTimeout limits the time taken by each service.
+	ServiceTimeout time.Duration
+}
+
+// DumpsysService is the outcome of dumping a service, recorded in
+// dumpsys.json.
+type DumpsysService struct {
+	Name string `json:"name"`
+	// File is the output of the service, relative to the acquisition.
+	File string `json:"file,omitempty"`
+	// Status is one of acquisition.ModuleCompleted, ModuleFailed,
+	// ModuleTimedOut or ModuleInterrupted.
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+func init() {
+	Register(Info{
+		Description: "Collects the diagnostic output of each system service.",
+		Duration:    "1-5 minutes",
+		Outputs:     []string{"dumpsys/", "dumpsys.json", "dumpsys.txt"},
+		New:         func() Module { return NewDumpsys() },
+	})
 }
 
 func NewDumpsys() *Dumpsys {
-	return &Dumpsys{}
+	return &Dumpsys{ServiceTimeout: DefaultDumpsysServiceTimeout}
 }
 
 func (d *Dumpsys) Name() string {
 	return "dumpsys"
 }
 
+func (d *Dumpsys) Tags() []string {
+	return []string{TagHeavy}
+}
+
 func (d *Dumpsys) InitStorage(storagePath string) error {
 	d.StoragePath = storagePath
+	d.DumpsysPath = filepath.Join(storagePath, "dumpsys")
+
+	// Only create directory in traditional mode
+	if storagePath != "" {
+		err := os.Mkdir(d.DumpsysPath, 0o755)
+		if err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to create dumpsys folder: %v", err)
+		}
+	}
+
 	return nil
 }
 
-func (d *Dumpsys) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting device diagnostic information. This might take a while...")
+func (d *Dumpsys) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting device diagnostic information. This might take a while...")
 
-	out, err := adb.Client.Shell("dumpsys")
+	res, err := acq.Client.RunShellContext(ctx, "dumpsys -l")
 	if err != nil {
-		return fmt.Errorf("failed to run `adb shell dumpsys`: %v", err)
+		return fmt.Errorf("failed to run `adb shell dumpsys -l`: %v", err)
+	}
+	services := parseDumpsysList(res.Stdout)
+	if len(services) == 0 {
+		return fmt.Errorf("`adb shell dumpsys -l` listed no services")
+	}
+	if fast {
+		services = prioritizeServices(services, dumpsysPriority)
+	}
+
+	var results []DumpsysService
+	// combined is the output of all the services in one file, with the
+	// headers of dumpsys that analysis tools such as MVT look for.
+	var combined strings.Builder
+	files := dumpsysFileNames(services)
+	failed := 0
+	for _, service := range services {
+		if ctx.Err() != nil {
+			break
+		}
+		result, out := d.dumpService(ctx, acq, service, files[service])
+		if result.Status != acquisition.ModuleCompleted {
+			acq.Log.Debugf("Failed to dump service %s: %s", service, result.Error)
+			failed++
+		}
+		results = append(results, result)
+		if out != "" {
+			combined.WriteString(dumpsysSection(service, out))
+		}
 	}
 
-	return saveStringToAcquisition(acq, "dumpsys.txt", out)
+	err = saveStringToAcquisition(acq, "dumpsys.txt", combined.String())
+	if err != nil {
+		return err
+	}
+	err = saveDataToAcquisition(acq, "dumpsys.json", results)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		acq.Log.Warningf("%d of %d services failed to dump, see dumpsys.json", failed, len(services))
+	}
+	return nil
+}
+
+// dumpService saves the output of the service to file, even if incomplete,
+// and returns it.
+func (d *Dumpsys) dumpService(ctx context.Context, acq *acquisition.Acquisition, service, file string) (DumpsysService, string) {
+	result := DumpsysService{Name: service, Status: acquisition.ModuleCompleted}
+	start := time.Now()
+
+	serviceCtx := ctx
+	if d.ServiceTimeout > 0 {
+		var cancel context.CancelFunc
+		serviceCtx, cancel = context.WithTimeout(ctx, d.ServiceTimeout)
+		defer cancel()
+	}
+
+	// Quote the name, some contain characters such as "/".
+	res, err := acq.Client.RunShellContext(serviceCtx, "dumpsys", adb.Quote(service))
+	result.Duration = time.Since(start).Round(time.Millisecond).Seconds()
+	switch {
+	case ctx.Err() != nil:
+		result.Status = acquisition.ModuleInterrupted
+		result.Error = ctx.Err().Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Status = acquisition.ModuleTimedOut
+		result.Error = fmt.Sprintf("timed out after %s", d.ServiceTimeout)
+	case err != nil:
+		// A non-zero exit status still leaves an output worth keeping.
+		result.Status = acquisition.ModuleFailed
+		result.Error = err.Error()
+	}
+	if res == nil || strings.TrimSpace(res.Stdout) == "" {
+		return result, ""
+	}
+
+	out := strings.TrimSpace(res.Stdout)
+	result.File = file
+	err = saveStringToAcquisition(acq, result.File, out)
+	if err != nil {
+		result.File = ""
+		result.Status = acquisition.ModuleFailed
+		result.Error = err.Error()
+	}
+	return result, out
+}
+
+// dumpsysSection returns the output of a service as in the output of dumpsys
+// without arguments.
+func dumpsysSection(service, out string) string {
+	return fmt.Sprintf("%s\nDUMP OF SERVICE %s:\n%s\n", dumpsysSeparator, service, out)
+}
+
+// dumpsysFileNames returns the output file of each service, relative to
+// the acquisition. Names which are the same once made safe get a number.
+func dumpsysFileNames(services []string) map[string]string {
+	files := make(map[string]string, len(services))
+	used := make(map[string]bool, len(services))
+	for _, service := range services {
+		base := unsafeServiceChars.ReplaceAllString(service, "_")
+		name := base
+		for i := 2; used[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[strings.ToLower(name)] = true
+		files[service] = path.Join("dumpsys", name+".txt")
+	}
+	return files
+}
+
+// parseDumpsysList returns the services in the output of `dumpsys -l`.
+func parseDumpsysList(out string) []string {
+	var services []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		// Skip the "Currently running services:" header.
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		if !slices.Contains(services, line) {
+			services = append(services, line)
+		}
+	}
+	return services
+}
+
+// prioritizeServices moves the priority services to the front, in the order
+// of the priority list.
+func prioritizeServices(services, priority []string) []string {
+	var ordered []string
+	for _, service := range priority {
+		if slices.Contains(services, service) {
+			ordered = append(ordered, service)
+		}
+	}
+	for _, service := range services {
+		if !slices.Contains(ordered, service) {
+			ordered = append(ordered, service)
+		}
+	}
+	return ordered
 }
@@ -0,0 +1,61 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseDumpsysList(t *testing.T) {
+	services := parseDumpsysList("Currently running services:\n" +
+		"  DockObserver\n" +
+		"  activity\n" +
+		"  android.hardware.power.IPower/default\n" +
+		"  activity\n" +
+		"  it's\n" +
+		"  package\n")
+
+	want := []string{"DockObserver", "activity", "android.hardware.power.IPower/default", "it's", "package"}
+	if !slices.Equal(services, want) {
+		t.Fatalf("parseDumpsysList() = %q, want %q", services, want)
+	}
+}
+
+func TestPrioritizeServices(t *testing.T) {
+	services := []string{"DockObserver", "activity", "wifi", "package", "notification"}
+	got := prioritizeServices(services, dumpsysPriority)
+
+	want := []string{"package", "activity", "notification", "DockObserver", "wifi"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("prioritizeServices() = %q, want %q", got, want)
+	}
+}
+
+func TestDumpsysFileNames(t *testing.T) {
+	files := dumpsysFileNames([]string{"activity", "vendor/foo", "vendor_foo", "Activity"})
+
+	want := map[string]string{
+		"activity":   "dumpsys/activity.txt",
+		"vendor/foo": "dumpsys/vendor_foo.txt",
+		"vendor_foo": "dumpsys/vendor_foo-2.txt",
+		"Activity":   "dumpsys/Activity-2.txt",
+	}
+	if !maps.Equal(files, want) {
+		t.Fatalf("dumpsysFileNames() = %q, want %q", files, want)
+	}
+}
+
+func TestDumpsysSection(t *testing.T) {
+	got := dumpsysSection("package", "Packages:\n  Package [com.android.shell]")
+
+	want := "-------------------------------------------------------------------------------\n" +
+		"DUMP OF SERVICE package:\n" +
+		"Packages:\n  Package [com.android.shell]\n"
+	if got != want {
+		t.Fatalf("dumpsysSection() = %q, want %q", got, want)
+	}
+}
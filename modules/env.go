@@ -5,17 +5,26 @@
 package modules
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Environment struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Collects the environment variables of the adb shell.",
+		Duration:    "seconds",
+		Outputs:     []string{"env.txt", "env.json"},
+		New:         func() Module { return NewEnvironment() },
+	})
+}
+
 func NewEnvironment() *Environment {
 	return &Environment{}
 }
@@ -24,18 +33,27 @@ func (e *Environment) Name() string {
 	return "environment"
 }
 
+func (e *Environment) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (e *Environment) InitStorage(storagePath string) error {
 	e.StoragePath = storagePath
 	return nil
 }
 
-func (e *Environment) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting environment...")
+func (e *Environment) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting environment...")
 
-	out, err := adb.Client.Shell("env")
+	res, err := acq.Client.RunShellContext(ctx, "env")
 	if err != nil {
 		return fmt.Errorf("failed to run `adb shell env`: %v", err)
 	}
 
-	return saveStringToAcquisition(acq, "env.txt", out)
+	err = saveStringToAcquisition(acq, "env.txt", strings.TrimSpace(res.Stdout))
+	if err != nil {
+		return err
+	}
+
+	return saveDataToAcquisition(acq, "env.json", parseEnv(res.Stdout))
 }
@@ -5,16 +5,38 @@
 package modules
 
 import (
-	"github.com/botherder/go-savetime/slice"
+	"context"
+	"path"
+	"slices"
+	"strings"
+
 	"github.com/mvt-project/androidqf/acquisition"
 	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
+)
+
+var (
+	// filesExcluded are never walked by the collector, as they have no
+	// files of interest and reading them can block.
+	filesExcluded = []string{"/proc", "/sys"}
+	// globEscaper escapes the characters of a path which are special in a
+	// glob.
+	globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
 )
 
 type Files struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description:    "Lists the files on the system with their metadata.",
+		Duration:       "1-10 minutes",
+		Outputs:        []string{"files.json"},
+		NeedsCollector: true,
+		New:            func() Module { return NewFiles() },
+	})
+}
+
 func NewFiles() *Files {
 	return &Files{}
 }
@@ -23,34 +45,40 @@ func (f *Files) Name() string {
 	return "files"
 }
 
+func (f *Files) Tags() []string {
+	return []string{TagHeavy}
+}
+
 func (f *Files) InitStorage(storagePath string) error {
 	f.StoragePath = storagePath
 	return nil
 }
 
-func (f *Files) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting list of files... This might take a while...")
-	var fileFounds []string
+func (f *Files) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting list of files... This might take a while...")
+	fileFounds := make(map[string]bool)
 	var fileDetails []adb.FileInfo
 
 	method := "collector"
 	if acq.Collector == nil {
-		out, _ := adb.Client.Shell("find '/' -maxdepth 1 -printf '%T@ %m %s %u %g %p\n' 2> /dev/null")
-		if (out == "") || (len(out) == 0) {
+		// Older toybox versions do not support -printf and only print an
+		// error on stderr.
+		res, _ := acq.Client.RunShellContext(ctx, "find '/' -maxdepth 1 -printf '%T@ %m %s %u %g %p\n'")
+		if res == nil || strings.TrimSpace(res.Stdout) == "" {
 			method = "findsimple"
-			log.Debug("Using simple find to collect list of files")
+			acq.Log.Debug("Using simple find to collect list of files")
 		} else {
 			method = "findfull"
-			log.Debug("Using find command to collect list of files")
+			acq.Log.Debug("Using find command to collect list of files")
 		}
 	} else {
-		log.Debug("Using collector to collect list of files")
+		acq.Log.Debug("Using collector to collect list of files")
 	}
 
 	folders := []string{
 		"/sdcard/", "/system/", "/system_ext/", "/vendor/",
 		"/cust/", "/product/", "/apex/", "/data/local/tmp/", "/data/media/0/",
-		"/data/misc/radio/", "/data/vendor/secradio/", "/data/log/", "/tmp/", "/", "/data/data/",
+		"/data/misc/radio/", "/data/vendor/secradio/", "/data/log/", "/tmp/", "/data/data/",
 	}
 	// If tmp folder different from standard tmp, add it to the list
 	if acq.TmpDir != "/data/local/tmp/" {
@@ -59,27 +87,61 @@ func (f *Files) Run(acq *acquisition.Acquisition, fast bool) error {
 	if acq.SdCard != "/sdcard/" {
 		folders = append(folders, acq.SdCard)
 	}
+	// The root folder is walked last, so that the collector can skip the
+	// folders already listed.
+	folders = append(folders, "/")
 
+	var walked []string
 	for _, folder := range folders {
+		if ctx.Err() != nil {
+			break
+		}
+
 		var out []adb.FileInfo
 		var err error
 		if method == "collector" {
-			out, err = acq.Collector.Find(folder)
+			opts := adb.FindOptions{Exclude: filesExclusions(folder, walked)}
+			out, err = acq.Collector.Find(ctx, folder, opts)
 		} else if method == "findfull" {
-			out, err = adb.Client.FindFullCommand(folder)
+			out, err = acq.Client.FindFullCommand(ctx, folder)
 		} else {
-			out, err = adb.Client.FindLimitedCommand(folder)
+			out, err = acq.Client.FindLimitedCommand(ctx, folder)
 		}
 
 		if err == nil {
+			walked = append(walked, folder)
 			for _, s := range out {
-				if !slice.Contains(fileFounds, s.Path) {
-					fileFounds = append(fileFounds, s.Path)
+				// The folders overlap, such as / and /system/.
+				if !fileFounds[s.Path] {
+					fileFounds[s.Path] = true
 					fileDetails = append(fileDetails, s)
 				}
 			}
 		}
 	}
 
-	return saveDataToAcquisition(acq, "files.json", &fileDetails)
+	// Keep what was collected so far even if the module was interrupted.
+	err := saveDataToAcquisition(acq, "files.json", &fileDetails)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// filesExclusions returns the exclude patterns of the collector for the
+// folder: the pseudo file systems and the folders within it which were
+// already walked.
+func filesExclusions(folder string, walked []string) []string {
+	folder = path.Clean(folder)
+	exclude := slices.Clone(filesExcluded)
+	for _, w := range walked {
+		w = path.Clean(w)
+		if w == folder || slices.Contains(filesExcluded, w) {
+			continue
+		}
+		if folder == "/" || strings.HasPrefix(w, folder+"/") {
+			exclude = append(exclude, globEscaper.Replace(w))
+		}
+	}
+	return exclude
 }
@@ -0,0 +1,32 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilesExclusions(t *testing.T) {
+	walked := []string{"/sdcard/", "/system/", "/data/local/tmp/", "/data/data/", "/tmp/[x]/"}
+
+	got := filesExclusions("/", walked)
+	want := []string{"/proc", "/sys", "/sdcard", "/system", "/data/local/tmp", "/data/data", `/tmp/\[x]`}
+	if !slices.Equal(got, want) {
+		t.Fatalf("filesExclusions(/) = %q, want %q", got, want)
+	}
+
+	got = filesExclusions("/data/", walked)
+	want = []string{"/proc", "/sys", "/data/local/tmp", "/data/data"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("filesExclusions(/data/) = %q, want %q", got, want)
+	}
+
+	got = filesExclusions("/system/", walked)
+	want = []string{"/proc", "/sys"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("filesExclusions(/system/) = %q, want %q", got, want)
+	}
+}
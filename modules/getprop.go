@@ -5,17 +5,26 @@
 package modules
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type GetProp struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Collects the device properties (build, configuration).",
+		Duration:    "seconds",
+		Outputs:     []string{"getprop.txt", "getprop.json"},
+		New:         func() Module { return NewGetProp() },
+	})
+}
+
 func NewGetProp() *GetProp {
 	return &GetProp{}
 }
@@ -24,18 +33,27 @@ func (g *GetProp) Name() string {
 	return "getprop"
 }
 
+func (g *GetProp) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (g *GetProp) InitStorage(storagePath string) error {
 	g.StoragePath = storagePath
 	return nil
 }
 
-func (g *GetProp) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting device properties...")
+func (g *GetProp) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting device properties...")
 
-	out, err := adb.Client.Shell("getprop")
+	res, err := acq.Client.RunShellContext(ctx, "getprop")
 	if err != nil {
 		return fmt.Errorf("failed to run `adb shell getprop`: %v", err)
 	}
 
-	return saveStringToAcquisition(acq, "getprop.txt", out)
+	err = saveStringToAcquisition(acq, "getprop.txt", strings.TrimSpace(res.Stdout))
+	if err != nil {
+		return err
+	}
+
+	return saveDataToAcquisition(acq, "getprop.json", parseProps(res.Stdout))
 }
@@ -0,0 +1,92 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/mvt-project/androidqf/log"
+)
+
+// Ctrl+C normally aborts the running module, but a module waiting on the
+// user (like intrusion_logs) can claim it to only stop waiting instead. When
+// acquiring several devices, every module waiting stops.
+var (
+	interruptMu       sync.Mutex
+	interruptHandlers = make(map[int]func())
+	interruptNext     int
+)
+
+// forceExitInterrupts is how many more times Ctrl+C must be pressed while
+// the acquisition is being finalized to exit right away, in case finalizing
+// hangs on a blocked adb command or a full disk.
+const forceExitInterrupts = 2
+
+// HandleInterrupts returns a context that is cancelled when the user presses
+// Ctrl+C, unless a module claimed the interrupt with onInterrupt. The
+// returned function stops listening for interrupts.
+func HandleInterrupts(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	done := make(chan struct{})
+	go func() {
+		// pending counts the interrupts received while finalizing.
+		pending := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+			}
+
+			interruptMu.Lock()
+			if len(interruptHandlers) > 0 {
+				for _, handler := range interruptHandlers {
+					handler()
+				}
+			} else if ctx.Err() != nil {
+				pending++
+				if pending >= forceExitInterrupts {
+					log.Error("Interrupted again, exiting without finalizing the acquisition")
+					os.Exit(130)
+				}
+				log.Warning("Still finalizing the acquisition, please wait... Press Ctrl+C again to exit immediately, leaving the acquisition incomplete.")
+			} else {
+				log.Warning("Interrupted, aborting the current module and finalizing the acquisition...")
+				cancel()
+			}
+			interruptMu.Unlock()
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// onInterrupt makes fn handle the next Ctrl+C instead of the running module
+// being aborted, until the returned release function is called.
+func onInterrupt(fn func()) func() {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+
+	id := interruptNext
+	interruptNext++
+	interruptHandlers[id] = fn
+
+	return func() {
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+		delete(interruptHandlers, id)
+	}
+}
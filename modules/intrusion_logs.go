@@ -9,21 +9,18 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/manifoldco/promptui"
 	"github.com/mvt-project/androidqf/acquisition"
 	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 const (
-	acquireIL = "Yes"
-	skipIL    = "No"
+	acquireIL = "yes"
+	skipIL    = "no"
 )
 
 type IL struct {
@@ -32,6 +29,15 @@ type IL struct {
 	DirOnDevice string
 }
 
+func init() {
+	Register(Info{
+		Description: "Downloads the Intrusion Logging logs of devices with Advanced Protection enabled.",
+		Duration:    "up to 15 minutes",
+		Outputs:     []string{"intrusion_logs/"},
+		New:         func() Module { return NewIL() },
+	})
+}
+
 func NewIL() *IL {
 	return &IL{
 		DirOnDevice: "/sdcard/Download/Intrusion Logging/",
@@ -42,6 +48,10 @@ func (m *IL) Name() string {
 	return "intrusion_logs"
 }
 
+func (m *IL) Tags() []string {
+	return []string{TagInteractive, TagHeavy}
+}
+
 func (m *IL) InitStorage(storagePath string) error {
 	m.StoragePath = storagePath
 	m.ILPath = filepath.Join(storagePath, "intrusion_logs")
@@ -57,12 +67,12 @@ func (m *IL) InitStorage(storagePath string) error {
 	return nil
 }
 
-func (m *IL) Run(acq *acquisition.Acquisition, fast bool) error {
+func (m *IL) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
 	// Check whether the device supports AAPM.
-	compatible, err := m.isAAPMCompatibleDevice()
+	compatible, err := m.isAAPMCompatibleDevice(ctx, acq.Client)
 	if err != nil {
 		// Don't break acquisition if the check fails, just log and skip.
-		log.Debugf("Failed to check AAPM compatibility: %v", err)
+		acq.Log.Debugf("Failed to check AAPM compatibility: %v", err)
 		return nil
 	}
 
@@ -70,25 +80,24 @@ func (m *IL) Run(acq *acquisition.Acquisition, fast bool) error {
 	// (for example, restored or migrated from another device on the same Google account).
 	// If so, skipping here might miss existing data.
 	if !compatible {
-		log.Info("Device is not AAPM-compatible, skipping Intrusion Logging acquisition.")
+		acq.Log.Info("Device is not AAPM-compatible, skipping Intrusion Logging acquisition.")
 		return nil
 	}
 
 	// Ask user first
-	log.Info("Would you like to download Intrusion Logs from the device?")
-	promptIL := promptui.Select{
-		Label: "Intrusion Logs",
-		Items: []string{acquireIL, skipIL},
-	}
-
-	_, ILOption, err := promptIL.Run()
+	ILOption, err := ask(acq, acquisition.AnswerIntrusionLogs,
+		"Would you like to download Intrusion Logs from the device?", "Intrusion Logs",
+		[]choice{
+			{acquireIL, "Yes"},
+			{skipIL, "No"},
+		}, skipIL)
 	if err != nil {
 		return fmt.Errorf("failed to make selection for IL option: %v", err)
 	}
 
 	// User declined so we continue acquisition normally
 	if ILOption == skipIL {
-		log.Info("Skipping Intrusion Logging extraction...")
+		acq.Log.Info("Skipping Intrusion Logging extraction...")
 		return nil
 	}
 
@@ -96,74 +105,86 @@ func (m *IL) Run(acq *acquisition.Acquisition, fast bool) error {
 	// or wait for a new file just pull whatever is already present.
 	// We still proceed with acquisition because older IL files may remain on disk
 	// and should be collected with user consent.
-	aapmEnabled, err := m.isAAPMEnabled()
+	aapmEnabled, err := m.isAAPMEnabled(ctx, acq.Client)
 	if err != nil {
-		log.Debugf("Failed to check AAPM enabled state: %v", err)
+		acq.Log.Debugf("Failed to check AAPM enabled state: %v", err)
 		aapmEnabled = false
 	}
 
-	if aapmEnabled {
+	maxWait := acq.Profile.ILWait()
+	waitSource := acquisition.AnswerFromDefault
+	if _, ok := acq.Profile.Answer(acquisition.AnswerIntrusionLogsWait); ok {
+		waitSource = acquisition.AnswerFromProfile
+	}
+	acq.SetAnswer(acquisition.AnswerIntrusionLogsWait, maxWait.String(), waitSource)
+	if aapmEnabled && maxWait == 0 {
+		acq.Log.Info("Not waiting for new intrusion logs, pulling the existing ones only.")
+	} else if aapmEnabled {
 		// Snapshot of Intrusion Logs folder before triggering new log download
-		before, err := m.listDirSet(m.DirOnDevice)
+		before, err := m.listDirSet(ctx, acq.Client, m.DirOnDevice)
 
 		if err != nil {
-			log.Errorf("IL: failed to list %s: %v", m.DirOnDevice, err)
+			acq.Log.Errorf("IL: failed to list %s: %v", m.DirOnDevice, err)
 			return nil
 		}
 
 		// Start the Activity to prompt the user to download a new Intrusion Log
-		if err := adb.Client.IL(); err != nil {
-			log.Errorf("Failed to launch intrusion detection activity: %v\n", err)
+		if err := acq.Client.IL(); err != nil {
+			acq.Log.Errorf("Failed to launch intrusion detection activity: %v\n", err)
 			// Still allow pulling existing files if user wants; continue anyway.
 		}
 
-		log.Info("Launched the Intrusion Logging settings page.")
-		log.Info("On the device: scroll down, tap 'Access Logs', then press 'Download and Decrypt' for each listed device.\n")
+		acq.Log.Info("Launched the Intrusion Logging settings page.")
+		acq.Log.Info("On the device: scroll down, tap 'Access Logs', then press 'Download and Decrypt' for each listed device.\n")
 
-		log.Info("Waiting for intrusion logs to be written to device. (Ctrl+C to skip waiting and continue acquisition)...")
+		acq.Log.Info("Waiting for intrusion logs to be written to device. (Ctrl+C to skip waiting and continue acquisition)...")
 		// Watch directory (Ctrl+C cancels watch but continues acquisition)
-		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-		defer stop()
+		waitCtx, stopWaiting := context.WithCancel(ctx)
+		release := onInterrupt(stopWaiting)
 
-		// Pulls every 2 seconds. Stops on Ctrl+C or after 15 minutes.
-		watchErr := m.waitForNewFiles(ctx, m.DirOnDevice, before, 2*time.Second, 15*time.Minute)
+		// Pulls every 2 seconds. Stops on Ctrl+C or after maxWait (15 minutes by default).
+		watchErr := m.waitForNewFiles(ctx, waitCtx, acq.Client, m.DirOnDevice, before, 2*time.Second, maxWait)
+		release()
+		stopWaiting()
 		if watchErr != nil {
-			// If user Ctrl+C, context is canceled and acquisition continues
-			log.Info("Stopped waiting, continuing with acquisition...")
+			return watchErr
 		}
 	} else {
-		log.Debug("AAPM is disabled, skipping activity launch and new file watcher (pulling existing files only).")
+		acq.Log.Debug("AAPM is disabled, skipping activity launch and new file watcher (pulling existing files only).")
 	}
 
 	// Pull all files (old + new)
-	files, err := adb.Client.ListFiles(m.DirOnDevice, true)
+	files, err := acq.Client.ListFilesContext(ctx, m.DirOnDevice, true)
 	if err != nil {
-		log.Errorf("IL: failed to list files for pull in %s: %v", m.DirOnDevice, err)
+		acq.Log.Errorf("IL: failed to list files for pull in %s: %v", m.DirOnDevice, err)
 		return nil
 	}
 	if len(files) == 0 {
-		log.Info("No files found in " + m.DirOnDevice)
+		acq.Log.Info("No files found in " + m.DirOnDevice)
 		return nil
 	}
 
-	if err := m.pullAll(acq, files); err != nil {
-		log.Errorf("IL: failed pulling IL files: %v", err)
+	if err := m.pullAll(ctx, acq, files); err != nil {
+		acq.Log.Errorf("IL: failed pulling IL files: %v", err)
 		// continue acquisition
 		return nil
 	}
-	log.Infof("Downloaded %d Instrusion Logging files from the phone.", len(files))
-	log.Info("Intrusion Logging acquisition is completed; continuing with acquisition ...")
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	acq.Log.Infof("Downloaded %d Instrusion Logging files from the phone.", len(files))
+	acq.Log.Info("Intrusion Logging acquisition is completed; continuing with acquisition ...")
 	return nil
 }
 
-func (m *IL) isAAPMCompatibleDevice() (bool, error) {
+func (m *IL) isAAPMCompatibleDevice(ctx context.Context, client *adb.ADB) (bool, error) {
 	// adb shell settings get secure advanced_protection_mode
-	out, err := adb.Client.Shell("settings", "get", "secure", "advanced_protection_mode")
+	res, err := client.RunShellContext(ctx, "settings", "get", "secure", "advanced_protection_mode")
 	if err != nil {
 		return false, err
 	}
 
-	val := strings.TrimSpace(out)
+	val := strings.TrimSpace(res.Stdout)
 	// If the key does not exist, Android prints "null". We infer this is not compatible.
 	if strings.EqualFold(val, "null") || val == "" {
 		return false, nil
@@ -173,14 +194,14 @@ func (m *IL) isAAPMCompatibleDevice() (bool, error) {
 	return true, nil
 }
 
-func (m *IL) isAAPMEnabled() (bool, error) {
+func (m *IL) isAAPMEnabled(ctx context.Context, client *adb.ADB) (bool, error) {
 	// adb shell settings get secure advanced_protection_mode
-	out, err := adb.Client.Shell("settings", "get", "secure", "advanced_protection_mode")
+	res, err := client.RunShellContext(ctx, "settings", "get", "secure", "advanced_protection_mode")
 	if err != nil {
 		return false, err
 	}
 
-	val := strings.TrimSpace(out)
+	val := strings.TrimSpace(res.Stdout)
 
 	// If the key is missing Android returns "null"
 	if strings.EqualFold(val, "null") || val == "" {
@@ -191,12 +212,12 @@ func (m *IL) isAAPMEnabled() (bool, error) {
 	return val == "1", nil
 }
 
-func (m *IL) listDirSet(dir string) (map[string]struct{}, error) {
-	files, err := adb.Client.ListFiles(dir, true)
+func (m *IL) listDirSet(ctx context.Context, client *adb.ADB, dir string) (map[string]struct{}, error) {
+	files, err := client.ListFilesContext(ctx, dir, true)
 	if err != nil {
 		return nil, err
 	}
-	log.Debugf("IL: Polling found %d intrusion logging files on device at '%s'", len(files), dir)
+	client.Log.Debugf("IL: Polling found %d intrusion logging files on device at '%s'", len(files), dir)
 	set := make(map[string]struct{}, len(files))
 	for _, f := range files {
 		set[f] = struct{}{}
@@ -204,9 +225,12 @@ func (m *IL) listDirSet(dir string) (map[string]struct{}, error) {
 	return set, nil
 }
 
-// Watch for new files until Ctrl+C or timeout.
+// Watch for new files until Ctrl+C or timeout. Ctrl+C only cancels waitCtx,
+// while an error is returned if the module itself is aborted.
 func (m *IL) waitForNewFiles(
 	ctx context.Context,
+	waitCtx context.Context,
+	client *adb.ADB,
 	dir string,
 	before map[string]struct{},
 	pollEvery time.Duration,
@@ -220,25 +244,31 @@ func (m *IL) waitForNewFiles(
 
 	for {
 		select {
-		case <-ctx.Done():
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			// Ctrl+C => continue acquisition (non-fatal)
-			log.Info("Ctrl+C detected. Continuing acquisition...")
+			client.Log.Info("Ctrl+C detected. Stopped waiting, continuing with acquisition...")
 			return nil
 
 		case <-timeout.C:
-			log.Info("Finished waiting for intrusion logs (15 minute timeout reached).")
+			client.Log.Infof("Finished waiting for intrusion logs (%s timeout reached).", maxWait)
 			return nil
 
 		case <-ticker.C:
-			now, err := m.listDirSet(dir)
+			now, err := m.listDirSet(waitCtx, client, dir)
 			if err != nil {
-				log.Debugf("IL: poll list failed: %v", err)
+				if waitCtx.Err() != nil {
+					continue
+				}
+				client.Log.Debugf("IL: poll list failed: %v", err)
 				continue
 			}
 
 			for f := range now {
 				if _, existed := before[f]; !existed {
-					log.Infof(
+					client.Log.Infof(
 						"Detected new file: %s.\nIf you finished downloading logs, press Ctrl+C to continue acquisition.",
 						f,
 					)
@@ -249,7 +279,7 @@ func (m *IL) waitForNewFiles(
 	}
 }
 
-func (m *IL) pullAll(acq *acquisition.Acquisition, deviceFiles []string) error {
+func (m *IL) pullAll(ctx context.Context, acq *acquisition.Acquisition, deviceFiles []string) error {
 	streaming := acq.StreamingMode && acq.EncryptedWriter != nil
 	var localRoot *os.Root
 	var puller *acquisition.StreamingPuller
@@ -260,17 +290,20 @@ func (m *IL) pullAll(acq *acquisition.Acquisition, deviceFiles []string) error {
 			return fmt.Errorf("failed to open intrusion logs output root: %v", err)
 		}
 		defer localRoot.Close()
-		puller = acquisition.NewStreamingPuller(adb.Client.ExePath, adb.Client.Serial, 100)
+		puller = acquisition.NewStreamingPuller(acq.Client, 100)
 	}
 
 	for _, file := range deviceFiles {
+		if ctx.Err() != nil {
+			break
+		}
 		if file == m.DirOnDevice {
 			continue
 		}
 
 		rel, err := relativeDeviceChild(m.DirOnDevice, file)
 		if err != nil {
-			log.Errorf("Skipping IL file with unsafe path %s: %v\n", file, err)
+			acq.Log.Errorf("Skipping IL file with unsafe path %s: %v\n", file, err)
 			continue
 		}
 
@@ -279,20 +312,21 @@ func (m *IL) pullAll(acq *acquisition.Acquisition, deviceFiles []string) error {
 
 			writer, err := acq.EncryptedWriter.CreateFile(zipPath)
 			if err != nil {
-				log.Errorf("Failed to create zip entry for IL file %s: %v\n", file, err)
+				acq.Log.Errorf("Failed to create zip entry for IL file %s: %v\n", file, err)
 				continue
 			}
 
-			err = acq.StreamingPuller.PullToWriter(file, writer)
+			err = acq.StreamingPuller.PullToWriterContext(ctx, file, writer)
+			writer.Close()
 			if err != nil {
-				log.Errorf("Failed to stream IL file %s: %v\n", file, err)
+				acq.Log.Errorf("Failed to stream IL file %s: %v\n", file, err)
 				continue
 			}
 
-			log.Debugf("Streamed IL file %s directly to encrypted archive as %s", file, zipPath)
+			acq.Log.Debugf("Streamed IL file %s directly to encrypted archive as %s", file, zipPath)
 		} else {
-			if err := streamDeviceChildToRoot(localRoot, puller, rel, file); err != nil {
-				log.Errorf("Failed to pull IL file %s: %v\n", file, err)
+			if err := streamDeviceChildToRoot(ctx, localRoot, puller, rel, file); err != nil {
+				acq.Log.Errorf("Failed to pull IL file %s: %v\n", file, err)
 				continue
 			}
 		}
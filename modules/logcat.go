@@ -5,17 +5,26 @@
 package modules
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Logcat struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Dumps the current and previous logcat buffers.",
+		Duration:    "seconds",
+		Outputs:     []string{"logcat.txt", "logcat_old.txt"},
+		New:         func() Module { return NewLogcat() },
+	})
+}
+
 func NewLogcat() *Logcat {
 	return &Logcat{}
 }
@@ -24,31 +33,35 @@ func (l *Logcat) Name() string {
 	return "logcat"
 }
 
+func (l *Logcat) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (l *Logcat) InitStorage(storagePath string) error {
 	l.StoragePath = storagePath
 	return nil
 }
 
-func (l *Logcat) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting logcat...")
+func (l *Logcat) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting logcat...")
 
-	out, err := adb.Client.Shell("logcat", "-d", "-b", "all", "\"*:V\"")
+	res, err := acq.Client.RunShellContext(ctx, "logcat", "-d", "-b", "all", "\"*:V\"")
 	if err != nil {
 		return fmt.Errorf("failed to run `adb shell logcat`: %v", err)
 	}
 
-	err = saveStringToAcquisition(acq, "logcat.txt", out)
+	err = saveStringToAcquisition(acq, "logcat.txt", strings.TrimSpace(res.Stdout))
 	if err != nil {
 		return err
 	}
 
 	// logcat from before reboot
-	out, err = adb.Client.Shell("logcat", "-L", "-b", "all", "\"*:V\"")
+	res, err = acq.Client.RunShellContext(ctx, "logcat", "-L", "-b", "all", "\"*:V\"")
 	if err != nil {
 		// Often fails, totally normal
-		log.Debugf("failed to run `adb shell logcat -L`: %v", err)
+		acq.Log.Debugf("failed to run `adb shell logcat -L`: %v", err)
 		return nil
 	}
 
-	return saveStringToAcquisition(acq, "logcat_old.txt", out)
+	return saveStringToAcquisition(acq, "logcat_old.txt", strings.TrimSpace(res.Stdout))
 }
@@ -5,6 +5,7 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,8 +13,6 @@ import (
 
 	"github.com/botherder/go-savetime/text"
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Logs struct {
@@ -21,6 +20,15 @@ type Logs struct {
 	LogsPath    string
 }
 
+func init() {
+	Register(Info{
+		Description: "Copies the system log files (ANR traces, pstore, vendor logs).",
+		Duration:    "1-5 minutes",
+		Outputs:     []string{"logs/"},
+		New:         func() Module { return NewLogs() },
+	})
+}
+
 func NewLogs() *Logs {
 	return &Logs{}
 }
@@ -29,6 +37,10 @@ func (l *Logs) Name() string {
 	return "logs"
 }
 
+func (l *Logs) Tags() []string {
+	return []string{TagHeavy}
+}
+
 func (l *Logs) InitStorage(storagePath string) error {
 	l.StoragePath = storagePath
 	l.LogsPath = filepath.Join(storagePath, "logs")
@@ -44,8 +56,8 @@ func (l *Logs) InitStorage(storagePath string) error {
 	return nil
 }
 
-func (l *Logs) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting system logs...")
+func (l *Logs) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting system logs...")
 
 	logFiles := []string{
 		"/data/system/uiderrors.txt",
@@ -56,9 +68,9 @@ func (l *Logs) Run(acq *acquisition.Acquisition, fast bool) error {
 
 	// FIXME: needed to list files versus pulling folders?
 	for _, logFolder := range []string{"/data/anr/", "/data/log/", "/sdcard/log/"} {
-		files, err := adb.Client.ListFiles(logFolder, true)
+		files, err := acq.Client.ListFilesContext(ctx, logFolder, true)
 		if err != nil {
-			log.Debugf("Impossible to get files from %s", logFolder)
+			acq.Log.Debugf("Impossible to get files from %s", logFolder)
 			continue
 		}
 		if len(files) == 0 {
@@ -66,21 +78,25 @@ func (l *Logs) Run(acq *acquisition.Acquisition, fast bool) error {
 		}
 
 		logFiles = append(logFiles, files...)
-		log.Debugf("Files in %s: %s", logFolder, files)
+		acq.Log.Debugf("Files in %s: %s", logFolder, files)
 	}
 
 	for _, logFile := range logFiles {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		// logFile is device controlled; validate it stays within LogsPath.
 		rel, err := filepath.Rel(l.LogsPath, filepath.Join(l.LogsPath, logFile))
 		if err != nil || !filepath.IsLocal(rel) {
-			log.Errorf("Skipping log file with path traversal: %s", logFile)
+			acq.Log.Errorf("Skipping log file with path traversal: %s", logFile)
 			continue
 		}
 
 		if acq.StreamingMode && acq.EncryptedWriter != nil {
 			// Streaming mode: stream directly from ADB to encrypted zip without temp files
-			log.Debugf("From: %s", logFile)
-			log.Debugf("To encrypted archive as: logs%s", logFile)
+			acq.Log.Debugf("From: %s", logFile)
+			acq.Log.Debugf("To encrypted archive as: logs%s", logFile)
 
 			// Create zip path with logs/ prefix
 			zipPath := fmt.Sprintf("logs%s", logFile)
@@ -88,37 +104,38 @@ func (l *Logs) Run(acq *acquisition.Acquisition, fast bool) error {
 			// Create zip entry writer
 			writer, err := acq.EncryptedWriter.CreateFile(zipPath)
 			if err != nil {
-				log.Errorf("Failed to create zip entry for log %s: %v\n", logFile, err)
+				acq.Log.Errorf("Failed to create zip entry for log %s: %v\n", logFile, err)
 				continue
 			}
 
 			// Stream log file directly to encrypted zip using acquisition's streaming puller
-			err = acq.StreamingPuller.PullToWriter(logFile, writer)
+			err = acq.StreamingPuller.PullToWriterContext(ctx, logFile, writer)
+			writer.Close()
 			if err != nil {
 				if !text.ContainsNoCase(err.Error(), "Permission denied") {
-					log.Errorf("Failed to stream log file %s: %v\n", logFile, err)
+					acq.Log.Errorf("Failed to stream log file %s: %v\n", logFile, err)
 				}
 				continue
 			}
 
-			log.Debugf("Streamed log file %s directly to encrypted archive", logFile)
+			acq.Log.Debugf("Streamed log file %s directly to encrypted archive", logFile)
 		} else {
 			// Traditional mode: create local directory structure and pull files
 			localPath := filepath.Join(l.LogsPath, logFile)
 			localDir, _ := filepath.Split(localPath)
-			log.Debugf("From: %s", logFile)
-			log.Debugf("To: %s", localPath)
+			acq.Log.Debugf("From: %s", logFile)
+			acq.Log.Debugf("To: %s", localPath)
 
 			err := os.MkdirAll(localDir, 0o755)
 			if err != nil {
-				log.Errorf("Failed to create folders for logs %s: %v\n", localDir, err)
+				acq.Log.Errorf("Failed to create folders for logs %s: %v\n", localDir, err)
 				continue
 			}
 
-			out, err := adb.Client.Pull(logFile, localPath)
+			out, err := acq.Client.PullContext(ctx, logFile, localPath)
 			if err != nil {
 				if !text.ContainsNoCase(out, "Permission denied") {
-					log.Errorf("Failed to pull log file %s: %s\n", logFile, strings.TrimSpace(out))
+					acq.Log.Errorf("Failed to pull log file %s: %s\n", logFile, strings.TrimSpace(out))
 				}
 				continue
 			}
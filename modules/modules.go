@@ -5,6 +5,7 @@
 package modules
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -16,29 +17,7 @@ import (
 type Module interface {
 	Name() string
 	InitStorage(storagePath string) error
-	Run(acq *acquisition.Acquisition, fast bool) error
-}
-
-func List() []Module {
-	return []Module{
-		NewBackup(),
-		NewIL(),
-		NewPackages(),
-		NewGetProp(),
-		NewDumpsys(),
-		NewProcesses(),
-		NewServices(),
-		NewBugreport(),
-		NewFiles(),
-		NewSettings(),
-		NewSELinux(),
-		NewEnvironment(),
-		NewRootBinaries(),
-		NewMounts(),
-		NewLogcat(),
-		NewLogs(),
-		NewTemp(),
-	}
+	Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error
 }
 
 // saveDataToAcquisition saves data to either encrypted stream or file based on acquisition mode
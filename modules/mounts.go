@@ -6,18 +6,26 @@
 package modules
 
 import (
+	"context"
 	"slices"
 	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Mounts struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Lists the mounted filesystems.",
+		Duration:    "seconds",
+		Outputs:     []string{"mounts.json"},
+		New:         func() Module { return NewMounts() },
+	})
+}
+
 func NewMounts() *Mounts {
 	return &Mounts{}
 }
@@ -26,35 +34,39 @@ func (m *Mounts) Name() string {
 	return "mounts"
 }
 
+func (m *Mounts) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (m *Mounts) InitStorage(storagePath string) error {
 	m.StoragePath = storagePath
 	return nil
 }
 
-func (m *Mounts) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting mount information")
+func (m *Mounts) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting mount information")
 
 	var mountsData []string
 
 	// Run "mount"
-	log.Debug("Running: mount")
-	out1, err1 := adb.Client.Shell("mount")
-	if err1 == nil && out1 != "" {
-		lines := strings.Split(strings.TrimSpace(out1), "\n")
+	acq.Log.Debug("Running: mount")
+	res, err := acq.Client.RunShellContext(ctx, "mount")
+	if err == nil && strings.TrimSpace(res.Stdout) != "" {
+		lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
 		for _, line := range lines {
 			if strings.TrimSpace(line) != "" {
 				mountsData = append(mountsData, strings.TrimSpace(line))
 			}
 		}
 	} else {
-		log.Debug("mount command failed or returned empty result")
+		acq.Log.Debugf("mount command failed or returned empty result: %v", err)
 	}
 
 	// Run "cat /proc/mounts"
-	log.Debug("Running: cat /proc/mounts")
-	out2, err2 := adb.Client.Shell("cat /proc/mounts")
-	if err2 == nil && out2 != "" {
-		lines := strings.Split(strings.TrimSpace(out2), "\n")
+	acq.Log.Debug("Running: cat /proc/mounts")
+	res, err = acq.Client.RunShellContext(ctx, "cat /proc/mounts")
+	if err == nil && strings.TrimSpace(res.Stdout) != "" {
+		lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
 		for _, line := range lines {
 			if strings.TrimSpace(line) != "" {
 				trimmedLine := strings.TrimSpace(line)
@@ -66,10 +78,10 @@ func (m *Mounts) Run(acq *acquisition.Acquisition, fast bool) error {
 			}
 		}
 	} else {
-		log.Debug("cat /proc/mounts command failed or returned empty result")
+		acq.Log.Debugf("cat /proc/mounts command failed or returned empty result: %v", err)
 	}
 
-	log.Debugf("Found %d mount entries", len(mountsData))
+	acq.Log.Debugf("Found %d mount entries", len(mountsData))
 
 	return saveDataToAcquisition(acq, "mounts.json", &mountsData)
 }
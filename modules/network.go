@@ -0,0 +1,421 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mvt-project/androidqf/acquisition"
+	"github.com/mvt-project/androidqf/adb"
+)
+
+var (
+	// interfaceLine matches the first line of an interface in the output of
+	// `ip addr`, such as "22: wlan0: <BROADCAST,UP> mtu 1500 ... state UP".
+	interfaceLine = regexp.MustCompile(`^(\d+): ([^:@\s]+)(?:@\S+)?: <([^>]*)>(.*)$`)
+	// ruleLine matches a rule in the output of `ip rule`, such as
+	// "10000:	from all fwmark 0xc0000/0xd0000 lookup legacy_system".
+	ruleLine = regexp.MustCompile(`^(\d+):\s+(.*)$`)
+	// routeTypes are the types which can start a route in the output of
+	// `ip route`, otherwise unicast.
+	routeTypes = []string{
+		"unicast", "local", "broadcast", "multicast", "anycast",
+		"unreachable", "prohibit", "blackhole", "throw", "nat",
+	}
+
+	// The details of a network in the output of `dumpsys connectivity`.
+	agentNetwork    = regexp.MustCompile(`network\{(\d+)\}`)
+	agentInterface  = regexp.MustCompile(`InterfaceName: (\S+)`)
+	agentTransports = regexp.MustCompile(`Transports: ([A-Z_|]+)`)
+	agentDNS        = regexp.MustCompile(`DnsAddresses: \[([^\]]*)\]`)
+	agentOwner      = regexp.MustCompile(`OwnerUid: (\d+)`)
+	agentValidated  = regexp.MustCompile(`\bVALIDATED\b`)
+	agentDefault    = regexp.MustCompile(`Active default network: (\d+)`)
+)
+
+type Network struct {
+	StoragePath string
+}
+
+// NetworkState is the network configuration and connections of the device,
+// saved in network.json.
+type NetworkState struct {
+	// ConnectionsMethod is "collector", or "shell" if the connections were
+	// read from /proc/net without the processes using them.
+	ConnectionsMethod string                `json:"connections_method"`
+	Connections       []adb.Connection      `json:"connections"`
+	Interfaces        []NetworkInterface    `json:"interfaces"`
+	Routes            []Route               `json:"routes"`
+	Rules             []Rule                `json:"rules"`
+	DNS               DNS                   `json:"dns"`
+	Networks          []ConnectivityNetwork `json:"networks"`
+	VPN               VPN                   `json:"vpn"`
+	// Errors are the commands which failed, the rest is still collected.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// NetworkInterface is an interface in the output of `ip addr`.
+type NetworkInterface struct {
+	Index     int                `json:"index"`
+	Name      string             `json:"name"`
+	Flags     []string           `json:"flags"`
+	MTU       int                `json:"mtu"`
+	State     string             `json:"state"`
+	MAC       string             `json:"mac,omitempty"`
+	Addresses []InterfaceAddress `json:"addresses"`
+}
+
+type InterfaceAddress struct {
+	// Family is inet or inet6.
+	Family string `json:"family"`
+	// Address is in CIDR notation, such as "192.168.1.23/24".
+	Address string `json:"address"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+// Route is a route in the output of `ip route show table all`.
+type Route struct {
+	Family      string `json:"family"`
+	Type        string `json:"type"`
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	Device      string `json:"device,omitempty"`
+	Table       string `json:"table,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Metric      int64  `json:"metric,omitempty"`
+}
+
+// Rule is a policy routing rule in the output of `ip rule`.
+type Rule struct {
+	Family   string `json:"family"`
+	Priority int    `json:"priority"`
+	Rule     string `json:"rule"`
+}
+
+type DNS struct {
+	// Servers are those of the connected networks, and of the net.dns
+	// properties on older versions of Android.
+	Servers []string `json:"servers"`
+	// PrivateDNSMode is off, opportunistic or hostname, empty if unset.
+	PrivateDNSMode      string `json:"private_dns_mode,omitempty"`
+	PrivateDNSSpecifier string `json:"private_dns_specifier,omitempty"`
+}
+
+// ConnectivityNetwork is a network in the output of `dumpsys connectivity`.
+type ConnectivityNetwork struct {
+	ID         int      `json:"id"`
+	Interface  string   `json:"interface"`
+	Transports []string `json:"transports"`
+	DNSServers []string `json:"dns_servers"`
+	// OwnerUid is the app which created the network, such as a VPN app.
+	OwnerUid  int  `json:"owner_uid,omitempty"`
+	Validated bool `json:"validated"`
+	Default   bool `json:"default"`
+}
+
+type VPN struct {
+	Active     bool     `json:"active"`
+	Interfaces []string `json:"interfaces"`
+	// OwnerUids are the apps which created the VPNs.
+	OwnerUids   []int  `json:"owner_uids"`
+	AlwaysOnApp string `json:"always_on_app,omitempty"`
+	Lockdown    bool   `json:"lockdown"`
+}
+
+func init() {
+	Register(Info{
+		Description: "Collects the network connections, interfaces, routes, DNS and VPN configuration.",
+		Duration:    "seconds",
+		Outputs:     []string{"network.json", "network_connectivity.txt"},
+		New:         func() Module { return NewNetwork() },
+	})
+}
+
+func NewNetwork() *Network {
+	return &Network{}
+}
+
+func (n *Network) Name() string {
+	return "network"
+}
+
+func (n *Network) Tags() []string {
+	return []string{TagQuick}
+}
+
+func (n *Network) InitStorage(storagePath string) error {
+	n.StoragePath = storagePath
+	return nil
+}
+
+func (n *Network) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting network connections and configuration...")
+
+	state := NetworkState{
+		Connections: []adb.Connection{},
+		Interfaces:  []NetworkInterface{},
+		Routes:      []Route{},
+		Rules:       []Rule{},
+		DNS:         DNS{Servers: []string{}},
+		Networks:    []ConnectivityNetwork{},
+		VPN:         VPN{Interfaces: []string{}, OwnerUids: []int{}},
+	}
+	// run returns the output of the command, recording its failure.
+	run := func(command string) string {
+		res, err := acq.Client.RunShellContext(ctx, command)
+		if err != nil {
+			acq.Log.Debugf("Failed to run `adb shell %s`: %v", command, err)
+			state.Errors = append(state.Errors, fmt.Sprintf("%s: %v", command, err))
+		}
+		if res == nil {
+			return ""
+		}
+		return res.Stdout
+	}
+
+	var connections []adb.Connection
+	var err error
+	if acq.Collector != nil {
+		state.ConnectionsMethod = "collector"
+		connections, err = acq.Collector.Network(ctx)
+		if err != nil {
+			acq.Log.Debugf("Failed to list connections with the collector: %v", err)
+		}
+	}
+	if acq.Collector == nil || (err != nil && ctx.Err() == nil) {
+		state.ConnectionsMethod = "shell"
+		connections, err = acq.Client.NetworkCommand(ctx)
+	}
+	if err != nil {
+		state.Errors = append(state.Errors, fmt.Sprintf("connections: %v", err))
+	}
+	if connections != nil {
+		state.Connections = connections
+	}
+
+	state.Interfaces = parseIPAddr(run("ip addr"))
+	for _, family := range []string{"inet", "inet6"} {
+		flag := "-4"
+		if family == "inet6" {
+			flag = "-6"
+		}
+		state.Routes = append(state.Routes, parseIPRoute(family, run(fmt.Sprintf("ip %s route show table all", flag)))...)
+		state.Rules = append(state.Rules, parseIPRule(family, run(fmt.Sprintf("ip %s rule", flag)))...)
+	}
+
+	// The raw output is kept for what is not parsed.
+	connectivity := run("dumpsys connectivity")
+	if strings.TrimSpace(connectivity) != "" {
+		err = saveStringToAcquisition(acq, "network_connectivity.txt", connectivity)
+		if err != nil {
+			return err
+		}
+	}
+	state.Networks = parseConnectivity(connectivity)
+	for _, network := range state.Networks {
+		for _, server := range network.DNSServers {
+			if !slices.Contains(state.DNS.Servers, server) {
+				state.DNS.Servers = append(state.DNS.Servers, server)
+			}
+		}
+		if slices.Contains(network.Transports, "VPN") {
+			state.VPN.Active = true
+			state.VPN.Interfaces = append(state.VPN.Interfaces, network.Interface)
+			if network.OwnerUid != 0 && !slices.Contains(state.VPN.OwnerUids, network.OwnerUid) {
+				state.VPN.OwnerUids = append(state.VPN.OwnerUids, network.OwnerUid)
+			}
+		}
+	}
+	for i := 1; i <= 4; i++ {
+		server := strings.TrimSpace(run(fmt.Sprintf("getprop net.dns%d", i)))
+		if server != "" && !slices.Contains(state.DNS.Servers, server) {
+			state.DNS.Servers = append(state.DNS.Servers, server)
+		}
+	}
+
+	state.DNS.PrivateDNSMode = settingValue(run("settings get global private_dns_mode"))
+	state.DNS.PrivateDNSSpecifier = settingValue(run("settings get global private_dns_specifier"))
+	state.VPN.AlwaysOnApp = settingValue(run("settings get secure always_on_vpn_app"))
+	state.VPN.Lockdown = settingValue(run("settings get secure always_on_vpn_lockdown")) == "1"
+
+	if state.VPN.Active {
+		acq.Log.Warningf("A VPN is active on interfaces %s", strings.Join(state.VPN.Interfaces, ", "))
+	}
+
+	err = saveDataToAcquisition(acq, "network.json", &state)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// settingValue returns the output of `settings get`, empty if unset.
+func settingValue(out string) string {
+	value := strings.TrimSpace(out)
+	if value == "null" {
+		return ""
+	}
+	return value
+}
+
+// parseIPAddr returns the interfaces in the output of `ip addr`.
+func parseIPAddr(out string) []NetworkInterface {
+	interfaces := []NetworkInterface{}
+	for _, line := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n") {
+		if match := interfaceLine.FindStringSubmatch(line); match != nil {
+			iface := NetworkInterface{Name: match[2], Addresses: []InterfaceAddress{}}
+			iface.Index, _ = strconv.Atoi(match[1])
+			iface.Flags = strings.Split(match[3], ",")
+			details := strings.Fields(match[4])
+			for i := 0; i+1 < len(details); i++ {
+				switch details[i] {
+				case "mtu":
+					iface.MTU, _ = strconv.Atoi(details[i+1])
+				case "state":
+					iface.State = details[i+1]
+				}
+			}
+			interfaces = append(interfaces, iface)
+			continue
+		}
+		if len(interfaces) == 0 {
+			continue
+		}
+
+		iface := &interfaces[len(interfaces)-1]
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "link/"):
+			if fields[0] != "link/none" {
+				iface.MAC = fields[1]
+			}
+		case fields[0] == "inet" || fields[0] == "inet6":
+			address := InterfaceAddress{Family: fields[0], Address: fields[1]}
+			if i := slices.Index(fields, "scope"); i >= 0 && i+1 < len(fields) {
+				address.Scope = fields[i+1]
+			}
+			iface.Addresses = append(iface.Addresses, address)
+		}
+	}
+	return interfaces
+}
+
+// parseIPRoute returns the routes in the output of `ip route`.
+func parseIPRoute(family, out string) []Route {
+	routes := []Route{}
+	for _, line := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		route := Route{Family: family, Type: "unicast"}
+		if slices.Contains(routeTypes, fields[0]) && len(fields) > 1 {
+			route.Type = fields[0]
+			fields = fields[1:]
+		}
+		route.Destination = fields[0]
+		for i := 1; i+1 < len(fields); i++ {
+			value := fields[i+1]
+			switch fields[i] {
+			case "via":
+				route.Gateway = value
+			case "dev":
+				route.Device = value
+			case "table":
+				route.Table = value
+			case "proto":
+				route.Protocol = value
+			case "scope":
+				route.Scope = value
+			case "src":
+				route.Source = value
+			case "metric":
+				route.Metric, _ = strconv.ParseInt(value, 10, 64)
+			default:
+				continue
+			}
+			i++
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// parseIPRule returns the rules in the output of `ip rule`.
+func parseIPRule(family, out string) []Rule {
+	rules := []Rule{}
+	for _, line := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n") {
+		match := ruleLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		priority, _ := strconv.Atoi(match[1])
+		rules = append(rules, Rule{Family: family, Priority: priority, Rule: strings.TrimSpace(match[2])})
+	}
+	return rules
+}
+
+// parseConnectivity returns the networks in the output of
+// `dumpsys connectivity`, one per NetworkAgentInfo line.
+func parseConnectivity(out string) []ConnectivityNetwork {
+	networks := []ConnectivityNetwork{}
+	defaultID := -1
+	if match := agentDefault.FindStringSubmatch(out); match != nil {
+		defaultID, _ = strconv.Atoi(match[1])
+	}
+
+	seen := make(map[int]bool)
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, "NetworkAgentInfo{") {
+			continue
+		}
+		match := agentNetwork.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		network := ConnectivityNetwork{Transports: []string{}, DNSServers: []string{}}
+		network.ID, _ = strconv.Atoi(match[1])
+		// The networks are listed in several sections.
+		if seen[network.ID] {
+			continue
+		}
+		seen[network.ID] = true
+		network.Default = network.ID == defaultID
+
+		if match := agentInterface.FindStringSubmatch(line); match != nil {
+			network.Interface = match[1]
+		}
+		if match := agentTransports.FindStringSubmatch(line); match != nil {
+			network.Transports = strings.Split(match[1], "|")
+		}
+		if match := agentDNS.FindStringSubmatch(line); match != nil {
+			for _, server := range strings.Split(match[1], ",") {
+				// Addresses are printed as "/192.168.1.1".
+				server = strings.TrimPrefix(strings.TrimSpace(server), "/")
+				if server != "" {
+					network.DNSServers = append(network.DNSServers, server)
+				}
+			}
+		}
+		if match := agentOwner.FindStringSubmatch(line); match != nil {
+			network.OwnerUid, _ = strconv.Atoi(match[1])
+		}
+		network.Validated = agentValidated.MatchString(line)
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIPAddr(t *testing.T) {
+	interfaces := parseIPAddr("1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN group default qlen 1000\n" +
+		"    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00\n" +
+		"    inet 127.0.0.1/8 scope host lo\n" +
+		"       valid_lft forever preferred_lft forever\n" +
+		"5: rmnet_data0@rmnet_ipa0: <UP,LOWER_UP> mtu 1500 qdisc mq state UNKNOWN group default qlen 1000\n" +
+		"    link/[530] \n" +
+		"22: wlan0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc mq state UP group default qlen 3000\n" +
+		"    link/ether aa:bb:cc:dd:ee:ff brd ff:ff:ff:ff:ff:ff\n" +
+		"    inet 192.168.1.23/24 brd 192.168.1.255 scope global wlan0\n" +
+		"    inet6 fe80::a8bb:ccff:fedd:eeff/64 scope link \n")
+
+	want := []NetworkInterface{
+		{
+			Index: 1, Name: "lo", Flags: []string{"LOOPBACK", "UP", "LOWER_UP"}, MTU: 65536, State: "UNKNOWN",
+			MAC:       "00:00:00:00:00:00",
+			Addresses: []InterfaceAddress{{Family: "inet", Address: "127.0.0.1/8", Scope: "host"}},
+		},
+		{
+			Index: 5, Name: "rmnet_data0", Flags: []string{"UP", "LOWER_UP"}, MTU: 1500, State: "UNKNOWN",
+			Addresses: []InterfaceAddress{},
+		},
+		{
+			Index: 22, Name: "wlan0", Flags: []string{"BROADCAST", "MULTICAST", "UP", "LOWER_UP"}, MTU: 1500, State: "UP",
+			MAC: "aa:bb:cc:dd:ee:ff",
+			Addresses: []InterfaceAddress{
+				{Family: "inet", Address: "192.168.1.23/24", Scope: "global"},
+				{Family: "inet6", Address: "fe80::a8bb:ccff:fedd:eeff/64", Scope: "link"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(interfaces, want) {
+		t.Fatalf("parseIPAddr() = %+v, want %+v", interfaces, want)
+	}
+}
+
+func TestParseIPRoute(t *testing.T) {
+	routes := parseIPRoute("inet", "default via 192.168.1.1 dev wlan0 table wlan0 proto static\n"+
+		"192.168.1.0/24 dev wlan0 table wlan0 proto kernel scope link src 192.168.1.23 linkdown\n"+
+		"local 127.0.0.1 dev lo table local proto kernel scope host src 127.0.0.1\n"+
+		"unreachable default table 1000 metric 4294967295\n")
+
+	want := []Route{
+		{Family: "inet", Type: "unicast", Destination: "default", Gateway: "192.168.1.1", Device: "wlan0", Table: "wlan0", Protocol: "static"},
+		{Family: "inet", Type: "unicast", Destination: "192.168.1.0/24", Device: "wlan0", Table: "wlan0", Protocol: "kernel", Scope: "link", Source: "192.168.1.23"},
+		{Family: "inet", Type: "local", Destination: "127.0.0.1", Device: "lo", Table: "local", Protocol: "kernel", Scope: "host", Source: "127.0.0.1"},
+		{Family: "inet", Type: "unreachable", Destination: "default", Table: "1000", Metric: 4294967295},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Fatalf("parseIPRoute() = %+v, want %+v", routes, want)
+	}
+}
+
+func TestParseIPRule(t *testing.T) {
+	rules := parseIPRule("inet6", "0:\tfrom all lookup local \n"+
+		"10000:\tfrom all fwmark 0xc0000/0xd0000 lookup legacy_system\n"+
+		"junk\n")
+
+	want := []Rule{
+		{Family: "inet6", Priority: 0, Rule: "from all lookup local"},
+		{Family: "inet6", Priority: 10000, Rule: "from all fwmark 0xc0000/0xd0000 lookup legacy_system"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Fatalf("parseIPRule() = %+v, want %+v", rules, want)
+	}
+}
+
+func TestParseConnectivity(t *testing.T) {
+	networks := parseConnectivity("Active default network: 100\n" +
+		"Current Networks:\n" +
+		"  NetworkAgentInfo{network{100}  handle{432902426637}  ni{WIFI CONNECTED extra: }  " +
+		"lp{{InterfaceName: wlan0 LinkAddresses: [ 192.168.1.23/24 ] DnsAddresses: [ /192.168.1.1,/fd00::1 ] MTU: 1500}}  " +
+		"nc{[ Transports: WIFI Capabilities: INTERNET&NOT_RESTRICTED&TRUSTED&NOT_VPN&VALIDATED OwnerUid: 1000]}  everValidated{true}}\n" +
+		"  NetworkAgentInfo{network{104}  handle{450082295821}  ni{VPN CONNECTED extra: }  " +
+		"lp{{InterfaceName: tun0 LinkAddresses: [ 10.0.0.2/32 ] DnsAddresses: [ /10.0.0.1 ]}}  " +
+		"nc{[ Transports: VPN Capabilities: INTERNET&NOT_RESTRICTED&TRUSTED OwnerUid: 10234]}}\n" +
+		"Network Requests:\n" +
+		"  NetworkAgentInfo{network{100}  handle{432902426637}  ni{WIFI CONNECTED extra: }}\n")
+
+	want := []ConnectivityNetwork{
+		{ID: 100, Interface: "wlan0", Transports: []string{"WIFI"}, DNSServers: []string{"192.168.1.1", "fd00::1"}, OwnerUid: 1000, Validated: true, Default: true},
+		{ID: 104, Interface: "tun0", Transports: []string{"VPN"}, DNSServers: []string{"10.0.0.1"}, OwnerUid: 10234},
+	}
+	if !reflect.DeepEqual(networks, want) {
+		t.Fatalf("parseConnectivity() = %+v, want %+v", networks, want)
+	}
+}
@@ -5,24 +5,23 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/manifoldco/promptui"
 	"github.com/mvt-project/androidqf/acquisition"
 	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 	"github.com/mvt-project/androidqf/utils"
 )
 
 const (
-	apkAll           = "All"
-	apkNotSystem     = "Only non-system packages"
-	apkNone          = "Do not download any"
-	apkRemoveTrusted = "Yes"
-	apkKeepAll       = "No"
+	apkAll           = "all"
+	apkNotSystem     = "non-system"
+	apkNone          = "none"
+	apkRemoveTrusted = "yes"
+	apkKeepAll       = "no"
 )
 
 type Packages struct {
@@ -30,6 +29,15 @@ type Packages struct {
 	ApksPath    string
 }
 
+func init() {
+	Register(Info{
+		Description: "Lists the installed packages with their files and hashes, and downloads the APKs.",
+		Duration:    "1-15 minutes",
+		Outputs:     []string{"packages.json", "apks/"},
+		New:         func() Module { return NewPackages() },
+	})
+}
+
 func NewPackages() *Packages {
 	return &Packages{}
 }
@@ -38,6 +46,10 @@ func (p *Packages) Name() string {
 	return "packages"
 }
 
+func (p *Packages) Tags() []string {
+	return []string{TagInteractive, TagHeavy}
+}
+
 func (p *Packages) InitStorage(storagePath string) error {
 	p.StoragePath = storagePath
 	p.ApksPath = filepath.Join(storagePath, "apks")
@@ -108,25 +120,26 @@ func (p *Packages) generateZipPath(packageName, filePath string) (string, error)
 	return "apks/" + base, nil
 }
 
-func (p *Packages) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting information on installed apps. This might take a while...")
+func (p *Packages) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting information on installed apps. This might take a while...")
 
-	packages, err := adb.Client.GetPackages(fast)
+	packages, err := acq.Client.GetPackages(ctx, fast)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve list of installed packages: %v", err)
 	}
 
-	log.Infof(
+	acq.Log.Infof(
 		"Found a total of %d installed packages",
 		len(packages),
 	)
 
-	log.Info("Would you like to download copies of all apps or only non-system ones?")
-	downloadPrompt := promptui.Select{
-		Label: "Download",
-		Items: []string{apkAll, apkNotSystem, apkNone},
-	}
-	_, download, err := downloadPrompt.Run()
+	download, err := ask(acq, acquisition.AnswerAPKs,
+		"Would you like to download copies of all apps or only non-system ones?", "Download",
+		[]choice{
+			{apkAll, "All"},
+			{apkNotSystem, "Only non-system packages"},
+			{apkNone, "Do not download any"},
+		}, apkNotSystem)
 	if err != nil {
 		return fmt.Errorf("failed to make selection for download option: %v", err)
 	}
@@ -143,12 +156,12 @@ func (p *Packages) Run(acq *acquisition.Acquisition, fast bool) error {
 			keepOption = apkKeepAll
 		} else {
 			// Ask if the user want to remove trusted packages for unencrypted output
-			log.Info("Would you like to remove copies of apps signed with a trusted certificate to limit the size of the output folder?")
-			promptAll := promptui.Select{
-				Label: "Remove",
-				Items: []string{apkRemoveTrusted, apkKeepAll},
-			}
-			_, keepOption, err = promptAll.Run()
+			keepOption, err = ask(acq, acquisition.AnswerRemoveTrustedAPKs,
+				"Would you like to remove copies of apps signed with a trusted certificate to limit the size of the output folder?", "Remove",
+				[]choice{
+					{apkRemoveTrusted, "Yes"},
+					{apkKeepAll, "No"},
+				}, apkKeepAll)
 			if err != nil {
 				return fmt.Errorf("failed to make selection for download option: %v",
 					err)
@@ -156,46 +169,50 @@ func (p *Packages) Run(acq *acquisition.Acquisition, fast bool) error {
 		}
 
 		for ip := 0; ip < len(packages); ip++ {
+			if ctx.Err() != nil {
+				break
+			}
+
 			// If we the user did not request to download all packages and if
 			// the package is marked as system, we skip it.
 			if download != apkAll && packages[ip].System {
 				continue
 			}
 
-			log.Debugf("Found Android package: %s", packages[ip].Name)
+			acq.Log.Debugf("Found Android package: %s", packages[ip].Name)
 
 			for ipf := 0; ipf < len(packages[ip].Files); ipf++ {
 				packageFile := &packages[ip].Files[ipf]
 
 				if acq.StreamingMode && acq.EncryptedWriter != nil {
 					// Streaming mode: stream directly to encrypted zip without temp files
-					if err := p.processAPKStreaming(packages[ip].Name, packageFile, keepOption, acq); err != nil {
-						log.Debugf("ERROR: failed to process APK %s: %v", packageFile.Path, err)
+					if err := p.processAPKStreaming(ctx, packages[ip].Name, packageFile, keepOption, acq); err != nil {
+						acq.Log.Debugf("ERROR: failed to process APK %s: %v", packageFile.Path, err)
 						continue
 					}
 				} else {
 					// Traditional mode: download to local storage
 					localPath, err := p.getPathToLocalCopy(packages[ip].Name, packageFile.Path)
 					if err != nil {
-						log.Errorf("Skipping APK with unsafe path %q: %v", packageFile.Path, err)
+						acq.Log.Errorf("Skipping APK with unsafe path %q: %v", packageFile.Path, err)
 						packageFile.Error = err.Error()
 						continue
 					}
 
-					out, err := adb.Client.Pull(packageFile.Path, localPath)
+					out, err := acq.Client.PullContext(ctx, packageFile.Path, localPath)
 					if err != nil {
 						packageFile.Error = out
-						log.Debugf("ERROR: failed to download %s: %s", packageFile.Path, out)
+						acq.Log.Debugf("ERROR: failed to download %s: %s", packageFile.Path, out)
 						continue
 					}
 
-					log.Debugf("Downloaded %s to %s", packageFile.Path, localPath)
+					acq.Log.Debugf("Downloaded %s to %s", packageFile.Path, localPath)
 
 					// Check the certificate
 					verified, cert, err := utils.VerifyCertificate(localPath)
 					if cert == nil {
 						// Couldn't extract certificate
-						log.Debugf("Couldn't parse certificate for app %s", localPath)
+						acq.Log.Debugf("Couldn't parse certificate for app %s", localPath)
 						packageFile.CertificateError = err.Error()
 						packageFile.VerifiedCertificate = false
 					} else {
@@ -210,9 +227,9 @@ func (p *Packages) Run(acq *acquisition.Acquisition, fast bool) error {
 							if utils.IsTrusted(*cert) {
 								packageFile.TrustedCertificate = true
 								if keepOption == apkRemoveTrusted {
-									log.Debugf("Trusted APK removed: %s - %s",
+									acq.Log.Debugf("Trusted APK removed: %s - %s",
 										localPath, packageFile.SHA256)
-									os.Remove(localPath)
+									utils.RemoveFile(localPath)
 								}
 							}
 						}
@@ -222,50 +239,55 @@ func (p *Packages) Run(acq *acquisition.Acquisition, fast bool) error {
 		}
 	}
 
-	return saveDataToAcquisition(acq, "packages.json", &packages)
+	// Keep what was collected so far even if the module was interrupted.
+	err = saveDataToAcquisition(acq, "packages.json", &packages)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
 // processAPKStreaming handles APK processing in streaming mode
-func (p *Packages) processAPKStreaming(packageName string, packageFile *adb.PackageFile, keepOption string, acq *acquisition.Acquisition) error {
+func (p *Packages) processAPKStreaming(ctx context.Context, packageName string, packageFile *adb.PackageFile, keepOption string, acq *acquisition.Acquisition) error {
 	zipPath, err := p.generateZipPath(packageName, packageFile.Path)
 	if err != nil {
-		log.Errorf("Skipping APK with unsafe path %q: %v", packageFile.Path, err)
+		acq.Log.Errorf("Skipping APK with unsafe path %q: %v", packageFile.Path, err)
 		packageFile.Error = err.Error()
 		return nil
 	}
 
 	// For encrypted output, skip certificate processing entirely
 	if acq.EncryptedWriter != nil {
-		log.Debugf("Skipping certificate check for encrypted output: %s", packageFile.Path)
+		acq.Log.Debugf("Skipping certificate check for encrypted output: %s", packageFile.Path)
 	} else {
 		// Process certificate and determine if APK should be skipped (unencrypted output only)
-		shouldSkip, err := p.processCertificate(packageFile, keepOption, acq)
+		shouldSkip, err := p.processCertificate(ctx, packageFile, keepOption, acq)
 		if err != nil {
 			packageFile.Error = fmt.Sprintf("Certificate processing failed: %v", err)
 			return err
 		}
 
 		if shouldSkip {
-			log.Debugf("Trusted APK skipped for streaming: %s", packageFile.Path)
+			acq.Log.Debugf("Trusted APK skipped for streaming: %s", packageFile.Path)
 			return nil
 		}
 	}
 
 	// Stream APK directly to encrypted zip
-	err = acq.StreamAPKToZip(packageFile.Path, zipPath, nil)
+	err = acq.StreamAPKToZip(ctx, packageFile.Path, zipPath, nil)
 	if err != nil {
 		packageFile.Error = fmt.Sprintf("Failed to stream to encrypted archive: %v", err)
 		return err
 	}
 
-	log.Debugf("Streamed %s directly to encrypted archive as %s", packageFile.Path, zipPath)
+	acq.Log.Debugf("Streamed %s directly to encrypted archive as %s", packageFile.Path, zipPath)
 	return nil
 }
 
 // processCertificate handles certificate verification and returns whether APK should be skipped
-func (p *Packages) processCertificate(packageFile *adb.PackageFile, keepOption string, acq *acquisition.Acquisition) (bool, error) {
+func (p *Packages) processCertificate(ctx context.Context, packageFile *adb.PackageFile, keepOption string, acq *acquisition.Acquisition) (bool, error) {
 	// Pull APK to buffer for certificate verification
-	buffer, err := acq.StreamingPuller.PullToBuffer(packageFile.Path)
+	buffer, err := acq.StreamingPuller.PullToBufferContext(ctx, packageFile.Path)
 	if err != nil {
 		return false, fmt.Errorf("failed to pull APK for certificate verification: %v", err)
 	}
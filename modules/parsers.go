@@ -0,0 +1,90 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// propStart matches the first line of a property in the output of
+	// getprop, such as "[ro.product.model]: [Pixel 8]".
+	propStart = regexp.MustCompile(`^\[([^\]]+)\]: \[(.*)$`)
+	// settingStart and envStart match the first line of a setting in the
+	// output of `cmd settings list`, and of a variable in the output of env.
+	settingStart = regexp.MustCompile(`^([A-Za-z0-9_.:/-]+)=(.*)$`)
+	envStart     = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	// serviceLine matches a service in the output of `service list`, such
+	// as "12	nfc: [android.nfc.INfcAdapter]".
+	serviceLine = regexp.MustCompile(`^\d+\s+(.+?): \[(.*)\]$`)
+)
+
+// Service is a system service, with the interface it implements if known.
+type Service struct {
+	Name      string `json:"name"`
+	Interface string `json:"interface"`
+}
+
+// parseKeyValues returns the keys and values in out, where start matches
+// the first line of an entry and captures its key and the start of its
+// value. Lines which do not start an entry continue the value of the
+// previous one.
+func parseKeyValues(out string, start *regexp.Regexp) map[string]string {
+	values := make(map[string]string)
+	key := ""
+	var value strings.Builder
+	finish := func() {
+		if key != "" {
+			values[key] = value.String()
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n") {
+		if match := start.FindStringSubmatch(line); match != nil {
+			finish()
+			key = match[1]
+			value.Reset()
+			value.WriteString(match[2])
+		} else if key != "" {
+			value.WriteString("\n" + line)
+		}
+	}
+	finish()
+
+	return values
+}
+
+// parseProps returns the properties in the output of getprop.
+func parseProps(out string) map[string]string {
+	props := parseKeyValues(strings.TrimSpace(out), propStart)
+	for key, value := range props {
+		props[key] = strings.TrimSuffix(strings.TrimRight(value, " \n"), "]")
+	}
+	return props
+}
+
+// parseSettings returns the settings in the output of `cmd settings list`.
+func parseSettings(out string) map[string]string {
+	return parseKeyValues(strings.TrimSpace(out), settingStart)
+}
+
+// parseEnv returns the variables in the output of env.
+func parseEnv(out string) map[string]string {
+	return parseKeyValues(strings.TrimSpace(out), envStart)
+}
+
+// parseServices returns the services in the output of `service list`.
+func parseServices(out string) []Service {
+	services := []Service{}
+	for _, line := range strings.Split(out, "\n") {
+		match := serviceLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match != nil {
+			services = append(services, Service{Name: match[1], Interface: match[2]})
+		}
+	}
+	return services
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseProps(t *testing.T) {
+	props := parseProps("[ro.product.model]: [Pixel 8]\r\n" +
+		"[persist.sys.boot.reason.history]: [reboot,1700000000\n" +
+		"shutdown,userrequested,1690000000]\n" +
+		"[ro.empty]: []\n" +
+		"[ro.brackets]: [[a]: [b]]\n")
+
+	want := map[string]string{
+		"ro.product.model":                "Pixel 8",
+		"persist.sys.boot.reason.history": "reboot,1700000000\nshutdown,userrequested,1690000000",
+		"ro.empty":                        "",
+		"ro.brackets":                     "[a]: [b]",
+	}
+	if !maps.Equal(props, want) {
+		t.Fatalf("parseProps() = %q, want %q", props, want)
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	settings := parseSettings("adb_enabled=1\n" +
+		"enabled_accessibility_services=com.example/.Service\n" +
+		"lock_screen_owner_info=first line\n" +
+		"second line\n" +
+		"empty=\n")
+
+	want := map[string]string{
+		"adb_enabled":                    "1",
+		"enabled_accessibility_services": "com.example/.Service",
+		"lock_screen_owner_info":         "first line\nsecond line",
+		"empty":                          "",
+	}
+	if !maps.Equal(settings, want) {
+		t.Fatalf("parseSettings() = %q, want %q", settings, want)
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	env := parseEnv("PATH=/product/bin:/system/bin\nPS1=$(precmd)\n  two lines\nHOME=/\n")
+
+	want := map[string]string{
+		"PATH": "/product/bin:/system/bin",
+		"PS1":  "$(precmd)\n  two lines",
+		"HOME": "/",
+	}
+	if !maps.Equal(env, want) {
+		t.Fatalf("parseEnv() = %q, want %q", env, want)
+	}
+}
+
+func TestParseServices(t *testing.T) {
+	services := parseServices("Found 3 services:\n" +
+		"0\tnfc: [android.nfc.INfcAdapter]\n" +
+		"1\tcarrier_config: []\n" +
+		"2\tandroid.hardware.power.IPower/default: [android.hardware.power.IPower]\n")
+
+	want := []Service{
+		{Name: "nfc", Interface: "android.nfc.INfcAdapter"},
+		{Name: "carrier_config", Interface: ""},
+		{Name: "android.hardware.power.IPower/default", Interface: "android.hardware.power.IPower"},
+	}
+	if !slices.Equal(services, want) {
+		t.Fatalf("parseServices() = %+v, want %+v", services, want)
+	}
+}
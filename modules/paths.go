@@ -5,6 +5,7 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -14,7 +15,7 @@ import (
 )
 
 type pullToWriter interface {
-	PullToWriter(remotePath string, writer io.Writer) error
+	PullToWriterContext(ctx context.Context, remotePath string, writer io.Writer) error
 }
 
 func relativeDeviceChild(deviceRoot, devicePath string) (string, error) {
@@ -66,14 +67,14 @@ func createRootFile(root *os.Root, rel string) (*os.File, error) {
 	return file, nil
 }
 
-func streamDeviceChildToRoot(root *os.Root, puller pullToWriter, rel, devicePath string) error {
+func streamDeviceChildToRoot(ctx context.Context, root *os.Root, puller pullToWriter, rel, devicePath string) error {
 	file, err := createRootFile(root, rel)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	if err := puller.PullToWriter(devicePath, file); err != nil {
+	if err := puller.PullToWriterContext(ctx, devicePath, file); err != nil {
 		return err
 	}
 
@@ -5,17 +5,29 @@
 package modules
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
 	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Processes struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description:    "Lists the running processes.",
+		Duration:       "seconds",
+		Outputs:        []string{"processes.json", "processes.txt"},
+		NeedsCollector: true,
+		New:            func() Module { return NewProcesses() },
+	})
+}
+
 func NewProcesses() *Processes {
 	return &Processes{}
 }
@@ -24,26 +36,71 @@ func (p *Processes) Name() string {
 	return "processes"
 }
 
+func (p *Processes) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (p *Processes) InitStorage(storagePath string) error {
 	p.StoragePath = storagePath
 	return nil
 }
 
-func (p *Processes) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting list of running processes...")
+func (p *Processes) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting list of running processes...")
 
 	if acq.Collector == nil {
-		out, err := adb.Client.Shell("ps -A")
+		res, err := acq.Client.RunShellContext(ctx, "ps -A")
 		if err != nil {
 			return fmt.Errorf("failed to run `adb shell ps -A`: %v", err)
 		}
 
-		return saveStringToAcquisition(acq, "processes.txt", out)
+		return saveStringToAcquisition(acq, "processes.txt", strings.TrimSpace(res.Stdout))
 	} else {
-		out, err := acq.Collector.Processes()
+		// The slower details of each process are only collected when
+		// asked for, and never in fast mode.
+		opts := acq.Profile.ProcessOptions()
+		if fast {
+			opts = adb.ProcessOptions{}
+		}
+		out, err := acq.Collector.Processes(ctx, opts)
 		if err != nil {
 			return err
 		}
+		for _, process := range out {
+			// The collector itself runs from the temporary folder.
+			if process.Path == filepath.ToSlash(acq.Collector.ExePath) {
+				continue
+			}
+			for _, reason := range suspiciousProcess(process, acq.TmpDir) {
+				acq.Log.Warningf("Process %d (%s) %s", process.Pid, strings.Join(process.CommandLine, " "), reason)
+			}
+		}
 		return saveDataToAcquisition(acq, "processes.json", &out)
 	}
 }
+
+// suspiciousProcess returns why the process deserves a closer look: being
+// traced, or running or having mapped executable code from the temporary
+// folder or from a deleted file. Deleted shared memory, such as the JIT
+// cache, is not suspicious.
+func suspiciousProcess(process adb.ProcessInfo, tmpDir string) []string {
+	var reasons []string
+	if process.TracerPid != 0 {
+		reasons = append(reasons, fmt.Sprintf("is traced by process %d", process.TracerPid))
+	}
+	tmpDir = strings.TrimSuffix(tmpDir, "/") + "/"
+	if strings.HasPrefix(process.Path, tmpDir) {
+		reasons = append(reasons, fmt.Sprintf("runs from %s", process.Path))
+	}
+	for _, file := range process.Maps {
+		if !strings.Contains(file.Permissions, "x") || file.Path == process.Path {
+			continue
+		}
+		if strings.HasPrefix(file.Path, tmpDir) {
+			reasons = append(reasons, fmt.Sprintf("maps %s", file.Path))
+		} else if file.Deleted && !strings.HasPrefix(file.Path, "/memfd:") && !strings.HasPrefix(file.Path, "/dev/") {
+			reasons = append(reasons, fmt.Sprintf("maps deleted file %s", file.Path))
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mvt-project/androidqf/adb"
+)
+
+func TestSuspiciousProcess(t *testing.T) {
+	process := adb.ProcessInfo{
+		Path: "/system/bin/app_process64",
+		Maps: []adb.MappedFile{
+			{Path: "/system/bin/app_process64", Permissions: "r-x"},
+			{Path: "/system/lib64/libc.so", Permissions: "r-x"},
+			{Path: "/memfd:jit-cache", Permissions: "r-x", Deleted: true},
+			{Path: "/data/local/tmp/libhook.so", Permissions: "r-x"},
+			{Path: "/data/local/tmp/config", Permissions: "r--"},
+			{Path: "/data/data/com.example/libpayload.so", Permissions: "r-x", Deleted: true},
+		},
+	}
+	got := suspiciousProcess(process, "/data/local/tmp/")
+	want := []string{
+		"maps /data/local/tmp/libhook.so",
+		"maps deleted file /data/data/com.example/libpayload.so",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("suspiciousProcess() = %q, want %q", got, want)
+	}
+
+	process = adb.ProcessInfo{Path: "/data/local/tmp/implant", TracerPid: 42}
+	got = suspiciousProcess(process, "/data/local/tmp")
+	want = []string{"is traced by process 42", "runs from /data/local/tmp/implant"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("suspiciousProcess() = %q, want %q", got, want)
+	}
+
+	if got := suspiciousProcess(adb.ProcessInfo{Path: "/system/bin/init"}, "/data/local/tmp/"); len(got) != 0 {
+		t.Fatalf("suspiciousProcess() of a normal process = %q", got)
+	}
+}
@@ -0,0 +1,65 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"fmt"
+
+	"github.com/manifoldco/promptui"
+	"github.com/mvt-project/androidqf/acquisition"
+)
+
+// choice is an answer to a question, with the label shown to the user.
+type choice struct {
+	value string
+	label string
+}
+
+// ask returns the value of the chosen answer to a question. The answer comes
+// from the acquisition profile if it has one, is batchDefault in batch mode,
+// and is otherwise selected by the user. It is recorded in acquisition.json.
+// The batch default must not need anyone at the device or keep the
+// acquisition waiting.
+func ask(acq *acquisition.Acquisition, key, question, label string, choices []choice, batchDefault string) (string, error) {
+	if value, ok := acq.Profile.Answer(key); ok {
+		for _, c := range choices {
+			if c.value == value {
+				acq.Log.Infof("%s: %s (from profile)", label, c.label)
+				acq.SetAnswer(key, value, acquisition.AnswerFromProfile)
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("unsupported answer %q to %s in profile", value, key)
+	}
+
+	if acq.Profile.IsBatch() {
+		for _, c := range choices {
+			if c.value == batchDefault {
+				acq.Log.Infof("%s: %s (default)", label, c.label)
+				acq.SetAnswer(key, c.value, acquisition.AnswerFromDefault)
+				return c.value, nil
+			}
+		}
+		return "", fmt.Errorf("no default answer %q to %s", batchDefault, key)
+	}
+
+	acq.Log.Info(question)
+	items := make([]string, len(choices))
+	for i, c := range choices {
+		items[i] = c.label
+	}
+	prompt := promptui.Select{
+		Label: label,
+		Items: items,
+	}
+	idx, _, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+
+	acq.SetAnswer(key, choices[idx].value, acquisition.AnswerFromPrompt)
+	return choices[idx].value, nil
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"testing"
+
+	"github.com/mvt-project/androidqf/acquisition"
+)
+
+func TestAskBatchDefault(t *testing.T) {
+	acq := &acquisition.Acquisition{Profile: &acquisition.Profile{Batch: true}}
+	choices := []choice{{"sms", "Only SMS"}, {"everything", "Everything"}, {"none", "No backup"}}
+
+	value, err := ask(acq, acquisition.AnswerBackup, "Backup?", "Backup", choices, "none")
+	if err != nil || value != "none" {
+		t.Fatalf("ask() = %q, %v, want the batch default", value, err)
+	}
+	if answer := acq.Answers[acquisition.AnswerBackup]; answer.Value != "none" || answer.Source != acquisition.AnswerFromDefault {
+		t.Fatalf("recorded answer = %+v", answer)
+	}
+
+	acq.Profile.Backup = "sms"
+	if value, err := ask(acq, acquisition.AnswerBackup, "Backup?", "Backup", choices, "none"); err != nil || value != "sms" {
+		t.Fatalf("ask() = %q, %v, want the answer of the profile", value, err)
+	}
+
+	if _, err := ask(acq, acquisition.AnswerAPKs, "APKs?", "APKs", choices, "missing"); err == nil {
+		t.Fatal("ask() error = nil for a default which is not a choice")
+	}
+}
@@ -0,0 +1,130 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Info describes a module, so that analysts know what it collects before
+// running it.
+type Info struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Duration is a rough estimate of how long the module takes.
+	Duration string `json:"estimated_duration"`
+	// Outputs are the files and folders the module writes in the
+	// acquisition.
+	Outputs []string `json:"outputs"`
+	// NeedsCollector is set for modules relying on the collector binary
+	// pushed to the device, they fall back to slower commands without it.
+	NeedsCollector bool     `json:"needs_collector"`
+	Interactive    bool     `json:"interactive"`
+	Tags           []string `json:"tags"`
+	Dependencies   []string `json:"dependencies"`
+	// After are the modules this one runs after when they are selected.
+	After []string `json:"after"`
+
+	// New returns a new instance of the module.
+	New func() Module `json:"-"`
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Info)
+)
+
+// Register adds a module to the registry. Modules register themselves from
+// an init function. The name, tags, dependencies and ordering are taken from
+// the module itself.
+func Register(info Info) {
+	mod := info.New()
+	info.Name = mod.Name()
+	info.Tags = Tags(mod)
+	info.Dependencies = Dependencies(mod)
+	if info.Dependencies == nil {
+		info.Dependencies = []string{}
+	}
+	info.After = After(mod)
+	if info.After == nil {
+		info.After = []string{}
+	}
+	info.Interactive = slices.Contains(info.Tags, TagInteractive)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[info.Name]; exists {
+		panic(fmt.Sprintf("module %s registered twice", info.Name))
+	}
+	registry[info.Name] = info
+}
+
+// groupRank orders interactive modules first, so that all questions are
+// asked at the start, then quick modules, then the others.
+func groupRank(info Info) int {
+	switch {
+	case info.Interactive:
+		return 0
+	case slices.Contains(info.Tags, TagQuick):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Registered returns the description of all registered modules, in the
+// order they run.
+func Registered() []Info {
+	registryMu.Lock()
+	infos := make([]Info, 0, len(registry))
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	registryMu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		if groupRank(infos[i]) != groupRank(infos[j]) {
+			return groupRank(infos[i]) < groupRank(infos[j])
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// List returns new instances of all registered modules, in the order they
+// run.
+func List() []Module {
+	var mods []Module
+	for _, info := range Registered() {
+		mods = append(mods, info.New())
+	}
+	return mods
+}
+
+// ownsOutput returns a function telling whether a file of the acquisition is
+// one of the declared outputs of the module with the given name, or nil if
+// the module is not registered.
+func ownsOutput(name string) func(file string) bool {
+	registryMu.Lock()
+	info, ok := registry[name]
+	registryMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return func(file string) bool {
+		for _, output := range info.Outputs {
+			if file == output || (strings.HasSuffix(output, "/") && strings.HasPrefix(file, output)) {
+				return true
+			}
+		}
+		return false
+	}
+}
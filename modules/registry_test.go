@@ -0,0 +1,40 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"testing"
+)
+
+func TestRegistered(t *testing.T) {
+	infos := Registered()
+	if len(infos) == 0 {
+		t.Fatal("Registered() returned no modules")
+	}
+
+	seenOther := false
+	for _, info := range infos {
+		if info.Description == "" || info.Duration == "" || len(info.Outputs) == 0 {
+			t.Errorf("module %s is missing metadata: %+v", info.Name, info)
+		}
+		if info.New().Name() != info.Name {
+			t.Errorf("module %s creates instances named %s", info.Name, info.New().Name())
+		}
+		if !info.Interactive {
+			seenOther = true
+		} else if seenOther {
+			t.Errorf("interactive module %s is not ordered first", info.Name)
+		}
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register() did not panic for a duplicate module")
+		}
+	}()
+	Register(Info{New: func() Module { return NewGetProp() }})
+}
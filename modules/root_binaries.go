@@ -6,17 +6,27 @@
 package modules
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
 	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type RootBinaries struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Looks for binaries commonly left by rooting tools.",
+		Duration:    "seconds",
+		Outputs:     []string{"root_binaries.json"},
+		New:         func() Module { return NewRootBinaries() },
+	})
+}
+
 func NewRootBinaries() *RootBinaries {
 	return &RootBinaries{}
 }
@@ -25,13 +35,17 @@ func (r *RootBinaries) Name() string {
 	return "root_binaries"
 }
 
+func (r *RootBinaries) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (r *RootBinaries) InitStorage(storagePath string) error {
 	r.StoragePath = storagePath
 	return nil
 }
 
-func (r *RootBinaries) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Checking for traces of rooting")
+func (r *RootBinaries) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Checking for traces of rooting")
 	root_binaries := []string{
 		"su",
 		"busybox",
@@ -46,19 +60,21 @@ func (r *RootBinaries) Run(acq *acquisition.Acquisition, fast bool) error {
 	}
 	found_root_binaries := []string{}
 	for _, binary := range root_binaries {
-		out, err := adb.Client.Shell("which -a ", binary)
+		res, err := acq.Client.RunShellContext(ctx, "which", "-a", binary)
 		if err != nil {
-			// returns 1 if file not found, ignore
-			continue
-		}
-		if out == "" {
-			continue
+			if adb.IsExitError(err) {
+				// which exits with 1 if the binary is not found
+				continue
+			}
+			return fmt.Errorf("failed to run `adb shell which -a %s`: %v", binary, err)
 		}
-		if strings.Contains(out, "which: not found") {
-			continue
+		for _, path := range strings.Split(strings.TrimSpace(res.Stdout), "\n") {
+			if path == "" {
+				continue
+			}
+			acq.Log.Debugf("Found root binary: %s", path)
+			found_root_binaries = append(found_root_binaries, path)
 		}
-		log.Debugf("Found root binary: %s", out)
-		found_root_binaries = append(found_root_binaries, out)
 	}
 
 	return saveDataToAcquisition(acq, "root_binaries.json", &found_root_binaries)
@@ -0,0 +1,253 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mvt-project/androidqf/acquisition"
+)
+
+// maxDisconnections is how many times a module is run again after the
+// device was disconnected, before giving up on it.
+const maxDisconnections = 3
+
+// Device is the device being acquired, as far as the runner is concerned.
+type Device interface {
+	// Connected returns whether the device is connected.
+	Connected() bool
+	// Reconnect waits until the device is connected again.
+	Reconnect(ctx context.Context) error
+}
+
+// Runner executes modules against an acquisition.
+type Runner struct {
+	Fast bool
+	// Parallel is how many modules run at the same time, one if zero.
+	// Interactive modules always run one at a time, before the others.
+	Parallel int
+	// Timeout is the time limit applied to every module, zero means none.
+	Timeout time.Duration
+	// Timeouts overrides Timeout for specific modules, by module name.
+	Timeouts map[string]time.Duration
+	// Device, if set, is checked after every module. When it was
+	// disconnected, the runner waits for it and runs the module again.
+	Device Device
+	// Progress, if set, is called when a module starts, with a nil result,
+	// and when it is done.
+	Progress func(name string, result *acquisition.ModuleResult)
+}
+
+func (r *Runner) progress(name string, result *acquisition.ModuleResult) {
+	if r.Progress != nil {
+		r.Progress(name, result)
+	}
+}
+
+// timeoutFor returns the time limit of the module with the given name.
+func (r *Runner) timeoutFor(name string) time.Duration {
+	if timeout, ok := r.Timeouts[name]; ok {
+		return timeout
+	}
+	return r.Timeout
+}
+
+// Run executes the modules in order and records their results in the
+// acquisition. A module exceeding its timeout is aborted and the next one is
+// started. When ctx is cancelled the running module is aborted and recorded
+// as interrupted, the remaining ones are recorded as skipped, and the context
+// error is returned.
+//
+// With Parallel above one, the interactive modules run first in order, then
+// the others run concurrently, each after the modules it depends on or
+// runs after.
+func (r *Runner) Run(ctx context.Context, acq *acquisition.Acquisition, mods []Module) error {
+	sequential, concurrent := mods, []Module(nil)
+	if r.Parallel > 1 {
+		sequential = nil
+		for _, mod := range mods {
+			if slices.Contains(Tags(mod), TagInteractive) {
+				sequential = append(sequential, mod)
+			} else {
+				concurrent = append(concurrent, mod)
+			}
+		}
+	}
+
+	for _, mod := range sequential {
+		r.runAndRecord(ctx, acq, mod)
+	}
+	if len(concurrent) == 0 {
+		return ctx.Err()
+	}
+
+	// Every module waits for the end of its dependencies and of the
+	// modules it runs after, then for a free slot.
+	done := make(map[string]chan struct{}, len(concurrent))
+	for _, mod := range concurrent {
+		done[mod.Name()] = make(chan struct{})
+	}
+	slots := make(chan struct{}, r.Parallel)
+	var wg sync.WaitGroup
+	for _, mod := range concurrent {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[mod.Name()])
+
+			for _, prev := range slices.Concat(Dependencies(mod), After(mod)) {
+				if ch, ok := done[prev]; ok {
+					<-ch
+				}
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			r.runAndRecord(ctx, acq, mod)
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// runAndRecord runs the module unless the acquisition was interrupted, and
+// records its result.
+func (r *Runner) runAndRecord(ctx context.Context, acq *acquisition.Acquisition, mod Module) {
+	if ctx.Err() != nil {
+		result := acquisition.ModuleResult{
+			Name:   mod.Name(),
+			Status: acquisition.ModuleSkipped,
+			Note:   "acquisition interrupted",
+		}
+		acq.AddModuleResult(result)
+		r.progress(mod.Name(), &result)
+		return
+	}
+
+	r.progress(mod.Name(), nil)
+	result := r.runConnected(ctx, acq, mod)
+	acq.AddModuleResult(result)
+	r.progress(mod.Name(), &result)
+	err := acq.StoreProgress()
+	if err != nil {
+		acq.Log.Debugf("Failed to save the acquisition progress: %v", err)
+	}
+}
+
+// runConnected runs the module, and runs it again once the device is back
+// if it was disconnected in the meantime.
+func (r *Runner) runConnected(ctx context.Context, acq *acquisition.Acquisition, mod Module) acquisition.ModuleResult {
+	for disconnections := 0; ; disconnections++ {
+		result := r.runModule(ctx, acq, mod)
+		result.Disconnections = disconnections
+		if r.Device == nil || result.Status == acquisition.ModuleInterrupted || r.Device.Connected() {
+			return result
+		}
+
+		result.Disconnections++
+		if result.Disconnections > maxDisconnections {
+			acq.Log.Errorf("ERROR: giving up on module %s, the device was disconnected %d times", mod.Name(), result.Disconnections)
+			result.Status = acquisition.ModuleFailed
+			result.Error = "device disconnected"
+			return result
+		}
+
+		acq.Log.Warningf("The device was disconnected during module %s, waiting for it to be connected again (Ctrl+C to stop)...", mod.Name())
+		err := r.Device.Reconnect(ctx)
+		if err != nil {
+			acq.MarkInterrupted(mod.Name())
+			result.Status = acquisition.ModuleInterrupted
+			result.Error = "device disconnected"
+			return result
+		}
+		acq.Log.Infof("The device is connected again, running module %s again.", mod.Name())
+	}
+}
+
+func (r *Runner) runModule(ctx context.Context, acq *acquisition.Acquisition, mod Module) acquisition.ModuleResult {
+	result := acquisition.ModuleResult{
+		Name:    mod.Name(),
+		Started: time.Now().UTC(),
+	}
+	before := acq.SnapshotOutput()
+
+	err := mod.InitStorage(acq.StoragePath)
+	if err != nil {
+		acq.Log.Infof(
+			"ERROR: failed to initialize storage for module %s: %v",
+			mod.Name(),
+			err,
+		)
+		result.Status = acquisition.ModuleFailed
+		result.Error = fmt.Sprintf("failed to initialize storage: %v", err)
+		result.Completed = time.Now().UTC()
+		return result
+	}
+
+	modCtx, cancel := ctx, context.CancelFunc(func() {})
+	timeout := r.timeoutFor(mod.Name())
+	if timeout > 0 {
+		modCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	err = mod.Run(modCtx, acq, r.Fast)
+	cancel()
+
+	switch {
+	case ctx.Err() != nil:
+		acq.Log.Warningf("Module %s was interrupted", mod.Name())
+		acq.MarkInterrupted(mod.Name())
+		result.Status = acquisition.ModuleInterrupted
+		result.Error = ctx.Err().Error()
+	case errors.Is(modCtx.Err(), context.DeadlineExceeded):
+		acq.Log.Errorf("ERROR: module %s timed out after %s", mod.Name(), timeout)
+		result.Status = acquisition.ModuleTimedOut
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
+	case err != nil:
+		acq.Log.Infof("ERROR: failed to run module %s: %v", mod.Name(), err)
+		result.Status = acquisition.ModuleFailed
+		result.Error = err.Error()
+	default:
+		result.Status = acquisition.ModuleCompleted
+	}
+
+	result.Files, result.Bytes = acq.OutputSince(before, ownsOutput(mod.Name()))
+	result.Completed = time.Now().UTC()
+	return result
+}
+
+// ParseTimeouts parses per-module timeouts in the form
+// "name=duration[,name=duration...]", for example "bugreport=20m,dumpsys=5m".
+func ParseTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	if strings.TrimSpace(value) == "" {
+		return timeouts, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		name, duration, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid module timeout %q, expected name=duration", item)
+		}
+		timeout, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for module %s: %v", name, err)
+		}
+		if timeout < 0 {
+			return nil, fmt.Errorf("invalid timeout for module %s: must not be negative", name)
+		}
+		timeouts[name] = timeout
+	}
+
+	return timeouts, nil
+}
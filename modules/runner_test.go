@@ -0,0 +1,263 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mvt-project/androidqf/acquisition"
+)
+
+// fakeModule blocks until its context is done when block is set, writes
+// output to its own file when output is set and fails with err.
+type fakeModule struct {
+	name   string
+	block  bool
+	ran    bool
+	onRun  func()
+	output string
+	err    error
+	tags   []string
+	deps   []string
+}
+
+func (m *fakeModule) Tags() []string         { return m.tags }
+func (m *fakeModule) Dependencies() []string { return m.deps }
+
+func (m *fakeModule) Name() string                         { return m.name }
+func (m *fakeModule) InitStorage(storagePath string) error { return nil }
+
+func (m *fakeModule) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	m.ran = true
+	if m.onRun != nil {
+		m.onRun()
+	}
+	if m.output != "" {
+		err := saveStringToAcquisition(acq, m.name+".txt", m.output)
+		if err != nil {
+			return err
+		}
+	}
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return m.err
+}
+
+// statuses returns the recorded status of every module, by name.
+func statuses(acq *acquisition.Acquisition) map[string]string {
+	result := make(map[string]string)
+	for _, module := range acq.Modules {
+		result[module.Name] = module.Status
+	}
+	return result
+}
+
+func TestParseTimeouts(t *testing.T) {
+	timeouts, err := ParseTimeouts("bugreport=20m, dumpsys=90s")
+	if err != nil {
+		t.Fatalf("ParseTimeouts() error = %v", err)
+	}
+	if timeouts["bugreport"] != 20*time.Minute || timeouts["dumpsys"] != 90*time.Second {
+		t.Fatalf("ParseTimeouts() = %v", timeouts)
+	}
+
+	for _, value := range []string{"bugreport", "=1m", "dumpsys=soon", "dumpsys=-1s"} {
+		if _, err := ParseTimeouts(value); err == nil {
+			t.Errorf("ParseTimeouts(%q) error = nil", value)
+		}
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	slow := &fakeModule{name: "slow", block: true}
+	next := &fakeModule{name: "next"}
+	acq := &acquisition.Acquisition{}
+
+	runner := Runner{Timeouts: map[string]time.Duration{"slow": 50 * time.Millisecond}}
+	if err := runner.Run(context.Background(), acq, []Module{slow, next}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !next.ran {
+		t.Fatal("module after a timed out module did not run")
+	}
+	if acq.Interrupted {
+		t.Fatal("timed out module recorded as interrupted")
+	}
+	got := statuses(acq)
+	if got["slow"] != acquisition.ModuleTimedOut || got["next"] != acquisition.ModuleCompleted {
+		t.Fatalf("module statuses = %v", got)
+	}
+}
+
+func TestRunnerInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	current := &fakeModule{name: "current", block: true, onRun: cancel}
+	next := &fakeModule{name: "next"}
+	acq := &acquisition.Acquisition{}
+
+	runner := Runner{}
+	if err := runner.Run(ctx, acq, []Module{current, next}); err != context.Canceled {
+		t.Fatalf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if next.ran {
+		t.Fatal("module after the interrupted one was run")
+	}
+	if !acq.Interrupted || acq.InterruptedIn != "current" {
+		t.Fatalf("acquisition interrupted = %v in %q", acq.Interrupted, acq.InterruptedIn)
+	}
+	got := statuses(acq)
+	if got["current"] != acquisition.ModuleInterrupted || got["next"] != acquisition.ModuleSkipped {
+		t.Fatalf("module statuses = %v", got)
+	}
+	if note := acq.Modules[1].Note; note != "acquisition interrupted" {
+		t.Fatalf("skipped module note = %q", note)
+	}
+}
+
+func TestRunnerRecordsOutput(t *testing.T) {
+	acq := &acquisition.Acquisition{StoragePath: t.TempDir()}
+	err := os.WriteFile(filepath.Join(acq.StoragePath, "earlier.txt"), []byte("earlier"), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	writer := &fakeModule{name: "writer", output: "collected"}
+	failing := &fakeModule{name: "failing", err: errors.New("device refused")}
+
+	runner := Runner{}
+	if err := runner.Run(context.Background(), acq, []Module{writer, failing}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(acq.Modules) != 2 {
+		t.Fatalf("recorded %d modules, want 2", len(acq.Modules))
+	}
+
+	result := acq.Modules[0]
+	if result.Status != acquisition.ModuleCompleted {
+		t.Fatalf("writer status = %q", result.Status)
+	}
+	if len(result.Files) != 1 || result.Files[0] != "writer.txt" || result.Bytes != int64(len("collected")) {
+		t.Fatalf("writer output = %v, %d bytes", result.Files, result.Bytes)
+	}
+	if result.Started.IsZero() || result.Completed.Before(result.Started) {
+		t.Fatalf("writer ran from %v to %v", result.Started, result.Completed)
+	}
+
+	result = acq.Modules[1]
+	if result.Status != acquisition.ModuleFailed || result.Error != "device refused" {
+		t.Fatalf("failing result = %q, %q", result.Status, result.Error)
+	}
+	if result.Files == nil || len(result.Files) != 0 {
+		t.Fatalf("failing output = %v", result.Files)
+	}
+}
+
+// fakeDevice is unplugged by the modules and plugged back by Reconnect.
+type fakeDevice struct {
+	connected  bool
+	reconnects int
+}
+
+func (d *fakeDevice) Connected() bool { return d.connected }
+
+func (d *fakeDevice) Reconnect(ctx context.Context) error {
+	d.reconnects++
+	d.connected = true
+	return nil
+}
+
+func TestRunnerReconnects(t *testing.T) {
+	device := &fakeDevice{connected: true}
+	runs := 0
+	flaky := &fakeModule{name: "flaky"}
+	flaky.onRun = func() {
+		runs++
+		if runs == 1 {
+			device.connected = false
+		}
+	}
+	unplugging := &fakeModule{name: "unplugging", onRun: func() { device.connected = false }}
+	acq := &acquisition.Acquisition{}
+
+	runner := Runner{Device: device}
+	if err := runner.Run(context.Background(), acq, []Module{flaky, unplugging}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if runs != 2 {
+		t.Fatalf("flaky module ran %d times, want 2", runs)
+	}
+
+	result, _ := acq.Result("flaky")
+	if result.Status != acquisition.ModuleCompleted || result.Disconnections != 1 {
+		t.Fatalf("flaky result = %q after %d disconnections", result.Status, result.Disconnections)
+	}
+	result, _ = acq.Result("unplugging")
+	if result.Status != acquisition.ModuleFailed || result.Disconnections != maxDisconnections+1 {
+		t.Fatalf("unplugging result = %q after %d disconnections", result.Status, result.Disconnections)
+	}
+	if device.reconnects != 1+maxDisconnections {
+		t.Fatalf("device reconnected %d times, want %d", device.reconnects, 1+maxDisconnections)
+	}
+}
+
+func TestRunnerParallel(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	running, maxRunning := 0, 0
+	module := func(name string, tags, deps []string) *fakeModule {
+		return &fakeModule{name: name, tags: tags, deps: deps, onRun: func() {
+			mu.Lock()
+			events = append(events, "start "+name)
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			events = append(events, "end "+name)
+			running--
+			mu.Unlock()
+		}}
+	}
+
+	mods := []Module{
+		module("prompting", []string{TagInteractive}, nil),
+		module("files", nil, nil),
+		module("temp", nil, []string{"files"}),
+		module("getprop", nil, nil),
+		module("env", nil, nil),
+	}
+	acq := &acquisition.Acquisition{}
+
+	runner := Runner{Parallel: 2}
+	if err := runner.Run(context.Background(), acq, mods); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if maxRunning != 2 {
+		t.Fatalf("at most %d modules ran at the same time, want 2", maxRunning)
+	}
+	if events[0] != "start prompting" || events[1] != "end prompting" {
+		t.Fatalf("interactive module did not run alone first: %v", events)
+	}
+	if slices.Index(events, "start temp") < slices.Index(events, "end files") {
+		t.Fatalf("module started before its dependency ended: %v", events)
+	}
+	if len(acq.Modules) != len(mods) {
+		t.Fatalf("recorded %d modules, want %d", len(acq.Modules), len(mods))
+	}
+}
@@ -0,0 +1,156 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Tags used to select groups of modules.
+const (
+	// TagQuick marks modules that only take a few seconds.
+	TagQuick = "quick"
+	// TagHeavy marks modules that can take long or produce a lot of data.
+	TagHeavy = "heavy"
+	// TagInteractive marks modules that ask the user questions.
+	TagInteractive = "interactive"
+)
+
+// Tagged is implemented by modules that belong to groups which can be
+// selected together, like "quick".
+type Tagged interface {
+	Tags() []string
+}
+
+// Dependent is implemented by modules that need other modules to have run
+// before them.
+type Dependent interface {
+	Dependencies() []string
+}
+
+// Ordered is implemented by modules that must run after other modules when
+// those are selected too, without needing them.
+type Ordered interface {
+	After() []string
+}
+
+// Tags returns the tags of a module.
+func Tags(mod Module) []string {
+	if tagged, ok := mod.(Tagged); ok {
+		return tagged.Tags()
+	}
+	return nil
+}
+
+// Dependencies returns the names of the modules a module depends on.
+func Dependencies(mod Module) []string {
+	if dependent, ok := mod.(Dependent); ok {
+		return dependent.Dependencies()
+	}
+	return nil
+}
+
+// After returns the names of the modules a module runs after, if they are
+// selected.
+func After(mod Module) []string {
+	if ordered, ok := mod.(Ordered); ok {
+		return ordered.After()
+	}
+	return nil
+}
+
+// SplitList splits a comma-separated list of module names or tags.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// matches reports whether a module is designated by a name or a tag.
+func matches(mod Module, item string) bool {
+	return mod.Name() == item || slices.Contains(Tags(mod), item)
+}
+
+// Select returns the modules to run: those matching include (all of them if
+// it is empty) and not matching skip, each item being a module name or a tag.
+// The order of mods is kept, except that dependencies, and the selected
+// modules another one runs after, are moved just before it. Unknown names and
+// dependencies that are not selected are errors.
+func Select(mods []Module, include, skip []string) ([]Module, error) {
+	for _, item := range append(slices.Clone(include), skip...) {
+		if !slices.ContainsFunc(mods, func(mod Module) bool { return matches(mod, item) }) {
+			return nil, fmt.Errorf("unknown module or tag %q", item)
+		}
+	}
+
+	selected := make(map[string]Module)
+	for _, mod := range mods {
+		if len(include) > 0 && !slices.ContainsFunc(include, func(item string) bool { return matches(mod, item) }) {
+			continue
+		}
+		if slices.ContainsFunc(skip, func(item string) bool { return matches(mod, item) }) {
+			continue
+		}
+		selected[mod.Name()] = mod
+	}
+
+	for _, mod := range mods {
+		if _, ok := selected[mod.Name()]; !ok {
+			continue
+		}
+		for _, dep := range Dependencies(mod) {
+			if _, ok := selected[dep]; !ok {
+				return nil, fmt.Errorf("module %s depends on module %s, which is not selected", mod.Name(), dep)
+			}
+		}
+	}
+
+	// Depth-first ordering: each module is preceded by its dependencies and
+	// by the selected modules it runs after.
+	var ordered []Module
+	state := make(map[string]int) // 1 = visiting, 2 = done
+	var visit func(mod Module) error
+	visit = func(mod Module) error {
+		switch state[mod.Name()] {
+		case 1:
+			return fmt.Errorf("circular dependency involving module %s", mod.Name())
+		case 2:
+			return nil
+		}
+		state[mod.Name()] = 1
+		for _, dep := range Dependencies(mod) {
+			if err := visit(selected[dep]); err != nil {
+				return err
+			}
+		}
+		for _, name := range After(mod) {
+			if prev, ok := selected[name]; ok {
+				if err := visit(prev); err != nil {
+					return err
+				}
+			}
+		}
+		state[mod.Name()] = 2
+		ordered = append(ordered, mod)
+		return nil
+	}
+	for _, mod := range mods {
+		if _, ok := selected[mod.Name()]; ok {
+			if err := visit(mod); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ordered, nil
+}
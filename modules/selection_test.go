@@ -0,0 +1,111 @@
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package modules
+
+import (
+	"slices"
+	"testing"
+)
+
+func moduleNames(mods []Module) []string {
+	names := make([]string, len(mods))
+	for i, mod := range mods {
+		names[i] = mod.Name()
+	}
+	return names
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		skip    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "everything",
+			want: moduleNames(List()),
+		},
+		{
+			name:    "names",
+			include: []string{"getprop", "selinux"},
+			want:    []string{"getprop", "selinux"},
+		},
+		{
+			name:    "tag with skip",
+			include: []string{TagInteractive},
+			skip:    []string{"backup"},
+			want:    []string{"intrusion_logs", "packages"},
+		},
+		{
+			name:    "ordered after a selected module",
+			include: []string{"temp", "files"},
+			want:    []string{"files", "temp"},
+		},
+		{
+			name:    "ordered after a module not selected",
+			include: []string{"temp"},
+			want:    []string{"temp"},
+		},
+		{
+			name:    "module ordered before another skipped",
+			include: []string{"getprop", "temp", "files"},
+			skip:    []string{"files"},
+			want:    []string{"getprop", "temp"},
+		},
+		{
+			name:    "unknown module",
+			include: []string{"nope"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Select(List(), tt.include, tt.skip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(moduleNames(got), tt.want) {
+				t.Fatalf("Select() = %v, want %v", moduleNames(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectDependencies(t *testing.T) {
+	mods := []Module{&fakeModule{name: "b", deps: []string{"a"}}, &fakeModule{name: "a"}}
+	got, err := Select(mods, nil, nil)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if want := []string{"a", "b"}; !slices.Equal(moduleNames(got), want) {
+		t.Fatalf("Select() = %v, want %v", moduleNames(got), want)
+	}
+
+	_, err = Select(mods, nil, []string{"a"})
+	if err == nil {
+		t.Fatal("Select() without the dependency succeeded")
+	}
+}
+
+func TestSelectOrdersBeforeDependents(t *testing.T) {
+	// temp is listed before files here: files is moved just before it.
+	mods := []Module{NewTemp(), NewGetProp(), NewFiles()}
+	got, err := Select(mods, nil, nil)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if want := []string{"files", "temp", "getprop"}; !slices.Equal(moduleNames(got), want) {
+		t.Fatalf("Select() = %v, want %v", moduleNames(got), want)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	if got := SplitList(" files, ,temp,"); !slices.Equal(got, []string{"files", "temp"}) {
+		t.Fatalf("SplitList() = %v", got)
+	}
+}
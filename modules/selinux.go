@@ -5,17 +5,26 @@
 package modules
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type SELinux struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Collects the SELinux enforcement status.",
+		Duration:    "seconds",
+		Outputs:     []string{"selinux.txt", "selinux.json"},
+		New:         func() Module { return NewSELinux() },
+	})
+}
+
 func NewSELinux() *SELinux {
 	return &SELinux{}
 }
@@ -24,18 +33,28 @@ func (s *SELinux) Name() string {
 	return "selinux"
 }
 
+func (s *SELinux) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (s *SELinux) InitStorage(storagePath string) error {
 	s.StoragePath = storagePath
 	return nil
 }
 
-func (s *SELinux) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting SELinux status...")
+func (s *SELinux) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting SELinux status...")
 
-	out, err := adb.Client.Shell("getenforce")
+	res, err := acq.Client.RunShellContext(ctx, "getenforce")
 	if err != nil {
 		return fmt.Errorf("failed to run `adb shell getenforce`: %v", err)
 	}
 
-	return saveStringToAcquisition(acq, "selinux.txt", out)
+	status := strings.TrimSpace(res.Stdout)
+	err = saveStringToAcquisition(acq, "selinux.txt", status)
+	if err != nil {
+		return err
+	}
+
+	return saveDataToAcquisition(acq, "selinux.json", map[string]string{"mode": strings.ToLower(status)})
 }
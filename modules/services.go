@@ -5,17 +5,26 @@
 package modules
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Services struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Lists the system services.",
+		Duration:    "seconds",
+		Outputs:     []string{"services.txt", "services.json"},
+		New:         func() Module { return NewServices() },
+	})
+}
+
 func NewServices() *Services {
 	return &Services{}
 }
@@ -24,18 +33,27 @@ func (s *Services) Name() string {
 	return "services"
 }
 
+func (s *Services) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (s *Services) InitStorage(storagePath string) error {
 	s.StoragePath = storagePath
 	return nil
 }
 
-func (s *Services) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting list of services...")
+func (s *Services) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting list of services...")
 
-	out, err := adb.Client.Shell("service list")
+	res, err := acq.Client.RunShellContext(ctx, "service list")
 	if err != nil {
 		return fmt.Errorf("failed to run `adb shell service list`: %v", err)
 	}
 
-	return saveStringToAcquisition(acq, "services.txt", out)
+	err = saveStringToAcquisition(acq, "services.txt", strings.TrimSpace(res.Stdout))
+	if err != nil {
+		return err
+	}
+
+	return saveDataToAcquisition(acq, "services.json", parseServices(res.Stdout))
 }
@@ -5,17 +5,29 @@
 package modules
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Settings struct {
 	StoragePath string
 }
 
+func init() {
+	Register(Info{
+		Description: "Collects the system, secure and global settings.",
+		Duration:    "seconds",
+		Outputs: []string{
+			"settings_system.txt", "settings_secure.txt", "settings_global.txt",
+			"settings_system.json", "settings_secure.json", "settings_global.json",
+		},
+		New: func() Module { return NewSettings() },
+	})
+}
+
 func NewSettings() *Settings {
 	return &Settings{}
 }
@@ -24,23 +36,31 @@ func (s *Settings) Name() string {
 	return "settings"
 }
 
+func (s *Settings) Tags() []string {
+	return []string{TagQuick}
+}
+
 func (s *Settings) InitStorage(storagePath string) error {
 	s.StoragePath = storagePath
 	return nil
 }
 
-func (s *Settings) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting device settings...")
+func (s *Settings) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting device settings...")
 
 	for _, namespace := range []string{"system", "secure", "global"} {
-		out, err := adb.Client.Shell(fmt.Sprintf("cmd settings list %s", namespace))
+		res, err := acq.Client.RunShellContext(ctx, fmt.Sprintf("cmd settings list %s", namespace))
 		if err != nil {
 			return fmt.Errorf("failed to run `cmd settings %s`: %v", namespace, err)
 		}
 
-		err = saveStringToAcquisition(acq, fmt.Sprintf("settings_%s.txt", namespace), out)
+		err = saveStringToAcquisition(acq, fmt.Sprintf("settings_%s.txt", namespace), strings.TrimSpace(res.Stdout))
+		if err != nil {
+			acq.Log.Errorf("Impossible to save settings: %v", err)
+		}
+		err = saveDataToAcquisition(acq, fmt.Sprintf("settings_%s.json", namespace), parseSettings(res.Stdout))
 		if err != nil {
-			log.Errorf("Impossible to save settings: %v", err)
+			acq.Log.Errorf("Impossible to save parsed settings: %v", err)
 		}
 	}
 
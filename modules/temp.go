@@ -5,6 +5,7 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -12,8 +13,6 @@ import (
 
 	"github.com/botherder/go-savetime/text"
 	"github.com/mvt-project/androidqf/acquisition"
-	"github.com/mvt-project/androidqf/adb"
-	"github.com/mvt-project/androidqf/log"
 )
 
 type Temp struct {
@@ -21,6 +20,15 @@ type Temp struct {
 	TempPath    string
 }
 
+func init() {
+	Register(Info{
+		Description: "Copies the files in the temporary folders.",
+		Duration:    "1-5 minutes",
+		Outputs:     []string{"tmp/"},
+		New:         func() Module { return NewTemp() },
+	})
+}
+
 func NewTemp() *Temp {
 	return &Temp{}
 }
@@ -29,6 +37,16 @@ func (t *Temp) Name() string {
 	return "temp"
 }
 
+func (t *Temp) Tags() []string {
+	return []string{TagHeavy}
+}
+
+// After makes files run first when both are selected, so that the access
+// times it records are not those of temp pulling the files.
+func (t *Temp) After() []string {
+	return []string{"files"}
+}
+
 func (t *Temp) InitStorage(storagePath string) error {
 	t.StoragePath = storagePath
 	t.TempPath = filepath.Join(storagePath, "tmp")
@@ -44,8 +62,8 @@ func (t *Temp) InitStorage(storagePath string) error {
 	return nil
 }
 
-func (t *Temp) Run(acq *acquisition.Acquisition, fast bool) error {
-	log.Info("Collecting files in tmp folder...")
+func (t *Temp) Run(ctx context.Context, acq *acquisition.Acquisition, fast bool) error {
+	acq.Log.Info("Collecting files in tmp folder...")
 
 	streaming := acq.StreamingMode && acq.EncryptedWriter != nil
 	var localRoot *os.Root
@@ -57,23 +75,26 @@ func (t *Temp) Run(acq *acquisition.Acquisition, fast bool) error {
 			return fmt.Errorf("failed to open tmp output root: %v", err)
 		}
 		defer localRoot.Close()
-		puller = acquisition.NewStreamingPuller(adb.Client.ExePath, adb.Client.Serial, 100)
+		puller = acquisition.NewStreamingPuller(acq.Client, 100)
 	}
 
 	// TODO: Also check default tmp folders
-	tmpFiles, err := adb.Client.ListFiles(acq.TmpDir, true)
+	tmpFiles, err := acq.Client.ListFilesContext(ctx, acq.TmpDir, true)
 	if err != nil {
 		return fmt.Errorf("failed to list files in tmp: %v", err)
 	}
 
 	for _, file := range tmpFiles {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if file == acq.TmpDir {
 			continue
 		}
 
 		rel, err := relativeDeviceChild(acq.TmpDir, file)
 		if err != nil {
-			log.Errorf("Skipping temp file with unsafe path %s: %v\n", file, err)
+			acq.Log.Errorf("Skipping temp file with unsafe path %s: %v\n", file, err)
 			continue
 		}
 
@@ -84,23 +105,24 @@ func (t *Temp) Run(acq *acquisition.Acquisition, fast bool) error {
 			// Create zip entry writer
 			writer, err := acq.EncryptedWriter.CreateFile(zipPath)
 			if err != nil {
-				log.Errorf("Failed to create zip entry for temp file %s: %v\n", file, err)
+				acq.Log.Errorf("Failed to create zip entry for temp file %s: %v\n", file, err)
 				continue
 			}
 
 			// Stream temp file directly to encrypted zip using acquisition's streaming puller
-			err = acq.StreamingPuller.PullToWriter(file, writer)
+			err = acq.StreamingPuller.PullToWriterContext(ctx, file, writer)
+			writer.Close()
 			if err != nil {
-				log.Errorf("Failed to stream temp file %s: %v\n", file, err)
+				acq.Log.Errorf("Failed to stream temp file %s: %v\n", file, err)
 				continue
 			}
 
-			log.Debugf("Streamed temp file %s directly to encrypted archive as %s", file, zipPath)
+			acq.Log.Debugf("Streamed temp file %s directly to encrypted archive as %s", file, zipPath)
 		} else {
 			// Traditional mode: stream into a file opened relative to t.TempPath.
-			if err := streamDeviceChildToRoot(localRoot, puller, rel, file); err != nil {
+			if err := streamDeviceChildToRoot(ctx, localRoot, puller, rel, file); err != nil {
 				if !text.ContainsNoCase(err.Error(), "Permission denied") {
-					log.Errorf("Failed to pull temp file %s: %v\n", file, err)
+					acq.Log.Errorf("Failed to pull temp file %s: %v\n", file, err)
 				}
 				continue
 			}
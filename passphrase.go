@@ -0,0 +1,57 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/manifoldco/promptui"
+)
+
+// passphraseEnv is where the passphrase is read from, instead of asking for
+// it, for unattended acquisitions.
+const passphraseEnv = "ANDROIDQF_PASSPHRASE"
+
+// readPassphrase returns the passphrase from passphraseEnv, or asks for it,
+// twice if confirm is set.
+func readPassphrase(batch, confirm bool) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if batch {
+		return "", fmt.Errorf("a passphrase is needed, set %s in batch mode", passphraseEnv)
+	}
+
+	prompt := promptui.Prompt{
+		Label: "Passphrase",
+		Mask:  '*',
+		Validate: func(value string) error {
+			if value == "" {
+				return fmt.Errorf("the passphrase cannot be empty")
+			}
+			return nil
+		},
+	}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+
+	prompt.Label = "Confirm passphrase"
+	again, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if again != passphrase {
+		return "", fmt.Errorf("the passphrases do not match")
+	}
+
+	return passphrase, nil
+}
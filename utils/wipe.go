@@ -0,0 +1,95 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Wipe makes RemoveFile and RemoveAll overwrite files with random data
+// before deleting them. On SSDs, flash drives and journaling or copy-on-write
+// file systems the old data can survive anyway, this only makes recovering
+// it harder.
+var Wipe bool
+
+// RemoveFile deletes the file, overwriting it first if Wipe is set. The file
+// is deleted even if it could not be overwritten.
+func RemoveFile(path string) error {
+	var wipeErr error
+	if Wipe {
+		wipeErr = wipeFile(path)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return wipeErr
+}
+
+// RemoveAll deletes the folder and everything in it as os.RemoveAll does,
+// overwriting every file first if Wipe is set. Links are deleted without
+// overwriting what they point to.
+func RemoveAll(path string) error {
+	var wipeErr error
+	if Wipe {
+		err := filepath.WalkDir(path, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			if err := wipeFile(name); err != nil && wipeErr == nil {
+				wipeErr = err
+			}
+			return nil
+		})
+		if err != nil && wipeErr == nil {
+			wipeErr = fmt.Errorf("failed to list the files to overwrite: %v", err)
+		}
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return wipeErr
+}
+
+// wipeFile overwrites the content of the file with random data, and flushes
+// it to the disk. The files of acquisitions are read only once hashed, so the
+// file is made writable first.
+func wipeFile(path string) error {
+	err := os.Chmod(path, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to make %s writable to overwrite it: %v", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s to overwrite it: %v", path, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to overwrite %s: %v", path, err)
+	}
+	if !stat.Mode().IsRegular() {
+		return nil
+	}
+	if _, err := io.CopyN(file, rand.Reader, stat.Size()); err != nil {
+		return fmt.Errorf("failed to overwrite %s: %v", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to overwrite %s: %v", path, err)
+	}
+	return file.Close()
+}
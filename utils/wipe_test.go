@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWipeReadOnlyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "getprop.txt")
+	content := bytes.Repeat([]byte("ro.product.model=Pixel\n"), 100)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	// As HashFiles leaves the files of acquisitions.
+	if err := os.Chmod(path, 0o400); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+
+	if err := wipeFile(path); err != nil {
+		t.Fatalf("wipeFile() error = %v", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if stat.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want the file made writable", stat.Mode().Perm())
+	}
+	wiped, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(wiped) != len(content) || bytes.Equal(wiped, content) {
+		t.Errorf("the file was not overwritten")
+	}
+
+	Wipe = true
+	defer func() { Wipe = false }()
+	if err := RemoveFile(path); err != nil {
+		t.Fatalf("RemoveFile() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Stat() error = %v, want the file removed", err)
+	}
+}
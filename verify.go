@@ -0,0 +1,85 @@
+// androidqf - Android Quick Forensics
+// Copyright (c) 2021-2026 Claudio Guarnieri.
+// Use of this software is governed by the MVT License 1.1 that can be found at
+//   https://license.mvt.re/1.1/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"github.com/mvt-project/androidqf/acquisition"
+	"github.com/mvt-project/androidqf/log"
+	"github.com/mvt-project/androidqf/utils"
+)
+
+// verify runs "androidqf verify", which checks the signed manifest of an
+// acquisition folder or encrypted archive. It returns the exit code, which is
+// not zero if the acquisition does not verify.
+func verify(args []string) int {
+	var key string
+	var identity string
+	var passphrase bool
+
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: androidqf verify --key signing.pub.pem [--identity key.txt|--passphrase] <folder|archive.zip.age>")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&key, "key", "", "ed25519 public key of the examiner, in PEM format")
+	flags.StringVar(&key, "k", "", "ed25519 public key of the examiner, in PEM format")
+	flags.StringVar(&identity, "identity", "", "File with the age private keys or an SSH private key, for encrypted archives")
+	flags.StringVar(&identity, "i", "", "File with the age private keys or an SSH private key, for encrypted archives")
+	flags.BoolVar(&passphrase, "passphrase", false, "Decrypt with a passphrase, asked for or read from "+passphraseEnv)
+	flags.BoolVar(&utils.Wipe, "wipe", false, "Overwrite the temporary decrypted archive before deleting it")
+	flags.Parse(args)
+
+	if key == "" || flags.NArg() != 1 || (identity != "" && passphrase) {
+		flags.Usage()
+		return 2
+	}
+	target := flags.Arg(0)
+
+	verifyingKey, err := acquisition.LoadVerifyingKey(key)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	stat, err := os.Stat(target)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	var manifest *acquisition.Manifest
+	var verification *acquisition.Verification
+	if stat.IsDir() {
+		log.Infof("Verifying the acquisition in %s...", target)
+		manifest, verification, err = acquisition.VerifyFolder(target, verifyingKey)
+	} else {
+		if identity == "" && !passphrase {
+			log.Error("An --identity or --passphrase is needed to verify an encrypted archive")
+			return 2
+		}
+		var identities []age.Identity
+		identities, err = loadIdentities(identity, passphrase)
+		if err != nil {
+			log.Error(err)
+			return 1
+		}
+		log.Infof("Verifying the encrypted acquisition %s...", target)
+		manifest, verification, err = acquisition.VerifyArchive(target, identities, verifyingKey)
+	}
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	log.Infof("The manifest is signed by the key: acquisition %s of device %s, from %s to %s",
+		manifest.UUID, manifest.Serial, manifest.Started.Format("2006-01-02 15:04:05"), manifest.Completed.Format("2006-01-02 15:04:05"))
+	return printVerification(verification, "the manifest")
+}